@@ -0,0 +1,155 @@
+package cfsecurity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+)
+
+// renewMargin is the time before expiration at which a uaa token is renewed
+const renewMargin = 30 * time.Second
+
+// StaticToken authenticate with a fixed token, which is never renewed, the bearer prefix is added when missing
+func StaticToken(token string) client.TokenSource {
+	if !strings.HasPrefix(strings.ToLower(token), "bearer ") {
+		token = "bearer " + token
+	}
+	return staticToken(token)
+}
+
+type staticToken string
+
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+func (t staticToken) Refresh(string) (string, error) {
+	return string(t), nil
+}
+
+// UAATokenSource get tokens from uaa, renewing them shortly before they expire or when they are rejected.
+// It is safe for concurrent use.
+type UAATokenSource struct {
+	uaaUrl       string
+	clientId     string
+	clientSecret string
+	httpClient   *http.Client
+	form         url.Values
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewClientCredentialsSource authenticate as a uaa client with the client credentials grant
+func NewClientCredentialsSource(uaaUrl, clientId, clientSecret string, transport http.RoundTripper) *UAATokenSource {
+	return newUAATokenSource(uaaUrl, clientId, clientSecret, transport, url.Values{
+		"grant_type": {"client_credentials"},
+	})
+}
+
+// NewRefreshTokenSource authenticate as a user with the refresh token grant, as the cf cli does with client cf and an empty secret.
+// A refresh token given back by uaa replaces the previous one.
+func NewRefreshTokenSource(uaaUrl, clientId, clientSecret, refreshToken string, transport http.RoundTripper) *UAATokenSource {
+	return newUAATokenSource(uaaUrl, clientId, clientSecret, transport, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+func newUAATokenSource(uaaUrl, clientId, clientSecret string, transport http.RoundTripper, form url.Values) *UAATokenSource {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &UAATokenSource{
+		uaaUrl:       strings.TrimSuffix(uaaUrl, "/"),
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		httpClient:   &http.Client{Transport: transport, Timeout: time.Minute},
+		form:         form,
+	}
+}
+
+// Token give the current token, a new one is asked to uaa when it expires soon
+func (s *UAATokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expiresAt.Add(-renewMargin)) {
+		return s.token, nil
+	}
+	return s.renew()
+}
+
+// Refresh ask a new token to uaa unless the rejected token has already been replaced
+func (s *UAATokenSource) Refresh(rejected string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.token != rejected {
+		return s.token, nil
+	}
+	return s.renew()
+}
+
+// renew ask a token to uaa, s.mu must be held
+func (s *UAATokenSource) renew() (string, error) {
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.uaaUrl+"/oauth/token", strings.NewReader(s.form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.SetBasicAuth(url.QueryEscape(s.clientId), url.QueryEscape(s.clientSecret))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	resp, err := s.httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.Unmarshal(body, &token); err != nil && resp.StatusCode == http.StatusOK {
+		return "", errors.Wrap(err, "Error unmarshalling uaa token")
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", &AuthError{StatusCode: resp.StatusCode, Code: token.Error, Description: token.ErrorDescription}
+	}
+	if token.RefreshToken != "" && s.form.Get("grant_type") == "refresh_token" {
+		s.form.Set("refresh_token", token.RefreshToken)
+	}
+	s.token = "bearer " + token.AccessToken
+	s.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// AuthError is a failure to get a token from uaa
+type AuthError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *AuthError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("uaa authentication failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("uaa authentication failed with status %d: %s: %s", e.StatusCode, e.Code, e.Description)
+}
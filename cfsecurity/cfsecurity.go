@@ -0,0 +1,370 @@
+// Package cfsecurity is a client of the cfsecurity server api, which lets org managers bind security groups to their spaces.
+//
+// A client is created with the url of cfsecurity server and a token source:
+//
+//	auth := cfsecurity.NewClientCredentialsSource("https://uaa.example.com", "my-client", "secret", nil)
+//	c := cfsecurity.NewClient("https://cfsecurity.example.com", auth, nil)
+//	estimate, err := c.BindSecurityGroup(ctx, secGroupGuid, spaceGuid)
+//
+// Requests failing with a transient error are retried and requests rejected with a 401 are sent again with a renewed token.
+// Errors returned by the server are client.CloudFoundryHTTPError, which can be matched with errors.Is against
+// ErrUnauthorized, ErrForbidden, ErrNotFound and ErrUnprocessable.
+package cfsecurity
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+// Errors given by the server, see client.CloudFoundryHTTPError for details
+var (
+	ErrUnauthorized  = client.ErrUnauthorized
+	ErrForbidden     = client.ErrForbidden
+	ErrNotFound      = client.ErrNotFound
+	ErrUnprocessable = client.ErrUnprocessable
+)
+
+// Client call cfsecurity server, it is safe for concurrent use
+type Client struct {
+	endpoint string
+	api      *client.Client
+}
+
+// NewClient create a client of the cfsecurity server at endpoint, a nil transport use the default transport
+func NewClient(endpoint string, auth client.TokenSource, transport *http.Transport) *Client {
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	api := client.NewClient(endpoint, nil, "", endpoint, transport)
+	api.SetTokenSource(auth)
+	return &Client{endpoint: endpoint, api: api}
+}
+
+// SetTimeout set the deadline of each call, 0 means no deadline other than the one of the call context
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.api.SetTimeout(timeout)
+}
+
+// SetRetryPolicy change how calls failing with a transient error are retried
+func (c *Client) SetRetryPolicy(policy client.RetryPolicy) {
+	c.api.SetRetryPolicy(policy)
+}
+
+// BindingCheck tell if a security group can be bound to a space by the current user
+type BindingCheck struct {
+	OrganizationGUID string `json:"organization_guid"`
+	IsEntitled       bool   `json:"is_entitled"`
+}
+
+// Entitlement is an org entitled to a security group
+//
+// Deprecated: entitlements were removed, org managers can bind any security group
+type Entitlement struct {
+	SecurityGroupGUID string `json:"security_group_guid"`
+	OrganizationGUID  string `json:"organization_guid"`
+}
+
+// SecurityGroupsFilter select security groups, empty fields are not filtered
+type SecurityGroupsFilter struct {
+	Names []string
+	GUIDs []string
+}
+
+// SecurityGroupMatch is a security group with a rule matching a searched destination
+type SecurityGroupMatch struct {
+	SecurityGroup client.SecurityGroup `json:"security_group"`
+	Rule          client.Rule          `json:"rule"`
+}
+
+// BindSecurityGroup bind a security group to a space for running and staging,
+// it gives the rules garden writes for the space once bound
+func (c *Client) BindSecurityGroup(ctx context.Context, secGroupGuid, spaceGuid string) (client.RuleEstimate, error) {
+	var estimate client.RuleEstimate
+	err := c.api.DoJSON(ctx, http.MethodPost, c.endpoint+"/v3/bindings", model.BindingParams{
+		SecurityGroupGUID: secGroupGuid,
+		SpaceGUID:         spaceGuid,
+	}, &estimate)
+	return estimate, err
+}
+
+// UnbindSecurityGroup unbind a security group from a space for running and staging
+func (c *Client) UnbindSecurityGroup(ctx context.Context, secGroupGuid, spaceGuid string) error {
+	return c.api.DoJSON(ctx, http.MethodDelete, c.endpoint+"/v3/bindings", model.BindingParams{
+		SecurityGroupGUID: secGroupGuid,
+		SpaceGUID:         spaceGuid,
+	}, nil)
+}
+
+// EstimateBinding is a dry run of BindSecurityGroup: the binding is checked and the rules garden would write are given
+// but nothing is bound, BindSecurityGroup already gives the estimate of the binding it makes
+func (c *Client) EstimateBinding(ctx context.Context, secGroupGuid, spaceGuid string) (client.RuleEstimate, error) {
+	var estimate client.RuleEstimate
+	err := c.api.DoJSON(ctx, http.MethodPost, c.endpoint+"/v3/bindings?dry_run=true", model.BindingParams{
+		SecurityGroupGUID: secGroupGuid,
+		SpaceGUID:         spaceGuid,
+	}, &estimate)
+	return estimate, err
+}
+
+// BindSecurityGroupLifecycle bind a security group to a space for one lifecycle, running or staging
+func (c *Client) BindSecurityGroupLifecycle(ctx context.Context, secGroupGuid, spaceGuid, lifecycle string) error {
+	in := map[string][]map[string]string{"data": {{"guid": spaceGuid}}}
+	return c.api.DoJSON(ctx, http.MethodPost, c.lifecycleUrl(secGroupGuid, lifecycle), in, nil)
+}
+
+// UnbindSecurityGroupLifecycle unbind a security group from a space for one lifecycle, running or staging
+func (c *Client) UnbindSecurityGroupLifecycle(ctx context.Context, secGroupGuid, spaceGuid, lifecycle string) error {
+	return c.api.DoJSON(ctx, http.MethodDelete, c.lifecycleUrl(secGroupGuid, lifecycle)+"/"+url.PathEscape(spaceGuid), nil, nil)
+}
+
+func (c *Client) lifecycleUrl(secGroupGuid, lifecycle string) string {
+	return c.endpoint + "/v3/security_groups/" + url.PathEscape(secGroupGuid) + "/relationships/" + lifecycle + "_spaces"
+}
+
+// CheckBinding tell if the current user can bind a security group to a space
+func (c *Client) CheckBinding(ctx context.Context, secGroupGuid, spaceGuid string) (BindingCheck, error) {
+	var check BindingCheck
+	path := "/v3/security_groups/" + url.PathEscape(secGroupGuid) + "/relationships/spaces/" + url.PathEscape(spaceGuid) + "/check"
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+path, nil, &check)
+	return check, err
+}
+
+// ListSecurityGroups list security groups matching filter, following all pages
+func (c *Client) ListSecurityGroups(ctx context.Context, filter SecurityGroupsFilter) ([]client.SecurityGroup, error) {
+	queries := []ccv3.Query{client.Large}
+	if len(filter.Names) > 0 {
+		queries = append(queries, ccv3.Query{Key: ccv3.NameFilter, Values: filter.Names})
+	}
+	if len(filter.GUIDs) > 0 {
+		queries = append(queries, ccv3.Query{Key: ccv3.GUIDFilter, Values: filter.GUIDs})
+	}
+	secGroups := make([]client.SecurityGroup, 0)
+	for secGroup, err := range client.Paginate[client.SecurityGroup](ctx, c.api, c.endpoint+"/v3/security_groups"+client.QueriesToQueryString(queries)) {
+		if err != nil {
+			return secGroups, err
+		}
+		secGroups = append(secGroups, secGroup)
+	}
+	return secGroups, nil
+}
+
+// GetSecurityGroup retrieve a security group by guid
+func (c *Client) GetSecurityGroup(ctx context.Context, guid string) (client.SecurityGroup, error) {
+	var secGroup client.SecurityGroup
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/security_groups/"+url.PathEscape(guid), nil, &secGroup)
+	return secGroup, err
+}
+
+// CreateSecurityGroup create a security group not owned by any org, it requires an admin token,
+// invalid rules are refused with ErrUnprocessable
+func (c *Client) CreateSecurityGroup(ctx context.Context, params client.SecurityGroupParams) (client.SecurityGroup, error) {
+	var secGroup client.SecurityGroup
+	err := c.api.DoJSON(ctx, http.MethodPost, c.endpoint+"/v3/security_groups", params, &secGroup)
+	return secGroup, err
+}
+
+// UpdateSecurityGroup change name, rules or global enablement of a security group, it requires an admin token
+// unless the security group is owned by an org, see UpdateOrgSecurityGroup
+func (c *Client) UpdateSecurityGroup(ctx context.Context, guid string, params client.SecurityGroupParams) (client.SecurityGroup, error) {
+	var secGroup client.SecurityGroup
+	err := c.api.DoJSON(ctx, http.MethodPatch, c.endpoint+"/v3/security_groups/"+url.PathEscape(guid), params, &secGroup)
+	return secGroup, err
+}
+
+// DeleteSecurityGroup delete a security group, it requires an admin token
+func (c *Client) DeleteSecurityGroup(ctx context.Context, guid string) error {
+	return c.api.DoJSON(ctx, http.MethodDelete, c.endpoint+"/v3/security_groups/"+url.PathEscape(guid), nil, nil)
+}
+
+// SetGloballyEnabled enable or disable a security group for all spaces on a lifecycle, running or staging,
+// an empty lifecycle means both
+func (c *Client) SetGloballyEnabled(ctx context.Context, guid, lifecycle string, enabled bool) (client.SecurityGroup, error) {
+	globallyEnabled := &client.GloballyEnabled{}
+	if lifecycle == "" || lifecycle == client.LifecycleRunning {
+		globallyEnabled.Running = &enabled
+	}
+	if lifecycle == "" || lifecycle == client.LifecycleStaging {
+		globallyEnabled.Staging = &enabled
+	}
+	return c.UpdateSecurityGroup(ctx, guid, client.SecurityGroupParams{GloballyEnabled: globallyEnabled})
+}
+
+// SearchSecurityGroups list security groups with a rule reaching a destination, an ip or a cidr, on a port, 0 means any port
+func (c *Client) SearchSecurityGroups(ctx context.Context, destination string, port int) ([]SecurityGroupMatch, error) {
+	ipNet, err := client.ParseDestination(destination)
+	if err != nil {
+		return nil, err
+	}
+	secGroups, err := c.ListSecurityGroups(ctx, SecurityGroupsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]SecurityGroupMatch, 0)
+	for _, secGroup := range secGroups {
+		for _, rule := range secGroup.Rules {
+			if rule.OverlapsNet(ipNet) && rule.ContainsPort(port) {
+				matches = append(matches, SecurityGroupMatch{SecurityGroup: secGroup, Rule: rule})
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+// SearchReachableSpaces list spaces which can reach a destination, an ip or a cidr, on a port, 0 means any port,
+// an empty protocol means tcp
+func (c *Client) SearchReachableSpaces(ctx context.Context, destination string, port int, protocol string) (client.SpacesAccess, error) {
+	var access client.SpacesAccess
+	query := destinationQuery(destination, port, protocol)
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/reachable_spaces?"+query.Encode(), nil, &access)
+	return access, err
+}
+
+// EffectiveSecurityGroups give the security groups applied to a space with their merged rules
+func (c *Client) EffectiveSecurityGroups(ctx context.Context, spaceGuid string) (client.EffectiveSecurityGroups, error) {
+	var effective client.EffectiveSecurityGroups
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/spaces/"+url.PathEscape(spaceGuid)+"/effective_security_groups", nil, &effective)
+	return effective, err
+}
+
+// CheckEgress tell if apps of a space can reach an ip on a port, an empty protocol means tcp
+func (c *Client) CheckEgress(ctx context.Context, spaceGuid string, destination string, port int, protocol string) (client.EgressCheck, error) {
+	var check client.EgressCheck
+	query := destinationQuery(destination, port, protocol)
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/spaces/"+url.PathEscape(spaceGuid)+"/check_egress?"+query.Encode(), nil, &check)
+	return check, err
+}
+
+// BindOrgSecurityGroup bind a security group to all spaces of an org and to spaces created later,
+// an empty lifecycle means running and staging, the org binding gives the rules garden writes for each space once bound
+func (c *Client) BindOrgSecurityGroup(ctx context.Context, secGroupGuid, orgGuid, lifecycle string) (model.OrgBinding, error) {
+	var orgBinding model.OrgBinding
+	err := c.api.DoJSON(ctx, http.MethodPost, c.endpoint+"/v3/org_bindings", model.OrgBindingParams{
+		SecurityGroupGUID: secGroupGuid,
+		OrganizationGUID:  orgGuid,
+		Lifecycle:         lifecycle,
+	}, &orgBinding)
+	return orgBinding, err
+}
+
+// EstimateOrgBinding is a dry run of BindOrgSecurityGroup: the org binding is checked and the rules garden would write
+// for each space are given but nothing is bound or stored, BindOrgSecurityGroup already gives the estimates of the binding it makes
+func (c *Client) EstimateOrgBinding(ctx context.Context, secGroupGuid, orgGuid, lifecycle string) ([]client.RuleEstimate, error) {
+	var orgBinding model.OrgBinding
+	err := c.api.DoJSON(ctx, http.MethodPost, c.endpoint+"/v3/org_bindings?dry_run=true", model.OrgBindingParams{
+		SecurityGroupGUID: secGroupGuid,
+		OrganizationGUID:  orgGuid,
+		Lifecycle:         lifecycle,
+	}, &orgBinding)
+	return orgBinding.RuleEstimates, err
+}
+
+// UnbindOrgSecurityGroup unbind a security group from all spaces of an org and remove the org binding
+func (c *Client) UnbindOrgSecurityGroup(ctx context.Context, secGroupGuid, orgGuid, lifecycle string) error {
+	return c.api.DoJSON(ctx, http.MethodDelete, c.endpoint+"/v3/org_bindings", model.OrgBindingParams{
+		SecurityGroupGUID: secGroupGuid,
+		OrganizationGUID:  orgGuid,
+		Lifecycle:         lifecycle,
+	}, nil)
+}
+
+// ListOrgBindings list org bindings of an org, admins can give an empty org guid to list all of them
+func (c *Client) ListOrgBindings(ctx context.Context, orgGuid string) ([]model.OrgBinding, error) {
+	orgBindings := make([]model.OrgBinding, 0)
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/org_bindings"+orgQuery(orgGuid), nil, &orgBindings)
+	return orgBindings, err
+}
+
+// ListOrgBindingActions list bindings made on spaces created in an org after it was bound,
+// admins can give an empty org guid to list all of them
+func (c *Client) ListOrgBindingActions(ctx context.Context, orgGuid string) ([]model.OrgBindingAction, error) {
+	actions := make([]model.OrgBindingAction, 0)
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/org_bindings/actions"+orgQuery(orgGuid), nil, &actions)
+	return actions, err
+}
+
+// CreateOrgSecurityGroup create a private security group owned by an org, with rules or from a template with its params,
+// rules not following the org policy are refused with ErrUnprocessable
+func (c *Client) CreateOrgSecurityGroup(ctx context.Context, params model.OrgSecurityGroupParams) (model.OrgSecurityGroup, error) {
+	var orgSecGroup model.OrgSecurityGroup
+	err := c.api.DoJSON(ctx, http.MethodPost, c.endpoint+"/v3/security_groups", params, &orgSecGroup)
+	return orgSecGroup, err
+}
+
+// UpdateOrgSecurityGroup change name or rules of a private security group, empty params are left unchanged
+func (c *Client) UpdateOrgSecurityGroup(ctx context.Context, secGroupGuid string, params model.OrgSecurityGroupParams) (model.OrgSecurityGroup, error) {
+	var orgSecGroup model.OrgSecurityGroup
+	err := c.api.DoJSON(ctx, http.MethodPatch, c.endpoint+"/v3/security_groups/"+url.PathEscape(secGroupGuid), params, &orgSecGroup)
+	return orgSecGroup, err
+}
+
+// DeleteOrgSecurityGroup delete a private security group
+func (c *Client) DeleteOrgSecurityGroup(ctx context.Context, secGroupGuid string) error {
+	return c.api.DoJSON(ctx, http.MethodDelete, c.endpoint+"/v3/security_groups/"+url.PathEscape(secGroupGuid), nil, nil)
+}
+
+// ListOrgSecurityGroups list private security groups of an org, admins can give an empty org guid to list all of them
+func (c *Client) ListOrgSecurityGroups(ctx context.Context, orgGuid string) ([]model.OrgSecurityGroup, error) {
+	orgSecGroups := make([]model.OrgSecurityGroup, 0)
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/org_security_groups"+orgQuery(orgGuid), nil, &orgSecGroups)
+	return orgSecGroups, err
+}
+
+// GetOrgSecurityGroupPolicy give destinations, ports and protocols allowed in private security groups of an org
+func (c *Client) GetOrgSecurityGroupPolicy(ctx context.Context, orgGuid string) (model.PrivateSecGroupPolicy, error) {
+	var policy model.PrivateSecGroupPolicy
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/org_security_groups/policy"+orgQuery(orgGuid), nil, &policy)
+	return policy, err
+}
+
+// ListSecurityGroupTemplates list templates which can be used to create private security groups
+func (c *Client) ListSecurityGroupTemplates(ctx context.Context) ([]model.SecGroupTemplate, error) {
+	templates := make([]model.SecGroupTemplate, 0)
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/security_group_templates", nil, &templates)
+	return templates, err
+}
+
+// GetBindingQuotaUsage give the binding quota of an org and its usage by each space of the org
+func (c *Client) GetBindingQuotaUsage(ctx context.Context, orgGuid string) (model.QuotaUsage, error) {
+	var usage model.QuotaUsage
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v3/binding_quotas"+orgQuery(orgGuid), nil, &usage)
+	return usage, err
+}
+
+// ListEntitlements list entitlements, it requires an admin token
+//
+// Deprecated: entitlements were removed, the server always gives an empty list
+func (c *Client) ListEntitlements(ctx context.Context) ([]Entitlement, error) {
+	entitlements := make([]Entitlement, 0)
+	err := c.api.DoJSON(ctx, http.MethodGet, c.endpoint+"/v2/security_entitlement", nil, &entitlements)
+	return entitlements, err
+}
+
+func destinationQuery(destination string, port int, protocol string) url.Values {
+	query := url.Values{}
+	query.Set("destination", destination)
+	if port > 0 {
+		query.Set("port", strconv.Itoa(port))
+	}
+	if protocol != "" {
+		query.Set("protocol", protocol)
+	}
+	return query
+}
+
+func orgQuery(orgGuid string) string {
+	if orgGuid == "" {
+		return ""
+	}
+	return "?" + url.Values{"organization_guid": {orgGuid}}.Encode()
+}
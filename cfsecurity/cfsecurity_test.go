@@ -0,0 +1,251 @@
+package cfsecurity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client/clienttest"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+// newFakeServer start a fake cloud controller and uaa seeded with the fixture, it serves the security group
+// endpoints the sdk shares with cfsecurity server
+func newFakeServer(t *testing.T) *clienttest.Server {
+	t.Helper()
+	s, err := clienttest.NewServerFromFixture(filepath.Join("..", "client", "clienttest", "testdata", "fixture.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestClient(s *clienttest.Server, auth client.TokenSource) *Client {
+	c := NewClient(s.URL, auth, nil)
+	c.SetRetryPolicy(client.RetryPolicy{MaxAttempts: 1})
+	return c
+}
+
+// refreshToken log in a user of the fixture with the password grant as the cf cli does and give its refresh token
+func refreshToken(t *testing.T, s *clienttest.Server, username, password string) string {
+	t.Helper()
+	form := url.Values{"grant_type": {"password"}, "username": {username}, "password": {password}}
+	request, err := http.NewRequest(http.MethodPost, s.URL+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.SetBasicAuth(clienttest.DefaultClientID, "")
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil || token.RefreshToken == "" {
+		t.Fatalf("no refresh token for %s: status %d, %v", username, resp.StatusCode, err)
+	}
+	return token.RefreshToken
+}
+
+func TestClientCredentialsSource(t *testing.T) {
+	s := newFakeServer(t)
+	auth := NewClientCredentialsSource(s.URL, "cfsecurity", "secret", nil)
+
+	first, err := auth.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := auth.Token(); again != first {
+		t.Error("a token far from expiring must be kept")
+	}
+	if refreshed, _ := auth.Refresh("bearer older"); refreshed != first {
+		t.Error("a token already replaced must not be renewed again")
+	}
+	renewed, err := auth.Refresh(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == first {
+		t.Error("a rejected token must be renewed")
+	}
+
+	// tokens expiring within the renew margin are renewed on each use
+	s.SetTokenTTL(time.Second)
+	if _, err = auth.Refresh(renewed); err != nil {
+		t.Fatal(err)
+	}
+	short, _ := auth.Token()
+	if again, _ := auth.Token(); again == short {
+		t.Error("a token expiring soon must be renewed")
+	}
+
+	secGroups, err := newTestClient(s, auth).ListSecurityGroups(context.Background(), SecurityGroupsFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secGroups) != 2 {
+		t.Errorf("security groups = %+v, want the 2 of the fixture", secGroups)
+	}
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	s := newFakeServer(t)
+	initial := refreshToken(t, s, "admin", "admin")
+	auth := NewRefreshTokenSource(s.URL, clienttest.DefaultClientID, "", initial, nil)
+
+	token, err := auth.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated := auth.form.Get("refresh_token"); rotated == initial || rotated == "" {
+		t.Errorf("refresh token = %q, want the one given back by uaa", rotated)
+	}
+	if _, err = auth.Refresh(token); err != nil {
+		t.Fatalf("renewing with the rotated refresh token: %s", err)
+	}
+
+	_, err = NewRefreshTokenSource(s.URL, clienttest.DefaultClientID, "", "unknown", nil).Token()
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized || authErr.Code != "invalid_token" {
+		t.Errorf("got %v, want an invalid_token auth error", err)
+	}
+}
+
+func TestBadCredentials(t *testing.T) {
+	s := newFakeServer(t)
+	auth := NewClientCredentialsSource(s.URL, "cfsecurity", "wrong", nil)
+
+	_, err := newTestClient(s, auth).GetSecurityGroup(context.Background(), "sg-db")
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.StatusCode != http.StatusUnauthorized || authErr.Code != "unauthorized" {
+		t.Errorf("got %v, want an unauthorized auth error", err)
+	}
+}
+
+func TestRejectedTokenIsRenewed(t *testing.T) {
+	s := newFakeServer(t)
+	auth := NewClientCredentialsSource(s.URL, "cfsecurity", "secret", nil)
+	auth.token = "bearer revoked"
+	auth.expiresAt = time.Now().Add(time.Hour)
+
+	if _, err := newTestClient(s, auth).GetSecurityGroup(context.Background(), "sg-db"); err != nil {
+		t.Fatalf("expected the call to succeed with a renewed token: %s", err)
+	}
+	if auth.token == "bearer revoked" {
+		t.Error("expected the rejected token to be replaced")
+	}
+}
+
+func TestBindUnbindLifecycle(t *testing.T) {
+	s := newFakeServer(t)
+	ctx := context.Background()
+	c := newTestClient(s, NewClientCredentialsSource(s.URL, "cfsecurity", "secret", nil))
+
+	for _, lifecycle := range []string{client.LifecycleRunning, client.LifecycleStaging} {
+		if err := c.BindSecurityGroupLifecycle(ctx, "sg-db", "space-2", lifecycle); err != nil {
+			t.Fatalf("bind %s: %s", lifecycle, err)
+		}
+		if !s.Fake.IsBound("sg-db", "space-2", lifecycle) {
+			t.Errorf("expected sg-db bound to space-2 on %s", lifecycle)
+		}
+		if err := c.UnbindSecurityGroupLifecycle(ctx, "sg-db", "space-2", lifecycle); err != nil {
+			t.Fatalf("unbind %s: %s", lifecycle, err)
+		}
+		if s.Fake.IsBound("sg-db", "space-2", lifecycle) {
+			t.Errorf("expected sg-db unbound from space-2 on %s", lifecycle)
+		}
+	}
+}
+
+func TestBindSecurityGroupGivesEstimate(t *testing.T) {
+	want := client.RuleEstimate{SpaceGUID: "space-2", SpaceName: "prod", Running: 3, Staging: 3}
+	var got model.BindingParams
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/v3/bindings" || req.URL.RawQuery != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(req.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(want)
+	}))
+	defer server.Close()
+
+	estimate, err := NewClient(server.URL, StaticToken("token"), nil).BindSecurityGroup(context.Background(), "sg-db", "space-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate != want {
+		t.Errorf("estimate = %+v, want %+v", estimate, want)
+	}
+	if got.SecurityGroupGUID != "sg-db" || got.SpaceGUID != "space-2" {
+		t.Errorf("binding params = %+v", got)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	s := newFakeServer(t)
+	ctx := context.Background()
+	admin := newTestClient(s, NewClientCredentialsSource(s.URL, "cfsecurity", "secret", nil))
+	dev := newTestClient(s, NewRefreshTokenSource(s.URL, clienttest.DefaultClientID, "", refreshToken(t, s, "dev", "dev"), nil))
+	anonymous := newTestClient(s, StaticToken("invalid"))
+
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{
+			name: "unknown security group",
+			call: func() error {
+				_, err := admin.GetSecurityGroup(ctx, "unknown")
+				return err
+			},
+			want: ErrNotFound,
+		},
+		{
+			name: "unknown space",
+			call: func() error {
+				return admin.BindSecurityGroupLifecycle(ctx, "sg-db", "unknown", client.LifecycleRunning)
+			},
+			want: ErrUnprocessable,
+		},
+		{
+			name: "change without admin scope",
+			call: func() error { return dev.DeleteSecurityGroup(ctx, "sg-db") },
+			want: ErrForbidden,
+		},
+		{
+			name: "invalid token",
+			call: func() error {
+				_, err := anonymous.GetSecurityGroup(ctx, "sg-db")
+				return err
+			},
+			want: ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			var cfErr client.CloudFoundryHTTPError
+			if !errors.As(err, &cfErr) {
+				t.Errorf("got %T, want a client.CloudFoundryHTTPError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+)
+
+// API is the set of cloud controller operations on security groups, orgs, spaces, roles and bindings used by cfsecurity,
+// it is implemented by Client and by the in-memory fake of package clienttest
+type API interface {
+	GetApiUrl() string
+
+	ListAllSecGroupsContext(ctx context.Context, req *http.Request) ([]byte, error)
+	GetSecGroupsContext(ctx context.Context, queries []ccv3.Query, page int) (SecurityGroups, error)
+	IterSecGroups(ctx context.Context, queries []ccv3.Query) iter.Seq2[SecurityGroup, error]
+	GetSecGroupByNameContext(ctx context.Context, name string) (SecurityGroup, error)
+	CreateSecurityGroupContext(ctx context.Context, params SecurityGroupParams) (SecurityGroup, error)
+	UpdateSecurityGroupContext(ctx context.Context, guid string, params SecurityGroupParams) (SecurityGroup, error)
+	DeleteSecurityGroupContext(ctx context.Context, guid string) error
+
+	GetOrganizationContext(ctx context.Context, guid string) (Organization, error)
+
+	GetSpaceByGuidContext(ctx context.Context, guid string) (Space, error)
+	GetSpacesWithOrgContext(ctx context.Context, queries []ccv3.Query, page int) (Spaces, error)
+	IterSpacePagesWithOrg(ctx context.Context, queries []ccv3.Query) iter.Seq2[Page[Space], error]
+	GetSpacesCreatedAfterContext(ctx context.Context, orgGuids []string, after time.Time) (Spaces, error)
+	GetSecGroupSpacesContext(ctx context.Context, secGroup *SecurityGroup) (Spaces, error)
+
+	GetRolesContext(ctx context.Context, filter RolesFilter) (User, error)
+	GetOrgManagersContext(ctx context.Context, orgGuid string, page int) (User, error)
+	GetManagedOrgsContext(ctx context.Context, userGuid string, orgGuids []string) (map[string]bool, error)
+	GetManagedSpacesContext(ctx context.Context, userGuid string, spaceGuids []string) (map[string]bool, error)
+
+	BindSecurityGroupContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error
+	UnBindSecurityGroupContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error
+	BindRunningSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error
+	BindStagingSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error
+	UnBindRunningSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error
+	UnBindStagingSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error
+}
+
+var _ API = (*Client)(nil)
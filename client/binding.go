@@ -2,17 +2,25 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 )
 
 func (c *Client) BindSecurityGroup(secGroupGUID, spaceGUID string, endpoint string) error {
+	return c.BindSecurityGroupContext(context.Background(), secGroupGUID, spaceGUID, endpoint)
+}
+
+// BindSecurityGroupContext is like BindSecurityGroup, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BindSecurityGroupContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
-	err := c.BindRunningSecGroupToSpace(secGroupGUID, spaceGUID, endpoint)
+	err := c.BindRunningSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint)
 	if err != nil {
 		return err
 	}
 
-	err = c.BindStagingSecGroupToSpace(secGroupGUID, spaceGUID, endpoint)
+	err = c.BindStagingSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint)
 	if err != nil {
 		return err
 	}
@@ -21,13 +29,20 @@ func (c *Client) BindSecurityGroup(secGroupGUID, spaceGUID string, endpoint stri
 }
 
 func (c *Client) UnBindSecurityGroup(secGroupGUID, spaceGUID string, endpoint string) error {
+	return c.UnBindSecurityGroupContext(context.Background(), secGroupGUID, spaceGUID, endpoint)
+}
 
-	err := c.UnBindRunningSecGroupToSpace(secGroupGUID, spaceGUID, endpoint)
+// UnBindSecurityGroupContext is like UnBindSecurityGroup, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) UnBindSecurityGroupContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	err := c.UnBindRunningSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint)
 	if err != nil {
 		return err
 	}
 
-	err = c.UnBindStagingSecGroupToSpace(secGroupGUID, spaceGUID, endpoint)
+	err = c.UnBindStagingSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint)
 	if err != nil {
 		return err
 	}
@@ -35,136 +50,151 @@ func (c *Client) UnBindSecurityGroup(secGroupGUID, spaceGUID string, endpoint st
 	return nil
 }
 
-func (c *Client) BindUnbindSecurityGroup(secGroupGUID, spaceGUID, method, endpoint string) error {
-	var jsonData = []byte(`{"security_group_guid":"` + secGroupGUID + `", "space_guid":"` + spaceGUID + `"}`)
+// BindUnbindSecurityGroup bind or unbind a security group to a space for running and staging through cfsecurity server,
+// the rules garden writes for the space are given back on bind
+func (c *Client) BindUnbindSecurityGroup(secGroupGUID, spaceGUID, method, endpoint string) (RuleEstimate, error) {
+	return c.BindUnbindSecurityGroupContext(context.Background(), secGroupGUID, spaceGUID, method, endpoint)
+}
 
-	client := &http.Client{Transport: &c.transport}
-	url := endpoint + "/v3/bindings"
-	Request, err := http.NewRequest(method, url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
+// BindUnbindSecurityGroupContext is like BindUnbindSecurityGroup, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BindUnbindSecurityGroupContext(ctx context.Context, secGroupGUID, spaceGUID, method, endpoint string) (RuleEstimate, error) {
+	var estimate RuleEstimate
+	var out any
+	if method != http.MethodDelete {
+		out = &estimate
+	}
+	err := c.DoJSON(ctx, method, endpoint+"/v3/bindings", map[string]string{
+		"security_group_guid": secGroupGUID,
+		"space_guid":          spaceGUID,
+	}, out)
+	return estimate, err
+}
 
-	Request.Header.Add("Authorization", c.accessToken)
-	Request.Header.Add("Content-type", "application/json")
-	resp, err := client.Do(Request)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// BindUnbindOrgSecurityGroup bind or unbind a security group to all spaces of an org through cfsecurity server,
+// spaces created later in the org are bound as well, the rules garden writes for each space are given back on bind
+func (c *Client) BindUnbindOrgSecurityGroup(secGroupGUID, orgGUID, method, endpoint string) ([]RuleEstimate, error) {
+	return c.BindUnbindOrgSecurityGroupContext(context.Background(), secGroupGUID, orgGUID, method, endpoint)
+}
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		return err
+// BindUnbindOrgSecurityGroupContext is like BindUnbindOrgSecurityGroup, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BindUnbindOrgSecurityGroupContext(ctx context.Context, secGroupGUID, orgGUID, method, endpoint string) ([]RuleEstimate, error) {
+	var orgBinding struct {
+		RuleEstimates []RuleEstimate `json:"rule_estimates"`
 	}
-
-	return nil
+	var out any
+	if method != http.MethodDelete {
+		out = &orgBinding
+	}
+	err := c.DoJSON(ctx, method, endpoint+"/v3/org_bindings", map[string]string{
+		"security_group_guid": secGroupGUID,
+		"organization_guid":   orgGUID,
+	}, out)
+	return orgBinding.RuleEstimates, err
 }
 
 func (c *Client) BindRunningSecGroupToSpace(secGroupGUID, spaceGUID string, endpoint string) error {
+	return c.BindRunningSecGroupToSpaceContext(context.Background(), secGroupGUID, spaceGUID, endpoint)
+}
+
+// BindRunningSecGroupToSpaceContext is like BindRunningSecGroupToSpace, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BindRunningSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	var jsonData = []byte(`{"data":[
 		{"guid":"` + spaceGUID + `"}
 		]
 	}`)
 
-	client := &http.Client{Transport: &c.transport}
 	url := endpoint + "/v3/security_groups/" + secGroupGUID + "/relationships/running_spaces"
-	Request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
+	Request, err := http.NewRequestWithContext(withIdempotent(ctx), http.MethodPost, url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
 
-	Request.Header.Add("Authorization", c.accessToken)
 	Request.Header.Add("Content-type", "application/json")
-	resp, err := client.Do(Request)
+	resp, err := c.do(Request)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		return err
-	}
-
-	return nil
+	return checkResponse(resp)
 }
 
 func (c *Client) BindStagingSecGroupToSpace(secGroupGUID, spaceGUID string, endpoint string) error {
+	return c.BindStagingSecGroupToSpaceContext(context.Background(), secGroupGUID, spaceGUID, endpoint)
+}
+
+// BindStagingSecGroupToSpaceContext is like BindStagingSecGroupToSpace, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BindStagingSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	var jsonData = []byte(`{"data":[
 		{"guid":"` + spaceGUID + `"}
 		]
 	}`)
 
-	client := &http.Client{Transport: &c.transport}
 	url := endpoint + "/v3/security_groups/" + secGroupGUID + "/relationships/staging_spaces"
-	Request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
+	Request, err := http.NewRequestWithContext(withIdempotent(ctx), http.MethodPost, url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
 
-	Request.Header.Add("Authorization", c.accessToken)
 	Request.Header.Add("Content-type", "application/json")
-	resp, err := client.Do(Request)
+	resp, err := c.do(Request)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		//nolint:bodyclose // handleError closes the body
-		_, err := c.handleError(resp)
-		return err
-	}
-
-	return nil
+	return checkResponse(resp)
 }
 
 func (c *Client) UnBindRunningSecGroupToSpace(secGroupGUID, spaceGUID string, endpoint string) error {
+	return c.UnBindRunningSecGroupToSpaceContext(context.Background(), secGroupGUID, spaceGUID, endpoint)
+}
+
+// UnBindRunningSecGroupToSpaceContext is like UnBindRunningSecGroupToSpace, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) UnBindRunningSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
-	client := &http.Client{Transport: &c.transport}
 	url := endpoint + "/v3/security_groups/" + secGroupGUID + "/relationships/running_spaces/" + spaceGUID
-	Request, err := http.NewRequest(http.MethodDelete, url, nil)
+	Request, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		return err
 	}
 
-	Request.Header.Add("Authorization", c.accessToken)
 	Request.Header.Add("Content-type", "application/json")
-	resp, err := client.Do(Request)
+	resp, err := c.do(Request)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		//nolint:bodyclose // handleError closes the body
-		_, err := c.handleError(resp)
-		return err
-	}
-
-	return nil
+	return checkResponse(resp)
 }
 
 func (c *Client) UnBindStagingSecGroupToSpace(secGroupGUID, spaceGUID string, endpoint string) error {
+	return c.UnBindStagingSecGroupToSpaceContext(context.Background(), secGroupGUID, spaceGUID, endpoint)
+}
+
+// UnBindStagingSecGroupToSpaceContext is like UnBindStagingSecGroupToSpace, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) UnBindStagingSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
-	client := &http.Client{Transport: &c.transport}
 	url := endpoint + "/v3/security_groups/" + secGroupGUID + "/relationships/staging_spaces/" + spaceGUID
-	Request, err := http.NewRequest(http.MethodDelete, url, nil)
+	Request, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		return err
 	}
-	Request.Header.Add("Authorization", c.accessToken)
 	Request.Header.Add("Content-type", "application/json")
-	resp, err := client.Do(Request)
+	resp, err := c.do(Request)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		//nolint:bodyclose // handleError closes the body
-		_, err := c.handleError(resp)
-		return err
-	}
-
-	return nil
+	return checkResponse(resp)
 }
@@ -1,11 +1,13 @@
 package client
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
 	"github.com/prometheus/common/version"
@@ -19,12 +21,28 @@ type Client struct {
 	endpoint    string
 	ccv3Client  *ccv3.Client
 	accessToken string
+	tokenSource TokenSource
 	apiUrl      string
 	transport   CustomTransport
+	timeout     time.Duration
+	retryPolicy RetryPolicy
+	onCall      func(CallEvent)
 }
 
 func NewClient(endpoint string, ccv3Client *ccv3.Client, accessToken string, apiUrl string, transport *http.Transport) *Client {
-	return &Client{endpoint: endpoint, ccv3Client: ccv3Client, accessToken: accessToken, apiUrl: apiUrl, transport: CustomTransport{transport}}
+	return &Client{endpoint: endpoint, ccv3Client: ccv3Client, accessToken: accessToken, apiUrl: apiUrl, transport: CustomTransport{transport}, retryPolicy: DefaultRetryPolicy()}
+}
+
+// SetTimeout set the deadline of each call made by the client, 0 means no deadline other than the one of the call context
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
 }
 
 type CustomTransport struct {
@@ -38,14 +56,17 @@ func (ct *CustomTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 
 func (c *Client) CurrentUserIsAdmin() (bool, error) {
 
-	token := c.accessToken
+	token, err := c.token()
+	if err != nil {
+		return false, err
+	}
 
 	tokenSplit := strings.Split(token, ".")
 	if len(tokenSplit) < 3 {
 		return false, fmt.Errorf("not a jwt")
 	}
 
-	b, err := base64.RawStdEncoding.DecodeString(tokenSplit[1])
+	b, err := base64.RawURLEncoding.DecodeString(tokenSplit[1])
 	if err != nil {
 		return false, err
 	}
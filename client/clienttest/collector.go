@@ -0,0 +1,121 @@
+package clienttest
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// CollectedSpan is a span received by a Collector, ids are hex encoded and attribute values are formatted as strings
+type CollectedSpan struct {
+	Name         string
+	Kind         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Attributes   map[string]string
+	Failed       bool
+	Events       []string
+}
+
+// Collector is an in-process opentelemetry collector receiving spans exported with otlp over http on /v1/traces,
+// it must be closed after use
+type Collector struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	spans []CollectedSpan
+}
+
+// NewCollector start a collector, its URL is the endpoint to give to an otlp http exporter
+func NewCollector() *Collector {
+	c := &Collector{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", c.handleTraces)
+	c.Server = httptest.NewServer(mux)
+	return c
+}
+
+// Spans give the spans received so far in their order of arrival
+func (c *Collector) Spans() []CollectedSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make([]CollectedSpan, len(c.spans))
+	copy(spans, c.spans)
+	return spans
+}
+
+// Reset forget the spans received
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = nil
+}
+
+func (c *Collector) handleTraces(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var export coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, resourceSpans := range export.GetResourceSpans() {
+		for _, scopeSpans := range resourceSpans.GetScopeSpans() {
+			for _, span := range scopeSpans.GetSpans() {
+				c.spans = append(c.spans, collectedSpan(span))
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(resp)
+}
+
+func collectedSpan(span *tracepb.Span) CollectedSpan {
+	collected := CollectedSpan{
+		Name:         span.GetName(),
+		Kind:         span.GetKind().String(),
+		TraceID:      hex.EncodeToString(span.GetTraceId()),
+		SpanID:       hex.EncodeToString(span.GetSpanId()),
+		ParentSpanID: hex.EncodeToString(span.GetParentSpanId()),
+		Attributes:   make(map[string]string),
+		Failed:       span.GetStatus().GetCode() == tracepb.Status_STATUS_CODE_ERROR,
+	}
+	for _, kv := range span.GetAttributes() {
+		collected.Attributes[kv.GetKey()] = formatValue(kv.GetValue())
+	}
+	for _, event := range span.GetEvents() {
+		collected.Events = append(collected.Events, event.GetName())
+	}
+	return collected
+}
+
+func formatValue(value *commonpb.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+	}
+	return value.String()
+}
@@ -0,0 +1,901 @@
+// Package clienttest provides a stateful in-memory implementation of client.API,
+// to exercise code using cloud controller without a cloud foundry
+package clienttest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+	"code.cloudfoundry.org/cli/v8/resources"
+	"github.com/google/uuid"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+)
+
+// Operations of client.API, used to inject errors and count calls
+const (
+	OpListAllSecGroups      = "ListAllSecGroups"
+	OpGetSecGroups          = "GetSecGroups"
+	OpGetSecGroupByName     = "GetSecGroupByName"
+	OpGetSpaceByGuid        = "GetSpaceByGuid"
+	OpGetSpacesWithOrg      = "GetSpacesWithOrg"
+	OpGetSpacesCreatedAfter = "GetSpacesCreatedAfter"
+	OpGetSecGroupSpaces     = "GetSecGroupSpaces"
+	OpGetRoles              = "GetRoles"
+	OpGetOrgManagers        = "GetOrgManagers"
+	OpGetManagedOrgs        = "GetManagedOrgs"
+	OpGetManagedSpaces      = "GetManagedSpaces"
+	OpBindRunningSecGroup   = "BindRunningSecGroupToSpace"
+	OpBindStagingSecGroup   = "BindStagingSecGroupToSpace"
+	OpUnBindRunningSecGroup = "UnBindRunningSecGroupToSpace"
+	OpUnBindStagingSecGroup = "UnBindStagingSecGroupToSpace"
+	OpBindSecurityGroup     = "BindSecurityGroup"
+	OpUnBindSecurityGroup   = "UnBindSecurityGroup"
+	OpIterSecGroups         = "IterSecGroups"
+	OpIterSpacePagesWithOrg = "IterSpacePagesWithOrg"
+	OpCreateSecurityGroup   = "CreateSecurityGroup"
+	OpUpdateSecurityGroup   = "UpdateSecurityGroup"
+	OpDeleteSecurityGroup   = "DeleteSecurityGroup"
+	OpGetOrganization       = "GetOrganization"
+)
+
+const defaultApiUrl = "https://api.fake.cf"
+
+type space struct {
+	client.Space
+	createdAt time.Time
+}
+
+// Fake is an in-memory cloud controller holding orgs, spaces, security groups with their
+// running and staging bindings, and roles. It is safe for concurrent use.
+// Errors can be injected per operation, see InjectError and FailNext.
+type Fake struct {
+	mu        sync.Mutex
+	apiUrl    string
+	orgs      map[string]client.Organization
+	spaces    map[string]*space
+	secGroups []*client.SecurityGroup
+	roles     []client.Role
+	errs      map[string]error
+	nextErrs  map[string][]error
+	calls     map[string]int
+}
+
+var _ client.API = (*Fake)(nil)
+
+// NewFake create an empty fake cloud controller
+func NewFake() *Fake {
+	return &Fake{
+		apiUrl:   defaultApiUrl,
+		orgs:     make(map[string]client.Organization),
+		spaces:   make(map[string]*space),
+		errs:     make(map[string]error),
+		nextErrs: make(map[string][]error),
+		calls:    make(map[string]int),
+	}
+}
+
+// SetApiUrl change the url returned by GetApiUrl
+func (f *Fake) SetApiUrl(apiUrl string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.apiUrl = apiUrl
+}
+
+// AddOrg add an org, a guid is generated when empty
+func (f *Fake) AddOrg(guid, name string) client.Organization {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if guid == "" {
+		guid = uuid.NewString()
+	}
+	org := client.Organization{Organization: resources.Organization{GUID: guid, Name: name}}
+	f.orgs[guid] = org
+	return org
+}
+
+// AddSpace add a space in an org created now, a guid is generated when empty
+func (f *Fake) AddSpace(orgGuid, guid, name string) client.Space {
+	return f.AddSpaceCreatedAt(orgGuid, guid, name, time.Now())
+}
+
+// AddSpaceCreatedAt add a space in an org created at a given time, a guid is generated when empty
+func (f *Fake) AddSpaceCreatedAt(orgGuid, guid, name string, createdAt time.Time) client.Space {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if guid == "" {
+		guid = uuid.NewString()
+	}
+	s := client.Space{Space: resources.Space{
+		GUID: guid,
+		Name: name,
+		Relationships: resources.Relationships{
+			constant.RelationshipTypeOrganization: resources.Relationship{GUID: orgGuid},
+		},
+	}, CreatedAt: createdAt}
+	f.spaces[guid] = &space{Space: s, createdAt: createdAt}
+	return s
+}
+
+// AddSecGroup add a security group, with its bindings and global flags, a guid is generated when empty.
+// A security group with the same guid is replaced.
+func (f *Fake) AddSecGroup(secGroup client.SecurityGroup) client.SecurityGroup {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if secGroup.GUID == "" {
+		secGroup.GUID = uuid.NewString()
+	}
+	for _, lifecycle := range []**bool{&secGroup.RunningGloballyEnabled, &secGroup.StagingGloballyEnabled} {
+		if *lifecycle == nil {
+			*lifecycle = new(bool)
+		}
+	}
+	secGroup = copySecGroup(&secGroup)
+	f.secGroups = slices.DeleteFunc(f.secGroups, func(s *client.SecurityGroup) bool {
+		return s.GUID == secGroup.GUID
+	})
+	f.secGroups = append(f.secGroups, &secGroup)
+	return copySecGroup(&secGroup)
+}
+
+// SetGloballyEnabled enable or disable a security group for all spaces on a lifecycle, running or staging
+func (f *Fake) SetGloballyEnabled(secGroupGuid, lifecycle string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secGroup := f.secGroup(secGroupGuid)
+	if secGroup == nil {
+		return notFound("Security group")
+	}
+	switch lifecycle {
+	case client.LifecycleRunning:
+		secGroup.RunningGloballyEnabled = &enabled
+	case client.LifecycleStaging:
+		secGroup.StagingGloballyEnabled = &enabled
+	default:
+		return fmt.Errorf("unknown lifecycle %s", lifecycle)
+	}
+	return nil
+}
+
+// AddRole give a role to a user on an org or a space, spaceGuid is empty for org roles
+func (f *Fake) AddRole(roleType constant.RoleType, userGuid, orgGuid, spaceGuid string) client.Role {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var role client.Role
+	role.GUID = uuid.NewString()
+	role.Type = string(roleType)
+	role.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	role.UpdatedAt = role.CreatedAt
+	role.Relationships.User.Data.GUID = userGuid
+	role.Relationships.Organization.Data.GUID = orgGuid
+	role.Relationships.Space.Data.GUID = spaceGuid
+	f.roles = append(f.roles, role)
+	return role
+}
+
+// InjectError make all calls to an operation fail with err until it is cleared with a nil err
+func (f *Fake) InjectError(op string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		delete(f.errs, op)
+		return
+	}
+	f.errs[op] = err
+}
+
+// FailNext make the next call to an operation fail with err, errors are queued
+func (f *Fake) FailNext(op string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextErrs[op] = append(f.nextErrs[op], err)
+}
+
+// ClearErrors remove all injected errors
+func (f *Fake) ClearErrors() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = make(map[string]error)
+	f.nextErrs = make(map[string][]error)
+}
+
+// Calls give the number of calls made to an operation
+func (f *Fake) Calls(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// SecGroup give the current state of a security group
+func (f *Fake) SecGroup(guid string) (client.SecurityGroup, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secGroup := f.secGroup(guid)
+	if secGroup == nil {
+		return client.SecurityGroup{}, false
+	}
+	return copySecGroup(secGroup), true
+}
+
+// IsBound tell if a security group is bound to a space on a lifecycle, running or staging
+func (f *Fake) IsBound(secGroupGuid, spaceGuid, lifecycle string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secGroup := f.secGroup(secGroupGuid)
+	if secGroup == nil {
+		return false
+	}
+	return slices.ContainsFunc(*bindings(secGroup, lifecycle), func(data client.Data) bool {
+		return data.GUID == spaceGuid
+	})
+}
+
+func (f *Fake) GetApiUrl() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.apiUrl
+}
+
+// ListAllSecGroupsContext answer like cloud controller to a list of security groups,
+// names and guids filters of the request are applied and all resources are given in one page
+func (f *Fake) ListAllSecGroupsContext(ctx context.Context, req *http.Request) ([]byte, error) {
+	if err := f.begin(ctx, OpListAllSecGroups); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queries := make([]ccv3.Query, 0)
+	for key, values := range req.URL.Query() {
+		queries = append(queries, ccv3.Query{Key: ccv3.QueryKey(key), Values: values})
+	}
+	secGroups := f.findSecGroups(queries)
+	page := ccSecGroupsPage{Resources: make([]ccSecGroup, 0, len(secGroups))}
+	page.Pagination.TotalResults = len(secGroups)
+	page.Pagination.TotalPages = 1
+	for _, secGroup := range secGroups {
+		page.Resources = append(page.Resources, toCCSecGroup(secGroup))
+	}
+	return json.Marshal(page)
+}
+
+// GetSecGroupsContext list security groups matching names, guids, globally enabled
+// and running or staging space guids filters
+func (f *Fake) GetSecGroupsContext(ctx context.Context, queries []ccv3.Query, _ int) (client.SecurityGroups, error) {
+	if err := f.begin(ctx, OpGetSecGroups); err != nil {
+		return client.SecurityGroups{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return client.SecurityGroups{Resources: f.findSecGroups(queries)}, nil
+}
+
+func (f *Fake) IterSecGroups(ctx context.Context, queries []ccv3.Query) iter.Seq2[client.SecurityGroup, error] {
+	return func(yield func(client.SecurityGroup, error) bool) {
+		if err := f.begin(ctx, OpIterSecGroups); err != nil {
+			yield(client.SecurityGroup{}, err)
+			return
+		}
+		f.mu.Lock()
+		secGroups := f.findSecGroups(queries)
+		f.mu.Unlock()
+		for _, secGroup := range secGroups {
+			if !yield(secGroup, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (f *Fake) GetSecGroupByNameContext(ctx context.Context, name string) (client.SecurityGroup, error) {
+	if err := f.begin(ctx, OpGetSecGroupByName); err != nil {
+		return client.SecurityGroup{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secGroups := f.findSecGroups([]ccv3.Query{{Key: ccv3.NameFilter, Values: []string{name}}})
+	if len(secGroups) == 0 {
+		return client.SecurityGroup{}, fmt.Errorf("security group %s %w", name, client.ErrNotFound)
+	}
+	return secGroups[0], nil
+}
+
+// CreateSecurityGroupContext add a security group which is not bound, names are unique as on cloud controller
+func (f *Fake) CreateSecurityGroupContext(ctx context.Context, params client.SecurityGroupParams) (client.SecurityGroup, error) {
+	if err := f.begin(ctx, OpCreateSecurityGroup); err != nil {
+		return client.SecurityGroup{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkSecGroupName("", params.Name); err != nil {
+		return client.SecurityGroup{}, err
+	}
+	secGroup := &client.SecurityGroup{
+		GUID:                   uuid.NewString(),
+		Name:                   params.Name,
+		RunningGloballyEnabled: new(bool),
+		StagingGloballyEnabled: new(bool),
+	}
+	if params.Rules != nil {
+		secGroup.Rules = slices.Clone(*params.Rules)
+	}
+	setGloballyEnabled(secGroup, params.GloballyEnabled)
+	f.secGroups = append(f.secGroups, secGroup)
+	return copySecGroup(secGroup), nil
+}
+
+// UpdateSecurityGroupContext replace name, rules and global enablement of a security group when they are set
+func (f *Fake) UpdateSecurityGroupContext(ctx context.Context, guid string, params client.SecurityGroupParams) (client.SecurityGroup, error) {
+	if err := f.begin(ctx, OpUpdateSecurityGroup); err != nil {
+		return client.SecurityGroup{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secGroup := f.secGroup(guid)
+	if secGroup == nil {
+		return client.SecurityGroup{}, notFound("Security group")
+	}
+	if params.Name != "" {
+		if err := f.checkSecGroupName(guid, params.Name); err != nil {
+			return client.SecurityGroup{}, err
+		}
+		secGroup.Name = params.Name
+	}
+	if params.Rules != nil {
+		secGroup.Rules = slices.Clone(*params.Rules)
+	}
+	setGloballyEnabled(secGroup, params.GloballyEnabled)
+	return copySecGroup(secGroup), nil
+}
+
+// DeleteSecurityGroupContext remove a security group with its bindings
+func (f *Fake) DeleteSecurityGroupContext(ctx context.Context, guid string) error {
+	if err := f.begin(ctx, OpDeleteSecurityGroup); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.secGroup(guid) == nil {
+		return notFound("Security group")
+	}
+	f.secGroups = slices.DeleteFunc(f.secGroups, func(s *client.SecurityGroup) bool {
+		return s.GUID == guid
+	})
+	return nil
+}
+
+func (f *Fake) GetOrganizationContext(ctx context.Context, guid string) (client.Organization, error) {
+	if err := f.begin(ctx, OpGetOrganization); err != nil {
+		return client.Organization{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	org, ok := f.orgs[guid]
+	if !ok {
+		return client.Organization{}, fmt.Errorf("organization %s: %w", guid, notFound("Organization"))
+	}
+	return org, nil
+}
+
+func (f *Fake) GetSpaceByGuidContext(ctx context.Context, guid string) (client.Space, error) {
+	if err := f.begin(ctx, OpGetSpaceByGuid); err != nil {
+		return client.Space{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.spaces[guid]
+	if !ok {
+		return client.Space{}, fmt.Errorf("space %s %w", guid, client.ErrNotFound)
+	}
+	return s.Space, nil
+}
+
+// GetSpacesWithOrgContext list spaces matching guids, names, organization guids and created_ats[gte] filters,
+// orgs of spaces are always included
+func (f *Fake) GetSpacesWithOrgContext(ctx context.Context, queries []ccv3.Query, _ int) (client.Spaces, error) {
+	if err := f.begin(ctx, OpGetSpacesWithOrg); err != nil {
+		return client.Spaces{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.findSpaces(queries)
+}
+
+// IterSpacePagesWithOrg give all spaces matching queries in a single page
+func (f *Fake) IterSpacePagesWithOrg(ctx context.Context, queries []ccv3.Query) iter.Seq2[client.Page[client.Space], error] {
+	return func(yield func(client.Page[client.Space], error) bool) {
+		if err := f.begin(ctx, OpIterSpacePagesWithOrg); err != nil {
+			yield(client.Page[client.Space]{}, err)
+			return
+		}
+		f.mu.Lock()
+		spaces, err := f.findSpaces(queries)
+		f.mu.Unlock()
+		if err != nil {
+			yield(client.Page[client.Space]{}, err)
+			return
+		}
+		yield(client.Page[client.Space]{Resources: spaces.Resources, Included: spaces.Included}, nil)
+	}
+}
+
+func (f *Fake) GetSpacesCreatedAfterContext(ctx context.Context, orgGuids []string, after time.Time) (client.Spaces, error) {
+	if err := f.begin(ctx, OpGetSpacesCreatedAfter); err != nil {
+		return client.Spaces{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.findSpaces([]ccv3.Query{
+		{Key: ccv3.OrganizationGUIDFilter, Values: orgGuids},
+		{Key: client.CreatedAtsAfterFilter, Values: []string{after.UTC().Format(time.RFC3339)}},
+	})
+}
+
+func (f *Fake) GetSecGroupSpacesContext(ctx context.Context, secGroup *client.SecurityGroup) (client.Spaces, error) {
+	if err := f.begin(ctx, OpGetSecGroupSpaces); err != nil {
+		return client.Spaces{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	spaceGuids := make([]string, 0)
+	for _, data := range secGroup.Relationships.Running_Spaces.Data {
+		spaceGuids = append(spaceGuids, data.GUID)
+	}
+	for _, data := range secGroup.Relationships.Staging_Spaces.Data {
+		spaceGuids = append(spaceGuids, data.GUID)
+	}
+	if len(spaceGuids) == 0 {
+		return client.Spaces{}, nil
+	}
+	return f.findSpaces([]ccv3.Query{{Key: ccv3.GUIDFilter, Values: spaceGuids}})
+}
+
+func (f *Fake) GetRolesContext(ctx context.Context, filter client.RolesFilter) (client.User, error) {
+	if err := f.begin(ctx, OpGetRoles); err != nil {
+		return client.User{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return client.User{Resources: f.findRoles(filter)}, nil
+}
+
+func (f *Fake) GetOrgManagersContext(ctx context.Context, orgGuid string, _ int) (client.User, error) {
+	if err := f.begin(ctx, OpGetOrgManagers); err != nil {
+		return client.User{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return client.User{Resources: f.findRoles(client.RolesFilter{
+		Types:             []constant.RoleType{constant.OrgManagerRole},
+		OrganizationGUIDs: []string{orgGuid},
+	})}, nil
+}
+
+func (f *Fake) GetManagedOrgsContext(ctx context.Context, userGuid string, orgGuids []string) (map[string]bool, error) {
+	if err := f.begin(ctx, OpGetManagedOrgs); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	managed := make(map[string]bool)
+	for _, orgGuid := range orgGuids {
+		managed[orgGuid] = false
+	}
+	if len(orgGuids) == 0 {
+		return managed, nil
+	}
+	for _, role := range f.findRoles(client.RolesFilter{
+		Types:             []constant.RoleType{constant.OrgManagerRole},
+		UserGUIDs:         []string{userGuid},
+		OrganizationGUIDs: orgGuids,
+	}) {
+		managed[role.Relationships.Organization.Data.GUID] = true
+	}
+	return managed, nil
+}
+
+func (f *Fake) GetManagedSpacesContext(ctx context.Context, userGuid string, spaceGuids []string) (map[string]bool, error) {
+	if err := f.begin(ctx, OpGetManagedSpaces); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	managed := make(map[string]bool)
+	for _, spaceGuid := range spaceGuids {
+		managed[spaceGuid] = false
+	}
+	if len(spaceGuids) == 0 {
+		return managed, nil
+	}
+	for _, role := range f.findRoles(client.RolesFilter{
+		Types:      []constant.RoleType{constant.SpaceManagerRole},
+		UserGUIDs:  []string{userGuid},
+		SpaceGUIDs: spaceGuids,
+	}) {
+		managed[role.Relationships.Space.Data.GUID] = true
+	}
+	return managed, nil
+}
+
+func (f *Fake) BindSecurityGroupContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	if err := f.begin(ctx, OpBindSecurityGroup); err != nil {
+		return err
+	}
+	if err := f.BindRunningSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint); err != nil {
+		return err
+	}
+	return f.BindStagingSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint)
+}
+
+func (f *Fake) UnBindSecurityGroupContext(ctx context.Context, secGroupGUID, spaceGUID string, endpoint string) error {
+	if err := f.begin(ctx, OpUnBindSecurityGroup); err != nil {
+		return err
+	}
+	if err := f.UnBindRunningSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint); err != nil {
+		return err
+	}
+	return f.UnBindStagingSecGroupToSpaceContext(ctx, secGroupGUID, spaceGUID, endpoint)
+}
+
+func (f *Fake) BindRunningSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, _ string) error {
+	return f.bind(ctx, OpBindRunningSecGroup, secGroupGUID, spaceGUID, client.LifecycleRunning)
+}
+
+func (f *Fake) BindStagingSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, _ string) error {
+	return f.bind(ctx, OpBindStagingSecGroup, secGroupGUID, spaceGUID, client.LifecycleStaging)
+}
+
+func (f *Fake) UnBindRunningSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, _ string) error {
+	return f.unbind(ctx, OpUnBindRunningSecGroup, secGroupGUID, spaceGUID, client.LifecycleRunning)
+}
+
+func (f *Fake) UnBindStagingSecGroupToSpaceContext(ctx context.Context, secGroupGUID, spaceGUID string, _ string) error {
+	return f.unbind(ctx, OpUnBindStagingSecGroup, secGroupGUID, spaceGUID, client.LifecycleStaging)
+}
+
+// bind add a space to the running or staging spaces of a security group, binding twice is not an error as in cloud controller
+func (f *Fake) bind(ctx context.Context, op, secGroupGuid, spaceGuid, lifecycle string) error {
+	if err := f.begin(ctx, op); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bindSpaces(secGroupGuid, []string{spaceGuid}, lifecycle)
+}
+
+// unbind remove a space from the running or staging spaces of a security group,
+// it fails with an unprocessable entity error when the space is not bound as in cloud controller
+func (f *Fake) unbind(ctx context.Context, op, secGroupGuid, spaceGuid, lifecycle string) error {
+	if err := f.begin(ctx, op); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.unbindSpace(secGroupGuid, spaceGuid, lifecycle)
+}
+
+// bindSpaces bind spaces to a security group on a lifecycle, none is bound when one of the spaces doesn't exist
+func (f *Fake) bindSpaces(secGroupGuid string, spaceGuids []string, lifecycle string) error {
+	secGroup := f.secGroup(secGroupGuid)
+	if secGroup == nil {
+		return notFound("Security group")
+	}
+	missing := make([]string, 0)
+	for _, spaceGuid := range spaceGuids {
+		if _, ok := f.spaces[spaceGuid]; !ok {
+			missing = append(missing, fmt.Sprintf("%q", spaceGuid))
+		}
+	}
+	if len(missing) > 0 {
+		return unprocessable(fmt.Sprintf("Spaces with guids [%s] do not exist, or you do not have access to them.", strings.Join(missing, ", ")))
+	}
+	data := bindings(secGroup, lifecycle)
+	for _, spaceGuid := range spaceGuids {
+		if !slices.ContainsFunc(*data, func(d client.Data) bool { return d.GUID == spaceGuid }) {
+			*data = append(*data, client.Data{GUID: spaceGuid})
+		}
+	}
+	return nil
+}
+
+func (f *Fake) unbindSpace(secGroupGuid, spaceGuid, lifecycle string) error {
+	secGroup := f.secGroup(secGroupGuid)
+	if secGroup == nil {
+		return notFound("Security group")
+	}
+	data := bindings(secGroup, lifecycle)
+	i := slices.IndexFunc(*data, func(d client.Data) bool { return d.GUID == spaceGuid })
+	if i < 0 {
+		return unprocessable(fmt.Sprintf("Unable to unbind security group from space with guid '%s'. Ensure the space is bound to this security group.", spaceGuid))
+	}
+	*data = slices.Delete(*data, i, i+1)
+	return nil
+}
+
+// begin count a call and give the injected error for the operation if any, callers lock f.mu themselves to read the state
+func (f *Fake) begin(ctx context.Context, op string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[op]++
+	if queued := f.nextErrs[op]; len(queued) > 0 {
+		f.nextErrs[op] = queued[1:]
+		return queued[0]
+	}
+	return f.errs[op]
+}
+
+func (f *Fake) secGroup(guid string) *client.SecurityGroup {
+	for _, secGroup := range f.secGroups {
+		if secGroup.GUID == guid {
+			return secGroup
+		}
+	}
+	return nil
+}
+
+func setGloballyEnabled(secGroup *client.SecurityGroup, globallyEnabled *client.GloballyEnabled) {
+	if globallyEnabled == nil {
+		return
+	}
+	if globallyEnabled.Running != nil {
+		running := *globallyEnabled.Running
+		secGroup.RunningGloballyEnabled = &running
+	}
+	if globallyEnabled.Staging != nil {
+		staging := *globallyEnabled.Staging
+		secGroup.StagingGloballyEnabled = &staging
+	}
+}
+
+// checkSecGroupName refuse a name already used by another security group than guid
+func (f *Fake) checkSecGroupName(guid, name string) error {
+	if name == "" {
+		return unprocessable("Name can't be blank")
+	}
+	for _, secGroup := range f.secGroups {
+		if secGroup.Name == name && secGroup.GUID != guid {
+			return unprocessable(fmt.Sprintf("Security group with name '%s' already exists.", name))
+		}
+	}
+	return nil
+}
+
+func (f *Fake) findSecGroups(queries []ccv3.Query) []client.SecurityGroup {
+	secGroups := make([]client.SecurityGroup, 0)
+	for _, secGroup := range f.secGroups {
+		if matchSecGroup(secGroup, queries) {
+			secGroups = append(secGroups, copySecGroup(secGroup))
+		}
+	}
+	return secGroups
+}
+
+func matchSecGroup(secGroup *client.SecurityGroup, queries []ccv3.Query) bool {
+	for _, query := range queries {
+		values := splitValues(query.Values)
+		var ok bool
+		switch query.Key {
+		case ccv3.NameFilter:
+			ok = slices.Contains(values, secGroup.Name)
+		case ccv3.GUIDFilter:
+			ok = slices.Contains(values, secGroup.GUID)
+		case ccv3.GloballyEnabledRunning:
+			ok = slices.Contains(values, fmt.Sprint(*secGroup.RunningGloballyEnabled))
+		case ccv3.GloballyEnabledStaging:
+			ok = slices.Contains(values, fmt.Sprint(*secGroup.StagingGloballyEnabled))
+		case client.RunningSpaceGUIDsFilter:
+			ok = boundToAny(secGroup.Relationships.Running_Spaces.Data, values)
+		case client.StagingSpaceGUIDsFilter:
+			ok = boundToAny(secGroup.Relationships.Staging_Spaces.Data, values)
+		default:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Fake) findSpaces(queries []ccv3.Query) (client.Spaces, error) {
+	spaces := client.Spaces{Resources: make([]client.Space, 0)}
+	includedOrgs := make(map[string]bool)
+	guids := make([]string, 0, len(f.spaces))
+	for guid := range f.spaces {
+		guids = append(guids, guid)
+	}
+	slices.Sort(guids)
+	for _, guid := range guids {
+		s := f.spaces[guid]
+		ok, err := matchSpace(s, queries)
+		if err != nil {
+			return spaces, err
+		}
+		if !ok {
+			continue
+		}
+		spaces.Resources = append(spaces.Resources, s.Space)
+		orgGuid := s.Relationships[constant.RelationshipTypeOrganization].GUID
+		if org, ok := f.orgs[orgGuid]; ok && !includedOrgs[orgGuid] {
+			includedOrgs[orgGuid] = true
+			spaces.Included.Organizations = append(spaces.Included.Organizations, org.Organization)
+		}
+	}
+	return spaces, nil
+}
+
+func matchSpace(s *space, queries []ccv3.Query) (bool, error) {
+	for _, query := range queries {
+		values := splitValues(query.Values)
+		switch query.Key {
+		case ccv3.GUIDFilter:
+			if !slices.Contains(values, s.GUID) {
+				return false, nil
+			}
+		case ccv3.NameFilter:
+			if !slices.Contains(values, s.Name) {
+				return false, nil
+			}
+		case ccv3.OrganizationGUIDFilter:
+			if !slices.Contains(values, s.Relationships[constant.RelationshipTypeOrganization].GUID) {
+				return false, nil
+			}
+		case client.CreatedAtsAfterFilter:
+			for _, value := range values {
+				after, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return false, badQueryParameter("Created ats has an invalid timestamp format")
+				}
+				if s.createdAt.Before(after) {
+					return false, nil
+				}
+			}
+		}
+	}
+	return true, nil
+}
+
+func (f *Fake) findRoles(filter client.RolesFilter) []client.Role {
+	roles := make([]client.Role, 0)
+	for _, role := range f.roles {
+		if len(filter.Types) > 0 && !slices.Contains(filter.Types, constant.RoleType(role.Type)) {
+			continue
+		}
+		if len(filter.UserGUIDs) > 0 && !slices.Contains(filter.UserGUIDs, role.Relationships.User.Data.GUID) {
+			continue
+		}
+		if len(filter.OrganizationGUIDs) > 0 && !slices.Contains(filter.OrganizationGUIDs, role.Relationships.Organization.Data.GUID) {
+			continue
+		}
+		if len(filter.SpaceGUIDs) > 0 && !slices.Contains(filter.SpaceGUIDs, role.Relationships.Space.Data.GUID) {
+			continue
+		}
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+func bindings(secGroup *client.SecurityGroup, lifecycle string) *[]client.Data {
+	if lifecycle == client.LifecycleStaging {
+		return &secGroup.Relationships.Staging_Spaces.Data
+	}
+	return &secGroup.Relationships.Running_Spaces.Data
+}
+
+func boundToAny(data []client.Data, spaceGuids []string) bool {
+	return slices.ContainsFunc(data, func(d client.Data) bool {
+		return slices.Contains(spaceGuids, d.GUID)
+	})
+}
+
+// splitValues give filter values, a value can hold a comma separated list as in cloud controller urls
+func splitValues(values []string) []string {
+	split := make([]string, 0, len(values))
+	for _, value := range values {
+		split = append(split, strings.Split(value, ",")...)
+	}
+	return split
+}
+
+// copySecGroup deep copy a security group so that callers can't change the fake state
+func copySecGroup(secGroup *client.SecurityGroup) client.SecurityGroup {
+	c := *secGroup
+	c.Rules = slices.Clone(secGroup.Rules)
+	c.Relationships.Running_Spaces.Data = slices.Clone(secGroup.Relationships.Running_Spaces.Data)
+	c.Relationships.Staging_Spaces.Data = slices.Clone(secGroup.Relationships.Staging_Spaces.Data)
+	if secGroup.RunningGloballyEnabled != nil {
+		running := *secGroup.RunningGloballyEnabled
+		c.RunningGloballyEnabled = &running
+	}
+	if secGroup.StagingGloballyEnabled != nil {
+		staging := *secGroup.StagingGloballyEnabled
+		c.StagingGloballyEnabled = &staging
+	}
+	return c
+}
+
+func notFound(resource string) error {
+	return client.CloudFoundryHTTPError{
+		StatusCode: http.StatusNotFound,
+		Status:     http.StatusText(http.StatusNotFound),
+		Code:       10010,
+		Title:      "CF-ResourceNotFound",
+		Detail:     resource + " not found",
+	}
+}
+
+func unprocessable(detail string) error {
+	return client.CloudFoundryHTTPError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Status:     http.StatusText(http.StatusUnprocessableEntity),
+		Code:       10008,
+		Title:      "CF-UnprocessableEntity",
+		Detail:     detail,
+	}
+}
+
+type ccRelationship struct {
+	Data []ccGuid `json:"data"`
+}
+
+type ccGuid struct {
+	GUID string `json:"guid"`
+}
+
+// ccSecGroup is a security group as rendered by cloud controller
+type ccSecGroup struct {
+	GUID            string        `json:"guid"`
+	Name            string        `json:"name"`
+	Rules           []client.Rule `json:"rules"`
+	GloballyEnabled struct {
+		Running bool `json:"running"`
+		Staging bool `json:"staging"`
+	} `json:"globally_enabled"`
+	Relationships struct {
+		RunningSpaces ccRelationship `json:"running_spaces"`
+		StagingSpaces ccRelationship `json:"staging_spaces"`
+	} `json:"relationships"`
+}
+
+type ccSecGroupsPage struct {
+	Pagination struct {
+		TotalResults int       `json:"total_results"`
+		TotalPages   int       `json:"total_pages"`
+		Next         *struct{} `json:"next"`
+		Previous     *struct{} `json:"previous"`
+	} `json:"pagination"`
+	Resources []ccSecGroup `json:"resources"`
+}
+
+func toCCSecGroup(secGroup client.SecurityGroup) ccSecGroup {
+	cc := ccSecGroup{
+		GUID:  secGroup.GUID,
+		Name:  secGroup.Name,
+		Rules: secGroup.Rules,
+	}
+	if cc.Rules == nil {
+		cc.Rules = make([]client.Rule, 0)
+	}
+	cc.GloballyEnabled.Running = secGroup.RunningGloballyEnabled != nil && *secGroup.RunningGloballyEnabled
+	cc.GloballyEnabled.Staging = secGroup.StagingGloballyEnabled != nil && *secGroup.StagingGloballyEnabled
+	cc.Relationships.RunningSpaces.Data = make([]ccGuid, 0)
+	for _, data := range secGroup.Relationships.Running_Spaces.Data {
+		cc.Relationships.RunningSpaces.Data = append(cc.Relationships.RunningSpaces.Data, ccGuid{GUID: data.GUID})
+	}
+	cc.Relationships.StagingSpaces.Data = make([]ccGuid, 0)
+	for _, data := range secGroup.Relationships.Staging_Spaces.Data {
+		cc.Relationships.StagingSpaces.Data = append(cc.Relationships.StagingSpaces.Data, ccGuid{GUID: data.GUID})
+	}
+	return cc
+}
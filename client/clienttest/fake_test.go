@@ -0,0 +1,235 @@
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+)
+
+func boundGuids(data []client.Data) []string {
+	guids := make([]string, 0, len(data))
+	for _, d := range data {
+		guids = append(guids, d.GUID)
+	}
+	return guids
+}
+
+func TestFakeBindUnbind(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	org := f.AddOrg("", "org")
+	space := f.AddSpace(org.GUID, "", "space")
+	secGroup := f.AddSecGroup(client.SecurityGroup{Name: "sg"})
+
+	if err := f.BindSecurityGroupContext(ctx, secGroup.GUID, space.GUID, ""); err != nil {
+		t.Fatalf("bind: %s", err)
+	}
+	for _, lifecycle := range []string{client.LifecycleRunning, client.LifecycleStaging} {
+		if !f.IsBound(secGroup.GUID, space.GUID, lifecycle) {
+			t.Errorf("expected security group bound on %s", lifecycle)
+		}
+	}
+	// binding twice is not an error and doesn't duplicate the relationship
+	if err := f.BindRunningSecGroupToSpaceContext(ctx, secGroup.GUID, space.GUID, ""); err != nil {
+		t.Fatalf("bind again: %s", err)
+	}
+	current, _ := f.SecGroup(secGroup.GUID)
+	if got := boundGuids(current.Relationships.Running_Spaces.Data); len(got) != 1 || got[0] != space.GUID {
+		t.Errorf("running spaces = %v, want [%s]", got, space.GUID)
+	}
+	if got := boundGuids(current.Relationships.Staging_Spaces.Data); len(got) != 1 || got[0] != space.GUID {
+		t.Errorf("staging spaces = %v, want [%s]", got, space.GUID)
+	}
+
+	if err := f.UnBindRunningSecGroupToSpaceContext(ctx, secGroup.GUID, space.GUID, ""); err != nil {
+		t.Fatalf("unbind running: %s", err)
+	}
+	if f.IsBound(secGroup.GUID, space.GUID, client.LifecycleRunning) {
+		t.Error("expected security group unbound on running")
+	}
+	if !f.IsBound(secGroup.GUID, space.GUID, client.LifecycleStaging) {
+		t.Error("expected security group still bound on staging")
+	}
+	current, _ = f.SecGroup(secGroup.GUID)
+	if got := boundGuids(current.Relationships.Running_Spaces.Data); len(got) != 0 {
+		t.Errorf("running spaces = %v, want none", got)
+	}
+
+	err := f.UnBindRunningSecGroupToSpaceContext(ctx, secGroup.GUID, space.GUID, "")
+	if !errors.Is(err, client.ErrUnprocessable) {
+		t.Errorf("unbinding a space not bound: got %v, want unprocessable", err)
+	}
+	err = f.BindStagingSecGroupToSpaceContext(ctx, secGroup.GUID, "unknown", "")
+	if !errors.Is(err, client.ErrUnprocessable) {
+		t.Errorf("binding an unknown space: got %v, want unprocessable", err)
+	}
+	err = f.BindRunningSecGroupToSpaceContext(ctx, "unknown", space.GUID, "")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("binding an unknown security group: got %v, want not found", err)
+	}
+	if f.IsBound("unknown", space.GUID, client.LifecycleRunning) {
+		t.Error("an unknown security group can't be bound")
+	}
+}
+
+func TestFakeInjectError(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	org := f.AddOrg("", "org")
+	space := f.AddSpace(org.GUID, "", "space")
+	injected := errors.New("cloud controller is down")
+
+	f.InjectError(OpGetSpaceByGuid, injected)
+	for i := 0; i < 2; i++ {
+		if _, err := f.GetSpaceByGuidContext(ctx, space.GUID); !errors.Is(err, injected) {
+			t.Errorf("call %d: got %v, want injected error", i+1, err)
+		}
+	}
+	f.InjectError(OpGetSpaceByGuid, nil)
+	if _, err := f.GetSpaceByGuidContext(ctx, space.GUID); err != nil {
+		t.Errorf("after clearing the error: %s", err)
+	}
+	if got := f.Calls(OpGetSpaceByGuid); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestFakeFailNext(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	org := f.AddOrg("", "org")
+	space := f.AddSpace(org.GUID, "", "space")
+	secGroup := f.AddSecGroup(client.SecurityGroup{Name: "sg"})
+	first, second := errors.New("first"), errors.New("second")
+
+	f.FailNext(OpBindRunningSecGroup, first)
+	f.FailNext(OpBindRunningSecGroup, second)
+	for _, want := range []error{first, second, nil} {
+		err := f.BindRunningSecGroupToSpaceContext(ctx, secGroup.GUID, space.GUID, "")
+		if !errors.Is(err, want) {
+			t.Errorf("got %v, want %v", err, want)
+		}
+	}
+	if !f.IsBound(secGroup.GUID, space.GUID, client.LifecycleRunning) {
+		t.Error("expected security group bound once queued errors are consumed")
+	}
+	// a failing bind of both lifecycles stops before staging
+	other := f.AddSpace(org.GUID, "", "other")
+	f.FailNext(OpBindRunningSecGroup, first)
+	if err := f.BindSecurityGroupContext(ctx, secGroup.GUID, other.GUID, ""); !errors.Is(err, first) {
+		t.Errorf("got %v, want first", err)
+	}
+	if f.IsBound(secGroup.GUID, other.GUID, client.LifecycleStaging) {
+		t.Error("staging must not be bound when running failed")
+	}
+}
+
+func TestFakeCanceledContext(t *testing.T) {
+	f := NewFake()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.GetSpaceByGuidContext(ctx, "guid"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context canceled", err)
+	}
+}
+
+func TestBuildEffectiveSecGroupsWith(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	org := f.AddOrg("", "org")
+	space := f.AddSpace(org.GUID, "", "space")
+	enabled := true
+	global := f.AddSecGroup(client.SecurityGroup{
+		Name:                   "dns",
+		Rules:                  []client.Rule{{Protocol: "udp", Destination: "10.0.0.53", Ports: "53"}},
+		RunningGloballyEnabled: &enabled,
+		StagingGloballyEnabled: &enabled,
+	})
+	bound := f.AddSecGroup(client.SecurityGroup{
+		Name: "db",
+		Rules: []client.Rule{
+			{Protocol: "tcp", Destination: "10.0.1.10", Ports: "5432"},
+			{Protocol: "udp", Destination: "10.0.0.53", Ports: "53"},
+		},
+	})
+	f.AddSecGroup(client.SecurityGroup{Name: "unused", Rules: []client.Rule{{Protocol: "all", Destination: "0.0.0.0/0"}}})
+	if err := f.BindRunningSecGroupToSpaceContext(ctx, bound.GUID, space.GUID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	effective, err := client.BuildEffectiveSecGroupsWith(ctx, f, space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if effective.OrganizationGUID != org.GUID {
+		t.Errorf("organization = %s, want %s", effective.OrganizationGUID, org.GUID)
+	}
+	wantSecGroups := []client.EffectiveSecurityGroup{
+		{GUID: global.GUID, Name: "dns", Lifecycle: client.LifecycleRunning, Source: client.SourceGlobal},
+		{GUID: global.GUID, Name: "dns", Lifecycle: client.LifecycleStaging, Source: client.SourceGlobal},
+		{GUID: bound.GUID, Name: "db", Lifecycle: client.LifecycleRunning, Source: client.SourceSpace},
+	}
+	if len(effective.SecurityGroups) != len(wantSecGroups) {
+		t.Fatalf("security groups = %+v, want %+v", effective.SecurityGroups, wantSecGroups)
+	}
+	for i, want := range wantSecGroups {
+		if effective.SecurityGroups[i] != want {
+			t.Errorf("security group %d = %+v, want %+v", i, effective.SecurityGroups[i], want)
+		}
+	}
+	if len(effective.Rules) != 2 {
+		t.Fatalf("rules = %+v, want 2 merged rules", effective.Rules)
+	}
+	dns := effective.Rules[0]
+	if dns.Destination != "10.0.0.53" || len(dns.Lifecycles) != 2 || len(dns.SecurityGroups) != 2 {
+		t.Errorf("dns rule = %+v, want both lifecycles and both security groups", dns)
+	}
+	db := effective.Rules[1]
+	if db.Destination != "10.0.1.10" || len(db.Lifecycles) != 1 || db.Lifecycles[0] != client.LifecycleRunning {
+		t.Errorf("db rule = %+v, want running only", db)
+	}
+
+	f.InjectError(OpGetSecGroups, errors.New("boom"))
+	if _, err := client.BuildEffectiveSecGroupsWith(ctx, f, space); err == nil {
+		t.Error("expected the error of the api")
+	}
+}
+
+func TestBuildEgressCheckWith(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	org := f.AddOrg("", "org")
+	space := f.AddSpace(org.GUID, "", "space")
+	bound := f.AddSecGroup(client.SecurityGroup{Name: "db", Rules: []client.Rule{{Protocol: "tcp", Destination: "10.0.1.0/24", Ports: "5432"}}})
+	other := f.AddSecGroup(client.SecurityGroup{Name: "db-staging", Rules: []client.Rule{{Protocol: "tcp", Destination: "10.0.1.10", Ports: "5000-6000"}}})
+	f.AddSecGroup(client.SecurityGroup{Name: "web", Rules: []client.Rule{{Protocol: "tcp", Destination: "10.0.2.0/24", Ports: "443"}}})
+	if err := f.BindRunningSecGroupToSpaceContext(ctx, bound.GUID, space.GUID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := client.BuildEgressCheckWith(ctx, f, space, net.ParseIP("10.0.1.10"), 5432, client.ProtocolTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Allowed(client.LifecycleRunning) {
+		t.Error("expected running allowed by the bound security group")
+	}
+	if check.Allowed(client.LifecycleStaging) {
+		t.Error("expected staging denied")
+	}
+	if len(check.BindableSecurityGroups) != 2 || check.BindableSecurityGroups[0].SecurityGroupGUID != bound.GUID ||
+		check.BindableSecurityGroups[1].SecurityGroupGUID != other.GUID {
+		t.Errorf("bindable security groups = %+v, want db and db-staging", check.BindableSecurityGroups)
+	}
+
+	check, err = client.BuildEgressCheckWith(ctx, f, space, net.ParseIP("10.0.1.10"), 22, client.ProtocolTCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Allowed(client.LifecycleRunning) || len(check.BindableSecurityGroups) != 0 {
+		t.Errorf("port 22 must be denied without bindable security groups, got %+v", check)
+	}
+}
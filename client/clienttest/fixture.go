@@ -0,0 +1,117 @@
+package clienttest
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+	"github.com/pkg/errors"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+)
+
+// Fixture is the content of a fake foundation, see testdata/fixture.json for an example
+type Fixture struct {
+	Organizations  []FixtureOrganization  `json:"organizations"`
+	Spaces         []FixtureSpace         `json:"spaces"`
+	SecurityGroups []FixtureSecurityGroup `json:"security_groups"`
+	Roles          []FixtureRole          `json:"roles"`
+	Users          []FixtureUser          `json:"users"`
+	Clients        []FixtureClient        `json:"clients"`
+}
+
+type FixtureOrganization struct {
+	GUID string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type FixtureSpace struct {
+	GUID             string    `json:"guid"`
+	Name             string    `json:"name"`
+	OrganizationGUID string    `json:"organization_guid"`
+	CreatedAt        time.Time `json:"created_at,omitzero"`
+}
+
+type FixtureSecurityGroup struct {
+	GUID            string        `json:"guid"`
+	Name            string        `json:"name"`
+	Rules           []client.Rule `json:"rules"`
+	GloballyEnabled struct {
+		Running bool `json:"running"`
+		Staging bool `json:"staging"`
+	} `json:"globally_enabled"`
+	RunningSpaces []string `json:"running_spaces"`
+	StagingSpaces []string `json:"staging_spaces"`
+}
+
+// FixtureRole is a role of a user, space guid is empty for org roles
+type FixtureRole struct {
+	Type             constant.RoleType `json:"type"`
+	UserGUID         string            `json:"user_guid"`
+	OrganizationGUID string            `json:"organization_guid"`
+	SpaceGUID        string            `json:"space_guid"`
+}
+
+// FixtureUser is a uaa user, which can get a token with the password grant
+type FixtureUser struct {
+	GUID     string   `json:"guid"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Scopes   []string `json:"scopes"`
+}
+
+// FixtureClient is a uaa client, which can get a token with the client credentials grant
+type FixtureClient struct {
+	ID     string   `json:"client_id"`
+	Secret string   `json:"client_secret"`
+	Scopes []string `json:"scopes"`
+}
+
+// ReadFixture read a fixture from a json file
+func ReadFixture(path string) (Fixture, error) {
+	var fixture Fixture
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fixture, err
+	}
+	if err = json.Unmarshal(b, &fixture); err != nil {
+		return fixture, errors.Wrapf(err, "Error unmarshalling fixture %s", path)
+	}
+	return fixture, nil
+}
+
+// Seed add orgs, spaces, security groups and roles of a fixture, users and clients are ignored
+func (f *Fake) Seed(fixture Fixture) {
+	for _, org := range fixture.Organizations {
+		f.AddOrg(org.GUID, org.Name)
+	}
+	for _, space := range fixture.Spaces {
+		createdAt := space.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		f.AddSpaceCreatedAt(space.OrganizationGUID, space.GUID, space.Name, createdAt)
+	}
+	for _, fixtureSecGroup := range fixture.SecurityGroups {
+		running := fixtureSecGroup.GloballyEnabled.Running
+		staging := fixtureSecGroup.GloballyEnabled.Staging
+		secGroup := client.SecurityGroup{
+			GUID:                   fixtureSecGroup.GUID,
+			Name:                   fixtureSecGroup.Name,
+			Rules:                  fixtureSecGroup.Rules,
+			RunningGloballyEnabled: &running,
+			StagingGloballyEnabled: &staging,
+		}
+		for _, spaceGuid := range fixtureSecGroup.RunningSpaces {
+			secGroup.Relationships.Running_Spaces.Data = append(secGroup.Relationships.Running_Spaces.Data, client.Data{GUID: spaceGuid})
+		}
+		for _, spaceGuid := range fixtureSecGroup.StagingSpaces {
+			secGroup.Relationships.Staging_Spaces.Data = append(secGroup.Relationships.Staging_Spaces.Data, client.Data{GUID: spaceGuid})
+		}
+		f.AddSecGroup(secGroup)
+	}
+	for _, role := range fixture.Roles {
+		f.AddRole(role.Type, role.UserGUID, role.OrganizationGUID, role.SpaceGUID)
+	}
+}
@@ -0,0 +1,913 @@
+package clienttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+	"code.cloudfoundry.org/cli/v8/resources"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+// Operations of the fake uaa, used to inject errors and count calls
+const (
+	OpGetOrganizations = "GetOrganizations"
+	OpToken            = "Token"
+)
+
+const (
+	// JWTAlg is the algorithm used to sign tokens issued by the fake uaa
+	JWTAlg     = "HS256"
+	adminScope = "cloud_controller.admin"
+	maxPerPage = 5000
+)
+
+// DefaultClientID is the uaa client used by the cf cli, it has no secret and can only use password and refresh token grants
+const DefaultClientID = "cf"
+
+type uaaUser struct {
+	guid     string
+	username string
+	password string
+	scopes   []string
+}
+
+type uaaClient struct {
+	secret string
+	scopes []string
+}
+
+// Server is a fake cloud controller and uaa serving the state of a Fake over http,
+// lists are paginated and errors are given in the cloud controller v3 format.
+// Cloud controller endpoints require a token issued by the fake uaa, changes require the cloud_controller.admin scope.
+type Server struct {
+	*httptest.Server
+	Fake *Fake
+
+	mu            sync.Mutex
+	traceParents  []string
+	secret        []byte
+	tokenTTL      time.Duration
+	maxPerPage    int
+	users         map[string]uaaUser
+	clients       map[string]uaaClient
+	refreshTokens map[string]jwt.MapClaims
+}
+
+// NewServer start a fake cloud controller and uaa over the state of fake, it must be closed after use
+func NewServer(fake *Fake) *Server {
+	s := &Server{
+		Fake:          fake,
+		secret:        []byte(uuid.NewString()),
+		tokenTTL:      10 * time.Minute,
+		users:         make(map[string]uaaUser),
+		clients:       map[string]uaaClient{DefaultClientID: {}},
+		refreshTokens: make(map[string]jwt.MapClaims),
+	}
+	s.Server = httptest.NewServer(s.router())
+	fake.SetApiUrl(s.URL)
+	return s
+}
+
+// NewServerFromFixture start a fake cloud controller and uaa seeded with a fixture file
+func NewServerFromFixture(path string) (*Server, error) {
+	fixture, err := ReadFixture(path)
+	if err != nil {
+		return nil, err
+	}
+	s := NewServer(NewFake())
+	s.Seed(fixture)
+	return s, nil
+}
+
+// Seed add the content of a fixture, including uaa users and clients
+func (s *Server) Seed(fixture Fixture) {
+	s.Fake.Seed(fixture)
+	for _, user := range fixture.Users {
+		s.AddUser(user.GUID, user.Username, user.Password, user.Scopes...)
+	}
+	for _, c := range fixture.Clients {
+		s.AddClient(c.ID, c.Secret, c.Scopes...)
+	}
+}
+
+// AddUser add a uaa user, a guid is generated when empty
+func (s *Server) AddUser(guid, username, password string, scopes ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if guid == "" {
+		guid = uuid.NewString()
+	}
+	s.users[username] = uaaUser{guid: guid, username: username, password: password, scopes: scopes}
+	return guid
+}
+
+// AddClient add a uaa client
+func (s *Server) AddClient(id, secret string, scopes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[id] = uaaClient{secret: secret, scopes: scopes}
+}
+
+// SetTokenTTL change the lifetime of tokens issued from now on
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenTTL = ttl
+}
+
+// SetMaxPerPage cap the number of resources per page whatever per_page asked, to exercise pagination, 0 removes the cap
+func (s *Server) SetMaxPerPage(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxPerPage = max
+}
+
+// JWTSecret give the key used to sign tokens, to set in the jwt config of cfsecurity server with JWTAlg
+func (s *Server) JWTSecret() string {
+	return string(s.secret)
+}
+
+// ServerConfig give a cfsecurity server config using this fake with a uaa client, caches are disabled and retries are short
+func (s *Server) ServerConfig(clientId, clientSecret string) model.ConfigServer {
+	return model.ConfigServer{
+		LogLevel: "error",
+		CloudFoundry: model.CFConfig{
+			Endpoint:     s.URL,
+			UAAEndpoint:  s.URL,
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+		},
+		JWT:                    model.JWT{Alg: JWTAlg, Secret: s.JWTSecret()},
+		OrgBindingPollInterval: 60,
+		Retry: model.RetryConfig{
+			MaxAttempts:      2,
+			InitialBackoffMs: 10,
+			MaxBackoffMs:     50,
+			MaxElapsedMs:     1000,
+		},
+	}
+}
+
+// UserToken give a token for a user as given by the password grant, prefixed by bearer
+func (s *Server) UserToken(username string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[username]
+	if !ok {
+		return "", fmt.Errorf("unknown user %s", username)
+	}
+	accessToken, _, err := s.issue(user.guid, DefaultClientID, "password", &user, user.scopes)
+	if err != nil {
+		return "", err
+	}
+	return "bearer " + accessToken, nil
+}
+
+// ClientToken give a token for a client as given by the client credentials grant, prefixed by bearer
+func (s *Server) ClientToken(clientId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[clientId]
+	if !ok {
+		return "", fmt.Errorf("unknown client %s", clientId)
+	}
+	accessToken, _, err := s.issue(clientId, clientId, "client_credentials", nil, c.scopes)
+	if err != nil {
+		return "", err
+	}
+	return "bearer " + accessToken, nil
+}
+
+func (s *Server) router() http.Handler {
+	r := mux.NewRouter()
+	r.Use(requestIDHandler)
+	r.Use(s.traceParentHandler)
+	r.HandleFunc("/", s.handleRoot).Methods(http.MethodGet)
+	r.HandleFunc("/v3/info", s.handleInfo).Methods(http.MethodGet)
+	r.HandleFunc("/oauth/token", s.handleToken).Methods(http.MethodPost)
+	r.HandleFunc("/token_keys", s.handleTokenKeys).Methods(http.MethodGet)
+
+	cc := r.NewRoute().Subrouter()
+	cc.Use(s.authHandler)
+	cc.HandleFunc("/v3/security_groups", s.handleListSecGroups).Methods(http.MethodGet)
+	cc.HandleFunc("/v3/security_groups", s.handleCreateSecGroup).Methods(http.MethodPost)
+	cc.HandleFunc("/v3/security_groups/{guid}", s.handleGetSecGroup).Methods(http.MethodGet)
+	cc.HandleFunc("/v3/security_groups/{guid}", s.handleUpdateSecGroup).Methods(http.MethodPatch)
+	cc.HandleFunc("/v3/security_groups/{guid}", s.handleDeleteSecGroup).Methods(http.MethodDelete)
+	cc.HandleFunc("/v3/security_groups/{guid}/relationships/{lifecycle:running|staging}_spaces", s.handleBindSecGroup).Methods(http.MethodPost)
+	cc.HandleFunc("/v3/security_groups/{guid}/relationships/{lifecycle:running|staging}_spaces/{space_guid}", s.handleUnbindSecGroup).Methods(http.MethodDelete)
+	cc.HandleFunc("/v3/spaces", s.handleListSpaces).Methods(http.MethodGet)
+	cc.HandleFunc("/v3/spaces/{guid}", s.handleGetSpace).Methods(http.MethodGet)
+	cc.HandleFunc("/v3/organizations", s.handleListOrgs).Methods(http.MethodGet)
+	cc.HandleFunc("/v3/organizations/{guid}", s.handleGetOrg).Methods(http.MethodGet)
+	cc.HandleFunc("/v3/roles", s.handleListRoles).Methods(http.MethodGet)
+
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeCCError(w, client.CloudFoundryHTTPError{StatusCode: http.StatusNotFound, Code: 10000, Title: "CF-NotFound", Detail: "Unknown request"})
+	})
+	r.MethodNotAllowedHandler = r.NotFoundHandler
+	return r
+}
+
+func (s *Server) handleRoot(w http.ResponseWriter, req *http.Request) {
+	link := func(path string) map[string]string {
+		return map[string]string{"href": s.URL + path}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"links": map[string]any{
+			"self":                link(""),
+			"cloud_controller_v3": link("/v3"),
+			"uaa":                 link(""),
+			"login":               link(""),
+		},
+	})
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":        "fake",
+		"build":       "",
+		"version":     0,
+		"description": "fake cloud controller",
+		"links": map[string]any{
+			"self": map[string]string{"href": s.URL + "/v3/info"},
+		},
+	})
+}
+
+func (s *Server) handleTokenKeys(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty":   "MAC",
+			"alg":   JWTAlg,
+			"use":   "sig",
+			"kid":   "fake",
+			"value": s.JWTSecret(),
+		}},
+	})
+}
+
+// handleToken implement the client credentials, password and refresh token grants of uaa
+func (s *Server) handleToken(w http.ResponseWriter, req *http.Request) {
+	if err := s.Fake.begin(req.Context(), OpToken); err != nil {
+		writeUAAError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		writeUAAError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	clientId, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientId, clientSecret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[clientId]
+	if !ok || c.secret != clientSecret {
+		writeUAAError(w, http.StatusUnauthorized, "unauthorized", "Bad credentials")
+		return
+	}
+	grantType := req.PostForm.Get("grant_type")
+	var accessToken, refreshToken string
+	var scopes []string
+	var err error
+	switch grantType {
+	case "client_credentials":
+		if clientId == DefaultClientID {
+			writeUAAError(w, http.StatusUnauthorized, "invalid_client", "Unauthorized grant type: client_credentials")
+			return
+		}
+		scopes = c.scopes
+		accessToken, _, err = s.issue(clientId, clientId, grantType, nil, scopes)
+	case "password":
+		user, ok := s.users[req.PostForm.Get("username")]
+		if !ok || user.password != req.PostForm.Get("password") {
+			writeUAAError(w, http.StatusUnauthorized, "unauthorized", "Bad credentials")
+			return
+		}
+		scopes = user.scopes
+		accessToken, refreshToken, err = s.issue(user.guid, clientId, grantType, &user, scopes)
+	case "refresh_token":
+		claims, ok := s.refreshTokens[req.PostForm.Get("refresh_token")]
+		if !ok || claims["client_id"] != clientId {
+			writeUAAError(w, http.StatusUnauthorized, "invalid_token", "Invalid refresh token")
+			return
+		}
+		user := s.users[claims["user_name"].(string)]
+		scopes = user.scopes
+		accessToken, refreshToken, err = s.issue(user.guid, clientId, grantType, &user, scopes)
+	default:
+		writeUAAError(w, http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("Unsupported grant type: %s", grantType))
+		return
+	}
+	if err != nil {
+		writeUAAError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	token := map[string]any{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"expires_in":   int(s.tokenTTL.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+		"jti":          uuid.NewString(),
+	}
+	if refreshToken != "" {
+		token["refresh_token"] = refreshToken
+	}
+	writeJSON(w, http.StatusOK, token)
+}
+
+// issue sign an access token, and give a refresh token for users, s.mu must be held
+func (s *Server) issue(subject, clientId, grantType string, user *uaaUser, scopes []string) (string, string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"jti":        uuid.NewString(),
+		"sub":        subject,
+		"client_id":  clientId,
+		"cid":        clientId,
+		"grant_type": grantType,
+		"scope":      slices.Clone(scopes),
+		"iat":        now.Unix(),
+		"exp":        now.Add(s.tokenTTL).Unix(),
+		"iss":        s.URL + "/oauth/token",
+		"zid":        "uaa",
+	}
+	if claims["scope"] == nil {
+		claims["scope"] = []string{}
+	}
+	if user != nil {
+		claims["user_id"] = user.guid
+		claims["user_name"] = user.username
+		claims["origin"] = "uaa"
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.GetSigningMethod(JWTAlg), claims).SignedString(s.secret)
+	if err != nil || user == nil {
+		return accessToken, "", err
+	}
+	refreshToken := uuid.NewString() + "-r"
+	s.refreshTokens[refreshToken] = claims
+	return accessToken, refreshToken, nil
+}
+
+type principal struct {
+	admin bool
+}
+
+type principalKey struct{}
+
+func contextWithPrincipal(req *http.Request, p principal) context.Context {
+	return context.WithValue(req.Context(), principalKey{}, p)
+}
+
+func principalOf(req *http.Request) principal {
+	p, _ := req.Context().Value(principalKey{}).(principal)
+	return p
+}
+
+// requestIDHandler send back the request id like cloud controller does, one is generated for requests without it
+func requestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(client.RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(client.RequestIDHeader, requestID)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// traceParentHandler record the trace context propagated by callers
+func (s *Server) traceParentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if traceParent := req.Header.Get("traceparent"); traceParent != "" {
+			s.mu.Lock()
+			s.traceParents = append(s.traceParents, traceParent)
+			s.mu.Unlock()
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// TraceParents give the traceparent headers received, in the w3c trace context format
+func (s *Server) TraceParents() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.traceParents)
+}
+
+// authHandler reject cloud controller requests without a valid token from the fake uaa
+func (s *Server) authHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get("Authorization")
+		parts := strings.SplitN(header, " ", 2)
+		if header == "" || len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+			writeCCError(w, client.CloudFoundryHTTPError{StatusCode: http.StatusUnauthorized, Code: 10002, Title: "CF-NotAuthenticated", Detail: "Authentication error"})
+			return
+		}
+		claims := &struct {
+			Scope []string `json:"scope"`
+			jwt.RegisteredClaims
+		}{}
+		_, err := jwt.ParseWithClaims(strings.TrimSpace(parts[1]), claims, func(token *jwt.Token) (any, error) {
+			return s.secret, nil
+		}, jwt.WithValidMethods([]string{JWTAlg}))
+		if err != nil {
+			writeCCError(w, client.CloudFoundryHTTPError{StatusCode: http.StatusUnauthorized, Code: 1000, Title: "CF-InvalidAuthToken", Detail: "Invalid Auth Token"})
+			return
+		}
+		p := principal{admin: slices.Contains(claims.Scope, adminScope)}
+		next.ServeHTTP(w, req.WithContext(contextWithPrincipal(req, p)))
+	})
+}
+
+func (s *Server) handleListSecGroups(w http.ResponseWriter, req *http.Request) {
+	if err := s.Fake.begin(req.Context(), OpGetSecGroups); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	secGroups := s.Fake.findSecGroups(urlQueries(req.URL.Query()))
+	s.Fake.mu.Unlock()
+	ccSecGroups := make([]ccSecGroup, 0, len(secGroups))
+	for _, secGroup := range secGroups {
+		ccSecGroups = append(ccSecGroups, toCCSecGroup(secGroup))
+	}
+	page, err := paginate(s, req, ccSecGroups)
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleGetSecGroup(w http.ResponseWriter, req *http.Request) {
+	if err := s.Fake.begin(req.Context(), OpGetSecGroups); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	secGroup := s.Fake.secGroup(mux.Vars(req)["guid"])
+	var cc ccSecGroup
+	if secGroup != nil {
+		cc = toCCSecGroup(copySecGroup(secGroup))
+	}
+	s.Fake.mu.Unlock()
+	if secGroup == nil {
+		writeCCError(w, notFound("Security group"))
+		return
+	}
+	writeJSON(w, http.StatusOK, cc)
+}
+
+func (s *Server) handleCreateSecGroup(w http.ResponseWriter, req *http.Request) {
+	s.writeSecGroup(w, req, http.StatusCreated, func(params client.SecurityGroupParams) (client.SecurityGroup, error) {
+		return s.Fake.CreateSecurityGroupContext(req.Context(), params)
+	})
+}
+
+func (s *Server) handleUpdateSecGroup(w http.ResponseWriter, req *http.Request) {
+	s.writeSecGroup(w, req, http.StatusOK, func(params client.SecurityGroupParams) (client.SecurityGroup, error) {
+		return s.Fake.UpdateSecurityGroupContext(req.Context(), mux.Vars(req)["guid"], params)
+	})
+}
+
+// writeSecGroup decode the body of a create or update, which only admins can do, and write the resulting security group
+func (s *Server) writeSecGroup(w http.ResponseWriter, req *http.Request, status int, change func(client.SecurityGroupParams) (client.SecurityGroup, error)) {
+	if !principalOf(req).admin {
+		writeCCError(w, notAuthorized())
+		return
+	}
+	var params client.SecurityGroupParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		writeCCError(w, unprocessable("Request invalid due to parse error: invalid request body"))
+		return
+	}
+	secGroup, err := change(params)
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	writeJSON(w, status, toCCSecGroup(secGroup))
+}
+
+func (s *Server) handleDeleteSecGroup(w http.ResponseWriter, req *http.Request) {
+	if !principalOf(req).admin {
+		writeCCError(w, notAuthorized())
+		return
+	}
+	if err := s.Fake.DeleteSecurityGroupContext(req.Context(), mux.Vars(req)["guid"]); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) handleBindSecGroup(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	lifecycle := vars["lifecycle"]
+	if !principalOf(req).admin {
+		writeCCError(w, notAuthorized())
+		return
+	}
+	var relationship ccRelationship
+	if err := json.NewDecoder(req.Body).Decode(&relationship); err != nil || len(relationship.Data) == 0 {
+		writeCCError(w, unprocessable("Data must have at least 1 space guid"))
+		return
+	}
+	spaceGuids := make([]string, 0, len(relationship.Data))
+	for _, data := range relationship.Data {
+		spaceGuids = append(spaceGuids, data.GUID)
+	}
+
+	op := OpBindRunningSecGroup
+	if lifecycle == client.LifecycleStaging {
+		op = OpBindStagingSecGroup
+	}
+	if err := s.Fake.begin(req.Context(), op); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	err := s.Fake.bindSpaces(vars["guid"], spaceGuids, lifecycle)
+	bound := ccRelationship{Data: make([]ccGuid, 0)}
+	if secGroup := s.Fake.secGroup(vars["guid"]); err == nil && secGroup != nil {
+		for _, data := range *bindings(secGroup, lifecycle) {
+			bound.Data = append(bound.Data, ccGuid{GUID: data.GUID})
+		}
+	}
+	s.Fake.mu.Unlock()
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"data": bound.Data,
+		"links": map[string]any{
+			"self": map[string]string{"href": s.URL + req.URL.Path},
+		},
+	})
+}
+
+func (s *Server) handleUnbindSecGroup(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	lifecycle := vars["lifecycle"]
+	if !principalOf(req).admin {
+		writeCCError(w, notAuthorized())
+		return
+	}
+	op := OpUnBindRunningSecGroup
+	if lifecycle == client.LifecycleStaging {
+		op = OpUnBindStagingSecGroup
+	}
+	if err := s.Fake.begin(req.Context(), op); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	err := s.Fake.unbindSpace(vars["guid"], vars["space_guid"], lifecycle)
+	s.Fake.mu.Unlock()
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListSpaces(w http.ResponseWriter, req *http.Request) {
+	if err := s.Fake.begin(req.Context(), OpGetSpacesWithOrg); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	spaces, err := s.Fake.findSpaces(urlQueries(req.URL.Query()))
+	ccSpaces := make([]ccSpace, 0, len(spaces.Resources))
+	for _, space := range spaces.Resources {
+		ccSpaces = append(ccSpaces, s.toCCSpace(s.Fake.spaces[space.GUID]))
+	}
+	s.Fake.mu.Unlock()
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	page, err := paginate(s, req, ccSpaces)
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	if slices.Contains(splitValues(req.URL.Query()[string(ccv3.Include)]), "organization") {
+		// only orgs of spaces in this page are included, as cloud controller does
+		orgGuids := make(map[string]bool)
+		for _, space := range page.Resources {
+			orgGuids[space.Relationships[constant.RelationshipTypeOrganization].GUID] = true
+		}
+		page.Included = map[string]any{"organizations": filterOrgs(spaces.Included.Organizations, orgGuids)}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleGetSpace(w http.ResponseWriter, req *http.Request) {
+	if err := s.Fake.begin(req.Context(), OpGetSpaceByGuid); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	space, ok := s.Fake.spaces[mux.Vars(req)["guid"]]
+	var cc ccSpace
+	if ok {
+		cc = s.toCCSpace(space)
+	}
+	s.Fake.mu.Unlock()
+	if !ok {
+		writeCCError(w, notFound("Space"))
+		return
+	}
+	writeJSON(w, http.StatusOK, cc)
+}
+
+func (s *Server) handleListOrgs(w http.ResponseWriter, req *http.Request) {
+	if err := s.Fake.begin(req.Context(), OpGetOrganizations); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	orgs := s.Fake.findOrgs(urlQueries(req.URL.Query()))
+	s.Fake.mu.Unlock()
+	page, err := paginate(s, req, orgs)
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleGetOrg(w http.ResponseWriter, req *http.Request) {
+	if err := s.Fake.begin(req.Context(), OpGetOrganizations); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	org, ok := s.Fake.orgs[mux.Vars(req)["guid"]]
+	s.Fake.mu.Unlock()
+	if !ok {
+		writeCCError(w, notFound("Organization"))
+		return
+	}
+	writeJSON(w, http.StatusOK, org.Organization)
+}
+
+func (s *Server) handleListRoles(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := client.RolesFilter{
+		UserGUIDs:         splitValues(query[string(ccv3.UserGUIDFilter)]),
+		OrganizationGUIDs: splitValues(query[string(ccv3.OrganizationGUIDFilter)]),
+		SpaceGUIDs:        splitValues(query[string(ccv3.SpaceGUIDFilter)]),
+	}
+	for _, roleType := range splitValues(query[string(ccv3.RoleTypesFilter)]) {
+		filter.Types = append(filter.Types, constant.RoleType(roleType))
+	}
+	if err := s.Fake.begin(req.Context(), OpGetRoles); err != nil {
+		writeCCError(w, err)
+		return
+	}
+	s.Fake.mu.Lock()
+	roles := s.Fake.findRoles(filter)
+	s.Fake.mu.Unlock()
+	ccRoles := make([]ccRole, 0, len(roles))
+	for _, role := range roles {
+		ccRoles = append(ccRoles, toCCRole(role))
+	}
+	page, err := paginate(s, req, ccRoles)
+	if err != nil {
+		writeCCError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (f *Fake) findOrgs(queries []ccv3.Query) []resources.Organization {
+	orgs := make([]resources.Organization, 0)
+	for _, org := range f.orgs {
+		ok := true
+		for _, query := range queries {
+			switch query.Key {
+			case ccv3.GUIDFilter:
+				ok = ok && slices.Contains(splitValues(query.Values), org.GUID)
+			case ccv3.NameFilter:
+				ok = ok && slices.Contains(splitValues(query.Values), org.Name)
+			}
+		}
+		if ok {
+			orgs = append(orgs, org.Organization)
+		}
+	}
+	slices.SortFunc(orgs, func(a, b resources.Organization) int {
+		return strings.Compare(a.GUID, b.GUID)
+	})
+	return orgs
+}
+
+func filterOrgs(orgs []resources.Organization, guids map[string]bool) []resources.Organization {
+	filtered := make([]resources.Organization, 0)
+	for _, org := range orgs {
+		if guids[org.GUID] {
+			filtered = append(filtered, org)
+		}
+	}
+	return filtered
+}
+
+type ccHref struct {
+	HREF string `json:"href"`
+}
+
+type ccPagination struct {
+	TotalResults int     `json:"total_results"`
+	TotalPages   int     `json:"total_pages"`
+	First        ccHref  `json:"first"`
+	Last         ccHref  `json:"last"`
+	Next         *ccHref `json:"next"`
+	Previous     *ccHref `json:"previous"`
+}
+
+type ccPage[T any] struct {
+	Pagination ccPagination   `json:"pagination"`
+	Resources  []T            `json:"resources"`
+	Included   map[string]any `json:"included,omitempty"`
+}
+
+// paginate give the page of resources asked with page and per_page, rejecting invalid values as cloud controller does
+func paginate[T any](s *Server, req *http.Request, resources []T) (ccPage[T], error) {
+	query := req.URL.Query()
+	pageNumber, perPage := 1, 50
+	var err error
+	if value := query.Get(string(ccv3.Page)); value != "" {
+		pageNumber, err = strconv.Atoi(value)
+		if err != nil || pageNumber < 1 {
+			return ccPage[T]{}, badQueryParameter("Page must be greater than 0")
+		}
+	}
+	if value := query.Get(string(ccv3.PerPage)); value != "" {
+		perPage, err = strconv.Atoi(value)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return ccPage[T]{}, badQueryParameter(fmt.Sprintf("Per page must be between 1 and %d", maxPerPage))
+		}
+	}
+	s.mu.Lock()
+	if s.maxPerPage > 0 {
+		perPage = min(perPage, s.maxPerPage)
+	}
+	s.mu.Unlock()
+
+	totalPages := max(1, int(math.Ceil(float64(len(resources))/float64(perPage))))
+	href := func(page int) ccHref {
+		pageQuery := url.Values{}
+		for key, values := range query {
+			pageQuery[key] = values
+		}
+		pageQuery.Set(string(ccv3.Page), strconv.Itoa(page))
+		pageQuery.Set(string(ccv3.PerPage), strconv.Itoa(perPage))
+		return ccHref{HREF: s.URL + req.URL.Path + "?" + pageQuery.Encode()}
+	}
+	page := ccPage[T]{
+		Pagination: ccPagination{
+			TotalResults: len(resources),
+			TotalPages:   totalPages,
+			First:        href(1),
+			Last:         href(totalPages),
+		},
+		Resources: make([]T, 0),
+	}
+	if pageNumber < totalPages {
+		next := href(pageNumber + 1)
+		page.Pagination.Next = &next
+	}
+	if pageNumber > 1 {
+		previous := href(min(pageNumber-1, totalPages))
+		page.Pagination.Previous = &previous
+	}
+	start := (pageNumber - 1) * perPage
+	if start < len(resources) {
+		page.Resources = resources[start:min(start+perPage, len(resources))]
+	}
+	return page, nil
+}
+
+// ccSpace is a space as rendered by cloud controller
+type ccSpace struct {
+	resources.Space
+	CreatedAt string            `json:"created_at"`
+	UpdatedAt string            `json:"updated_at"`
+	Links     map[string]ccHref `json:"links"`
+}
+
+func (s *Server) toCCSpace(space *space) ccSpace {
+	createdAt := space.createdAt.UTC().Format(time.RFC3339)
+	return ccSpace{
+		Space:     space.Space.Space,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Links: map[string]ccHref{
+			"self":         {HREF: s.URL + "/v3/spaces/" + space.GUID},
+			"organization": {HREF: s.URL + "/v3/organizations/" + space.Relationships[constant.RelationshipTypeOrganization].GUID},
+		},
+	}
+}
+
+// ccRole is a role as rendered by cloud controller
+type ccRole struct {
+	GUID          string                  `json:"guid"`
+	CreatedAt     string                  `json:"created_at"`
+	UpdatedAt     string                  `json:"updated_at"`
+	Type          string                  `json:"type"`
+	Relationships resources.Relationships `json:"relationships"`
+}
+
+func toCCRole(role client.Role) ccRole {
+	return ccRole{
+		GUID:      role.GUID,
+		CreatedAt: role.CreatedAt,
+		UpdatedAt: role.UpdatedAt,
+		Type:      role.Type,
+		Relationships: resources.Relationships{
+			constant.RelationshipTypeUser:         {GUID: role.Relationships.User.Data.GUID},
+			constant.RelationshipTypeOrganization: {GUID: role.Relationships.Organization.Data.GUID},
+			constant.RelationshipTypeSpace:        {GUID: role.Relationships.Space.Data.GUID},
+		},
+	}
+}
+
+// urlQueries give filters of a request as queries
+func urlQueries(values url.Values) []ccv3.Query {
+	queries := make([]ccv3.Query, 0, len(values))
+	for key, value := range values {
+		queries = append(queries, ccv3.Query{Key: ccv3.QueryKey(key), Values: value})
+	}
+	return queries
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+// writeCCError write an error in the cloud controller v3 format, errors which are not
+// a client.CloudFoundryHTTPError are unknown errors
+func writeCCError(w http.ResponseWriter, err error) {
+	var httpErr client.CloudFoundryHTTPError
+	if !errors.As(err, &httpErr) {
+		httpErr = client.CloudFoundryHTTPError{StatusCode: http.StatusInternalServerError, Code: 10001, Title: "UnknownError", Detail: "An unknown error occurred."}
+	}
+	writeJSON(w, httpErr.StatusCode, client.CloudFoundryErrorsV3{Errors: []client.CloudFoundryErrorV3{{
+		Code:   httpErr.Code,
+		Title:  httpErr.Title,
+		Detail: httpErr.Detail,
+	}}})
+}
+
+func writeUAAError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func notAuthorized() error {
+	return client.CloudFoundryHTTPError{
+		StatusCode: http.StatusForbidden,
+		Status:     http.StatusText(http.StatusForbidden),
+		Code:       10003,
+		Title:      "CF-NotAuthorized",
+		Detail:     "You are not authorized to perform the requested action",
+	}
+}
+
+func badQueryParameter(detail string) error {
+	return client.CloudFoundryHTTPError{
+		StatusCode: http.StatusBadRequest,
+		Status:     http.StatusText(http.StatusBadRequest),
+		Code:       10005,
+		Title:      "CF-BadQueryParameter",
+		Detail:     "The query parameter is invalid: " + detail,
+	}
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+	"github.com/pkg/errors"
+)
+
+const (
+	LifecycleRunning = "running"
+	LifecycleStaging = "staging"
+
+	SourceGlobal = "global"
+	SourceSpace  = "space"
+)
+
+const (
+	RunningSpaceGUIDsFilter ccv3.QueryKey = "running_space_guids"
+	StagingSpaceGUIDsFilter ccv3.QueryKey = "staging_space_guids"
+)
+
+// EffectiveSecurityGroup is a security group contributing to the egress of a space
+// for one lifecycle, either because it is globally enabled or because it is bound to the space
+type EffectiveSecurityGroup struct {
+	GUID      string `json:"guid"`
+	Name      string `json:"name"`
+	Lifecycle string `json:"lifecycle"`
+	Source    string `json:"source"`
+}
+
+// EffectiveRule is a rule merged from all the effective security groups of a space
+type EffectiveRule struct {
+	Protocol       string   `json:"protocol"`
+	Destination    string   `json:"destination"`
+	Ports          string   `json:"ports,omitempty"`
+	Lifecycles     []string `json:"lifecycles"`
+	SecurityGroups []string `json:"security_groups"`
+}
+
+type EffectiveSecurityGroups struct {
+	SpaceGUID        string                   `json:"space_guid"`
+	OrganizationGUID string                   `json:"organization_guid"`
+	SecurityGroups   []EffectiveSecurityGroup `json:"security_groups"`
+	Rules            []EffectiveRule          `json:"rules"`
+}
+
+// BuildEffectiveSecGroups compute the union of globally enabled security groups and security groups bound to a space
+func (c *Client) BuildEffectiveSecGroups(space Space) (EffectiveSecurityGroups, error) {
+	return c.BuildEffectiveSecGroupsContext(context.Background(), space)
+}
+
+// BuildEffectiveSecGroupsContext is like BuildEffectiveSecGroups, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BuildEffectiveSecGroupsContext(ctx context.Context, space Space) (EffectiveSecurityGroups, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return BuildEffectiveSecGroupsWith(ctx, c, space)
+}
+
+// BuildEffectiveSecGroupsWith compute effective security groups of a space using api
+func BuildEffectiveSecGroupsWith(ctx context.Context, api API, space Space) (EffectiveSecurityGroups, error) {
+	spaceGuid := space.GUID
+	effective := EffectiveSecurityGroups{
+		SpaceGUID:        spaceGuid,
+		OrganizationGUID: space.Relationships[constant.RelationshipTypeOrganization].GUID,
+		SecurityGroups:   make([]EffectiveSecurityGroup, 0),
+		Rules:            make([]EffectiveRule, 0),
+	}
+
+	lookups := []struct {
+		lifecycle string
+		source    string
+		query     ccv3.Query
+	}{
+		{LifecycleRunning, SourceGlobal, ccv3.Query{Key: ccv3.GloballyEnabledRunning, Values: []string{"true"}}},
+		{LifecycleStaging, SourceGlobal, ccv3.Query{Key: ccv3.GloballyEnabledStaging, Values: []string{"true"}}},
+		{LifecycleRunning, SourceSpace, ccv3.Query{Key: RunningSpaceGUIDsFilter, Values: []string{spaceGuid}}},
+		{LifecycleStaging, SourceSpace, ccv3.Query{Key: StagingSpaceGUIDsFilter, Values: []string{spaceGuid}}},
+	}
+
+	rules := make(map[string]*EffectiveRule)
+	for _, lookup := range lookups {
+		secGroups, err := api.GetSecGroupsContext(ctx, []ccv3.Query{lookup.query}, 0)
+		if err != nil {
+			return effective, err
+		}
+		for _, secGroup := range secGroups.Resources {
+			effective.SecurityGroups = append(effective.SecurityGroups, EffectiveSecurityGroup{
+				GUID:      secGroup.GUID,
+				Name:      secGroup.Name,
+				Lifecycle: lookup.lifecycle,
+				Source:    lookup.source,
+			})
+			for _, rule := range secGroup.Rules {
+				key := strings.Join([]string{rule.Protocol, rule.Destination, rule.Ports}, "|")
+				merged, ok := rules[key]
+				if !ok {
+					merged = &EffectiveRule{
+						Protocol:    rule.Protocol,
+						Destination: rule.Destination,
+						Ports:       rule.Ports,
+					}
+					rules[key] = merged
+				}
+				merged.Lifecycles = appendUnique(merged.Lifecycles, lookup.lifecycle)
+				merged.SecurityGroups = appendUnique(merged.SecurityGroups, secGroup.Name)
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		effective.Rules = append(effective.Rules, *rule)
+	}
+	sort.Slice(effective.Rules, func(i, j int) bool {
+		if effective.Rules[i].Destination != effective.Rules[j].Destination {
+			return effective.Rules[i].Destination < effective.Rules[j].Destination
+		}
+		if effective.Rules[i].Protocol != effective.Rules[j].Protocol {
+			return effective.Rules[i].Protocol < effective.Rules[j].Protocol
+		}
+		return effective.Rules[i].Ports < effective.Rules[j].Ports
+	})
+	return effective, nil
+}
+
+// GetEffectiveSecGroups retrieve effective security groups of a space from cfsecurity server
+func (c *Client) GetEffectiveSecGroups(spaceGuid string) (EffectiveSecurityGroups, error) {
+	return c.GetEffectiveSecGroupsContext(context.Background(), spaceGuid)
+}
+
+// GetEffectiveSecGroupsContext is like GetEffectiveSecGroups, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetEffectiveSecGroupsContext(ctx context.Context, spaceGuid string) (EffectiveSecurityGroups, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var effective EffectiveSecurityGroups
+	buffer, err := c.doRequest(ctx, http.MethodGet, c.endpoint+"/v3/spaces/"+spaceGuid+"/effective_security_groups", nil)
+	if err != nil {
+		return effective, err
+	}
+	if err = json.Unmarshal(buffer, &effective); err != nil {
+		return effective, errors.Wrap(err, "Error unmarshalling effective security groups")
+	}
+	return effective, nil
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"github.com/pkg/errors"
+)
+
+// EgressMatch is a security group rule which let traffic go to a destination
+type EgressMatch struct {
+	SecurityGroupGUID string `json:"security_group_guid"`
+	SecurityGroupName string `json:"security_group_name"`
+	Source            string `json:"source,omitempty"`
+	Rule              Rule   `json:"rule"`
+}
+
+type EgressLifecycleCheck struct {
+	Lifecycle string        `json:"lifecycle"`
+	Allowed   bool          `json:"allowed"`
+	Matches   []EgressMatch `json:"matches"`
+}
+
+// EgressCheck is the answer to "can apps in this space reach this destination"
+type EgressCheck struct {
+	SpaceGUID              string                 `json:"space_guid"`
+	OrganizationGUID       string                 `json:"organization_guid"`
+	Destination            string                 `json:"destination"`
+	Port                   int                    `json:"port,omitempty"`
+	Protocol               string                 `json:"protocol"`
+	Lifecycles             []EgressLifecycleCheck `json:"lifecycles"`
+	BindableSecurityGroups []EgressMatch          `json:"bindable_security_groups"`
+}
+
+// Allowed check if the destination can be reached for the given lifecycle
+func (e EgressCheck) Allowed(lifecycle string) bool {
+	for _, check := range e.Lifecycles {
+		if check.Lifecycle == lifecycle {
+			return check.Allowed
+		}
+	}
+	return false
+}
+
+// BuildEgressCheck evaluate effective security groups of a space against a destination for each lifecycle,
+// when destination is denied for one of the lifecycles, security groups which would allow it are listed
+func (c *Client) BuildEgressCheck(space Space, ip net.IP, port int, protocol string) (EgressCheck, error) {
+	return c.BuildEgressCheckContext(context.Background(), space, ip, port, protocol)
+}
+
+// BuildEgressCheckContext is like BuildEgressCheck, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BuildEgressCheckContext(ctx context.Context, space Space, ip net.IP, port int, protocol string) (EgressCheck, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return BuildEgressCheckWith(ctx, c, space, ip, port, protocol)
+}
+
+// BuildEgressCheckWith evaluate a destination for a space using api, see BuildEgressCheck
+func BuildEgressCheckWith(ctx context.Context, api API, space Space, ip net.IP, port int, protocol string) (EgressCheck, error) {
+	check := EgressCheck{
+		SpaceGUID:              space.GUID,
+		Destination:            ip.String(),
+		Port:                   port,
+		Protocol:               protocol,
+		Lifecycles:             make([]EgressLifecycleCheck, 0),
+		BindableSecurityGroups: make([]EgressMatch, 0),
+	}
+	effective, err := BuildEffectiveSecGroupsWith(ctx, api, space)
+	if err != nil {
+		return check, err
+	}
+	check.OrganizationGUID = effective.OrganizationGUID
+
+	// only matching security groups are kept, in the order of cloud controller
+	matches := make(map[string]EgressMatch)
+	matched := make([]string, 0)
+	for secGroup, err := range api.IterSecGroups(ctx, []ccv3.Query{}) {
+		if err != nil {
+			return check, err
+		}
+		for _, rule := range secGroup.Rules {
+			if rule.Allows(ip, port, protocol) {
+				matches[secGroup.GUID] = EgressMatch{
+					SecurityGroupGUID: secGroup.GUID,
+					SecurityGroupName: secGroup.Name,
+					Rule:              rule,
+				}
+				matched = append(matched, secGroup.GUID)
+				break
+			}
+		}
+	}
+
+	denied := false
+	for _, lifecycle := range []string{LifecycleRunning, LifecycleStaging} {
+		lifecycleCheck := EgressLifecycleCheck{
+			Lifecycle: lifecycle,
+			Matches:   make([]EgressMatch, 0),
+		}
+		for _, secGroup := range effective.SecurityGroups {
+			if secGroup.Lifecycle != lifecycle {
+				continue
+			}
+			match, ok := matches[secGroup.GUID]
+			if !ok {
+				continue
+			}
+			match.Source = secGroup.Source
+			lifecycleCheck.Matches = append(lifecycleCheck.Matches, match)
+		}
+		lifecycleCheck.Allowed = len(lifecycleCheck.Matches) > 0
+		denied = denied || !lifecycleCheck.Allowed
+		check.Lifecycles = append(check.Lifecycles, lifecycleCheck)
+	}
+
+	if !denied {
+		return check, nil
+	}
+	for _, guid := range matched {
+		check.BindableSecurityGroups = append(check.BindableSecurityGroups, matches[guid])
+	}
+	return check, nil
+}
+
+// GetEgressCheck ask cfsecurity server if apps in a space can reach a destination
+func (c *Client) GetEgressCheck(spaceGuid string, destination string, port int, protocol string) (EgressCheck, error) {
+	return c.GetEgressCheckContext(context.Background(), spaceGuid, destination, port, protocol)
+}
+
+// GetEgressCheckContext is like GetEgressCheck, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetEgressCheckContext(ctx context.Context, spaceGuid string, destination string, port int, protocol string) (EgressCheck, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var check EgressCheck
+	query := url.Values{}
+	query.Set("destination", destination)
+	if port > 0 {
+		query.Set("port", strconv.Itoa(port))
+	}
+	if protocol != "" {
+		query.Set("protocol", protocol)
+	}
+	buffer, err := c.doRequest(ctx, http.MethodGet, c.endpoint+"/v3/spaces/"+spaceGuid+"/check_egress?"+query.Encode(), nil)
+	if err != nil {
+		return check, err
+	}
+	if err = json.Unmarshal(buffer, &check); err != nil {
+		return check, errors.Wrap(err, "Error unmarshalling egress check")
+	}
+	return check, nil
+}
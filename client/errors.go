@@ -52,41 +52,83 @@ func (cfErrV3 CloudFoundryErrorV3) Error() string {
 	return fmt.Sprintf("cfclient error (%d|%s): %s", cfErrV3.Code, cfErrV3.Title, cfErrV3.Detail)
 }
 
+var (
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrNotFound      = errors.New("not found")
+	ErrUnprocessable = errors.New("unprocessable entity")
+)
+
+// CloudFoundryHTTPError is a non 2xx response from cloud controller or cfsecurity server,
+// use errors.Is with ErrUnauthorized, ErrForbidden, ErrNotFound or ErrUnprocessable to check its kind
 type CloudFoundryHTTPError struct {
 	StatusCode int
 	Status     string
 	Body       string
+	Code       int
+	Title      string
+	Detail     string
+	// RequestID is the request id sent back by the api, it is given to operators to find the request in logs
+	RequestID string
 }
 
 func (e CloudFoundryHTTPError) Error() string {
-	return fmt.Sprintf("cfclient: HTTP error (%d): %s", e.StatusCode, e.Status)
+	if e.Title == "" && e.Detail == "" {
+		return fmt.Sprintf("cfclient: HTTP error (%d): %s", e.StatusCode, e.Status)
+	}
+	return fmt.Sprintf("cfclient: HTTP error (%d|%d|%s): %s", e.StatusCode, e.Code, e.Title, e.Detail)
 }
 
-func (c *Client) handleError(resp *http.Response) (*http.Response, error) {
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return resp, CloudFoundryHTTPError{
-			StatusCode: resp.StatusCode,
-			Status:     resp.Status,
-			Body:       string(body),
-		}
+func (e CloudFoundryHTTPError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnprocessable:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// checkResponse turn a non 2xx response into a CloudFoundryHTTPError, the body is consumed in that case
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
 	}
+	return handleError(resp)
+}
 
+// handleError build a CloudFoundryHTTPError from a response, with code, title and detail of the first error in body if any
+func handleError(resp *http.Response) error {
 	defer resp.Body.Close()
+	httpErr := CloudFoundryHTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RequestID:  resp.Header.Get(RequestIDHeader),
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return httpErr
+	}
+	httpErr.Body = string(body)
 
 	var cfErrorsV3 CloudFoundryErrorsV3
 	var cfErrorV3 CloudFoundryErrorV3
 	if err := json.Unmarshal(body, &cfErrorsV3); err != nil {
-		return resp, errors.Wrap(err, "Error unmarshalling Errors")
+		return httpErr
 	}
-
 	if len(cfErrorsV3.Errors) == 0 {
 		if err := json.Unmarshal(body, &cfErrorV3); err != nil {
-			return resp, errors.Wrap(err, "Error unmarshalling Errors")
+			return httpErr
 		}
 	} else {
 		cfErrorV3 = NewCloudFoundryErrorFromV3Errors(cfErrorsV3)
 	}
-
-	return nil, cfErrorV3
+	httpErr.Code = cfErrorV3.Code
+	httpErr.Title = cfErrorV3.Title
+	httpErr.Detail = cfErrorV3.Detail
+	return httpErr
 }
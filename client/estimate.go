@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+)
+
+// RuleEstimate is the number of rules garden writes for apps of a space on each lifecycle, rules of globally enabled
+// and bound security groups are counted once per destination and per port or port range of their lists
+type RuleEstimate struct {
+	SpaceGUID        string `json:"space_guid"`
+	SpaceName        string `json:"space_name"`
+	Running          int    `json:"running"`
+	Staging          int    `json:"staging"`
+	WarningThreshold int    `json:"warning_threshold,omitempty"`
+	HardThreshold    int    `json:"hard_threshold,omitempty"`
+	Warning          string `json:"warning,omitempty"`
+}
+
+// ExpandedCount give the number of rules garden writes for the rule, comma separated destinations and ports are multiplied out
+func (r Rule) ExpandedCount() int {
+	ports := 1
+	if r.Ports != "" {
+		ports = len(strings.Split(r.Ports, ","))
+	}
+	return len(strings.Split(r.Destination, ",")) * ports
+}
+
+// ExpandedRuleCount give the number of rules garden writes for rules, see Rule.ExpandedCount
+func ExpandedRuleCount(rules []Rule) int {
+	count := 0
+	for _, rule := range rules {
+		count += rule.ExpandedCount()
+	}
+	return count
+}
+
+// EstimateRulesWith estimate the rules of spaces using api, added is counted as bound to the spaces on lifecycles
+// when it is not nil, a security group is counted once per lifecycle even when it is also globally enabled
+func EstimateRulesWith(ctx context.Context, api API, added *SecurityGroup, lifecycles []string, spaces ...Space) (map[string]RuleEstimate, error) {
+	estimates := make(map[string]RuleEstimate, len(spaces))
+	guids := make([]string, 0, len(spaces))
+	for _, space := range spaces {
+		estimates[space.GUID] = RuleEstimate{SpaceGUID: space.GUID, SpaceName: space.Name}
+		guids = append(guids, space.GUID)
+	}
+	if len(spaces) == 0 {
+		return estimates, nil
+	}
+
+	counted := make(map[string]bool)
+	count := func(spaceGuid, lifecycle string, secGroup SecurityGroup) {
+		key := strings.Join([]string{spaceGuid, lifecycle, secGroup.GUID}, "|")
+		if counted[key] {
+			return
+		}
+		counted[key] = true
+		estimate := estimates[spaceGuid]
+		if lifecycle == LifecycleStaging {
+			estimate.Staging += ExpandedRuleCount(secGroup.Rules)
+		} else {
+			estimate.Running += ExpandedRuleCount(secGroup.Rules)
+		}
+		estimates[spaceGuid] = estimate
+	}
+
+	globals := []struct {
+		lifecycle string
+		query     ccv3.Query
+	}{
+		{LifecycleRunning, ccv3.Query{Key: ccv3.GloballyEnabledRunning, Values: []string{"true"}}},
+		{LifecycleStaging, ccv3.Query{Key: ccv3.GloballyEnabledStaging, Values: []string{"true"}}},
+	}
+	for _, global := range globals {
+		secGroups, err := api.GetSecGroupsContext(ctx, []ccv3.Query{global.query}, 0)
+		if err != nil {
+			return estimates, err
+		}
+		for _, secGroup := range secGroups.Resources {
+			for _, space := range spaces {
+				count(space.GUID, global.lifecycle, secGroup)
+			}
+		}
+	}
+
+	for _, chunk := range chunkGuids(guids) {
+		for _, lifecycle := range []string{LifecycleRunning, LifecycleStaging} {
+			filter := RunningSpaceGUIDsFilter
+			if lifecycle == LifecycleStaging {
+				filter = StagingSpaceGUIDsFilter
+			}
+			secGroups, err := api.GetSecGroupsContext(ctx, []ccv3.Query{{Key: filter, Values: chunk}}, 0)
+			if err != nil {
+				return estimates, err
+			}
+			for _, secGroup := range secGroups.Resources {
+				data := secGroup.Relationships.Running_Spaces.Data
+				if lifecycle == LifecycleStaging {
+					data = secGroup.Relationships.Staging_Spaces.Data
+				}
+				for _, d := range data {
+					if _, ok := estimates[d.GUID]; ok {
+						count(d.GUID, lifecycle, secGroup)
+					}
+				}
+			}
+		}
+	}
+
+	if added != nil {
+		for _, space := range spaces {
+			for _, lifecycle := range lifecycles {
+				count(space.GUID, lifecycle, *added)
+			}
+		}
+	}
+	return estimates, nil
+}
+
+// EstimateBinding give the rules of a space once a security group is bound to it for running and staging,
+// the security group is not bound
+func (c *Client) EstimateBinding(secGroupGUID, spaceGUID, endpoint string) (RuleEstimate, error) {
+	return c.EstimateBindingContext(context.Background(), secGroupGUID, spaceGUID, endpoint)
+}
+
+// EstimateBindingContext is like EstimateBinding, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) EstimateBindingContext(ctx context.Context, secGroupGUID, spaceGUID, endpoint string) (RuleEstimate, error) {
+	var estimate RuleEstimate
+	err := c.DoJSON(ctx, http.MethodPost, endpoint+"/v3/bindings?dry_run=true", map[string]string{
+		"security_group_guid": secGroupGUID,
+		"space_guid":          spaceGUID,
+	}, &estimate)
+	return estimate, err
+}
+
+// EstimateOrgBinding give the rules of each space of an org once a security group is bound to all of them,
+// the security group is not bound
+func (c *Client) EstimateOrgBinding(secGroupGUID, orgGUID, endpoint string) ([]RuleEstimate, error) {
+	return c.EstimateOrgBindingContext(context.Background(), secGroupGUID, orgGUID, endpoint)
+}
+
+// EstimateOrgBindingContext is like EstimateOrgBinding, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) EstimateOrgBindingContext(ctx context.Context, secGroupGUID, orgGUID, endpoint string) ([]RuleEstimate, error) {
+	var orgBinding struct {
+		RuleEstimates []RuleEstimate `json:"rule_estimates"`
+	}
+	err := c.DoJSON(ctx, http.MethodPost, endpoint+"/v3/org_bindings?dry_run=true", map[string]string{
+		"security_group_guid": secGroupGUID,
+		"organization_guid":   orgGUID,
+	}, &orgBinding)
+	return orgBinding.RuleEstimates, err
+}
@@ -1,11 +1,14 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
 	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
@@ -23,6 +26,7 @@ type NotFoundError error
 
 type Space struct {
 	resources.Space
+	CreatedAt time.Time `json:"created_at,omitzero"`
 }
 
 type Data struct {
@@ -71,24 +75,102 @@ type SecurityGroup struct {
 		} `jsonry:"staging_spaces"`
 	} `jsonry:"relationships,omitempty"`
 }
+
+// UnmarshalJSON decode a security group, globally_enabled is an object
+// which can't be decoded directly in RunningGloballyEnabled and StagingGloballyEnabled
+func (s *SecurityGroup) UnmarshalJSON(b []byte) error {
+	type secGroupAlias SecurityGroup
+	aux := struct {
+		*secGroupAlias
+		GloballyEnabled struct {
+			Running *bool `json:"running"`
+			Staging *bool `json:"staging"`
+		} `json:"globally_enabled"`
+	}{secGroupAlias: (*secGroupAlias)(s)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	s.RunningGloballyEnabled = aux.GloballyEnabled.Running
+	s.StagingGloballyEnabled = aux.GloballyEnabled.Staging
+	return nil
+}
+
+// MarshalJSON encode a security group as cloud controller does, bound spaces are only given by guid
+func (s SecurityGroup) MarshalJSON() ([]byte, error) {
+	type guid struct {
+		GUID string `json:"guid"`
+	}
+	type relationship struct {
+		Data []guid `json:"data"`
+	}
+	toRelationship := func(data []Data) relationship {
+		r := relationship{Data: make([]guid, 0, len(data))}
+		for _, d := range data {
+			r.Data = append(r.Data, guid{GUID: d.GUID})
+		}
+		return r
+	}
+	rules := s.Rules
+	if rules == nil {
+		rules = make([]Rule, 0)
+	}
+	aux := struct {
+		GUID            string `json:"guid"`
+		Name            string `json:"name"`
+		Rules           []Rule `json:"rules"`
+		GloballyEnabled struct {
+			Running bool `json:"running"`
+			Staging bool `json:"staging"`
+		} `json:"globally_enabled"`
+		Relationships struct {
+			RunningSpaces relationship `json:"running_spaces"`
+			StagingSpaces relationship `json:"staging_spaces"`
+		} `json:"relationships"`
+	}{GUID: s.GUID, Name: s.Name, Rules: rules}
+	aux.GloballyEnabled.Running = s.RunningGloballyEnabled != nil && *s.RunningGloballyEnabled
+	aux.GloballyEnabled.Staging = s.StagingGloballyEnabled != nil && *s.StagingGloballyEnabled
+	aux.Relationships.RunningSpaces = toRelationship(s.Relationships.Running_Spaces.Data)
+	aux.Relationships.StagingSpaces = toRelationship(s.Relationships.Staging_Spaces.Data)
+	return json.Marshal(aux)
+}
+
+// Rule is a rule of a security group as cloud controller gives it, Type and Code are only set
+// for icmp and icmpv6 rules, -1 meaning any type or code
 type Rule struct {
-	Protocol    string `jsonry:"protocol"`
-	Destination string `jsonry:"destination"`
-	Ports       string `jsonry:"ports,omitempty"`
+	Protocol    string `json:"protocol" jsonry:"protocol"`
+	Destination string `json:"destination" jsonry:"destination"`
+	Ports       string `json:"ports,omitempty" jsonry:"ports,omitempty"`
+	Type        *int   `json:"type,omitempty" jsonry:"type,omitempty"`
+	Code        *int   `json:"code,omitempty" jsonry:"code,omitempty"`
+	Description string `json:"description,omitempty" jsonry:"description,omitempty"`
+	Log         *bool  `json:"log,omitempty" jsonry:"log,omitempty"`
 }
 
+// User is a list of roles from /v3/roles, see RolesFilter to select them by types, users, orgs or spaces
 type User struct {
 	Paginated
-	Resources []struct {
-		GUID          string `jsonry:"guid,omitempty"`
-		CreatedAt     string `jsonry:"created_at"`
-		UpdatedAt     string `jsonry:"updated_at"`
-		Type          string `jsonry:"type,omitempty"`
-		Relationships struct {
-			User struct {
-				Data struct {
-					GUID string `jsonry:"guid"`
-				}
+	Resources []Role
+}
+
+type Role struct {
+	GUID          string `jsonry:"guid,omitempty"`
+	CreatedAt     string `jsonry:"created_at"`
+	UpdatedAt     string `jsonry:"updated_at"`
+	Type          string `jsonry:"type,omitempty"`
+	Relationships struct {
+		User struct {
+			Data struct {
+				GUID string `jsonry:"guid"`
+			}
+		}
+		Organization struct {
+			Data struct {
+				GUID string `jsonry:"guid"`
+			}
+		}
+		Space struct {
+			Data struct {
+				GUID string `jsonry:"guid"`
 			}
 		}
 	}
@@ -121,30 +203,69 @@ type UserRoles struct {
 	} `jsonry:"resources"`
 }
 
+const CreatedAtsAfterFilter ccv3.QueryKey = "created_ats[gte]"
+
 var Large = ccv3.Query{
 	Key:    ccv3.PerPage,
 	Values: []string{"5000"},
 }
 
-func (c *Client) doRequest(method string, url string, body io.Reader) ([]byte, error) {
-	client := &http.Client{Transport: &c.transport}
-	request, err := http.NewRequest(method, url, body)
+func (c *Client) doRequest(ctx context.Context, method string, url string, body io.Reader) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("Authorization", c.accessToken)
-	response, err := client.Do(request)
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		return nil, errors.Wrap(err, "http error")
+	if err = checkResponse(response); err != nil {
+		return nil, err
 	}
 	return io.ReadAll(response.Body)
 
 }
 
+// DoJSON send a request with the client token, retries and timeout, in is sent as json when not nil
+// and the json response is decoded in out when not nil, non 2xx responses give a CloudFoundryHTTPError
+func (c *Client) DoJSON(ctx context.Context, method string, url string, in any, out any) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err = checkResponse(response); err != nil {
+		return err
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, response.Body)
+		return nil
+	}
+	if err = json.NewDecoder(response.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "Error unmarshalling response")
+	}
+	return nil
+}
+
 func (c *Client) generateUrl(baseUrl string, queries []ccv3.Query, page int) string {
 	curQueries := queries
 	curQueries = append(curQueries, Large)
@@ -174,111 +295,118 @@ func QueriesToQueryString(queries []ccv3.Query) string {
 }
 
 func (c *Client) ListAllSecGroups(req *http.Request) ([]byte, error) {
-	client := &http.Client{Transport: &c.transport}
+	return c.ListAllSecGroupsContext(context.Background(), req)
+}
+
+// ListAllSecGroupsContext is like ListAllSecGroups, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) ListAllSecGroupsContext(ctx context.Context, req *http.Request) ([]byte, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	url := c.GetApiUrl() + req.URL.RequestURI()
 
-	request, err := http.NewRequest(http.MethodGet, url, nil)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	request.Header = req.Header.Clone()
-	request.Header.Set("Authorization", c.accessToken)
-
-	if err != nil {
-		return nil, err
-	}
-	response, err := client.Do(request)
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		return nil, errors.Wrap(err, "http error")
+	if err = checkResponse(response); err != nil {
+		return nil, err
 	}
 	return io.ReadAll(response.Body)
 }
 
 func (c *Client) GetSecGroups(queries []ccv3.Query, page int) (SecurityGroups, error) {
-	SecGroups := SecurityGroups{}
+	return c.GetSecGroupsContext(context.Background(), queries, page)
+}
+
+// GetSecGroupsContext is like GetSecGroups, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetSecGroupsContext(ctx context.Context, queries []ccv3.Query, page int) (SecurityGroups, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	url := c.generateUrl(c.endpoint+"/v3/security_groups", queries, page)
-	buffer, err := c.doRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return SecGroups, err
-	}
-	if err = json.Unmarshal(buffer, &SecGroups); err != nil {
-		return SecGroups, errors.Wrap(err, "Error unmarshalling Security Groups")
-	}
-	if SecGroups.Pagination.Next.HREF != "" {
-		NextPage, err := c.GetSecGroups(queries, page+1)
-		if err != nil {
-			return SecGroups, err
-		}
-		SecGroups.Resources = append(SecGroups.Resources, NextPage.Resources...)
-	}
-	return SecGroups, err
+	resources, err := collect(Paginate[SecurityGroup](ctx, c, url))
+	return SecurityGroups{Resources: resources}, err
 }
 
 func (c *Client) GetSecGroupByName(name string) (SecurityGroup, error) {
+	return c.GetSecGroupByNameContext(context.Background(), name)
+}
+
+// GetSecGroupByNameContext is like GetSecGroupByName, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetSecGroupByNameContext(ctx context.Context, name string) (SecurityGroup, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	queries := []ccv3.Query{
 		{
 			Key:    ccv3.NameFilter,
 			Values: []string{name},
 		},
 	}
-	securityGroups, err := c.GetSecGroups(queries, 0)
+	securityGroups, err := c.GetSecGroupsContext(ctx, queries, 0)
 	if err != nil {
 		return SecurityGroup{}, err
 	}
 	if len(securityGroups.Resources) == 0 {
-		return SecurityGroup{}, errors.New("security group " + name + " not found")
+		return SecurityGroup{}, fmt.Errorf("security group %s %w", name, ErrNotFound)
 	}
 	return securityGroups.Resources[0], nil
 }
 
 func (c *Client) GetSpaceByGuid(guid string) (Space, error) {
-	spaces, err := c.GetSpacesWithOrg([]ccv3.Query{{Key: ccv3.GUIDFilter, Values: []string{guid}}}, 0)
+	return c.GetSpaceByGuidContext(context.Background(), guid)
+}
+
+// GetSpaceByGuidContext is like GetSpaceByGuid, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetSpaceByGuidContext(ctx context.Context, guid string) (Space, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	spaces, err := c.GetSpacesWithOrgContext(ctx, []ccv3.Query{{Key: ccv3.GUIDFilter, Values: []string{guid}}}, 0)
 	if err != nil {
 		return Space{}, err
 	}
 	if len(spaces.Resources) == 0 {
-		return Space{}, errors.New("Space " + guid + " not found")
+		return Space{}, fmt.Errorf("space %s %w", guid, ErrNotFound)
 	}
 	return spaces.Resources[0], nil
 
 }
 
+// GetOrgManagers retrieve org manager roles of an org
 func (c *Client) GetOrgManagers(orgGuid string, page int) (User, error) {
-	user := User{}
-
-	url := c.generateUrl(c.apiUrl+"/v3/roles", []ccv3.Query{Large, {Key: ccv3.OrganizationGUIDFilter, Values: []string{orgGuid}}}, page)
-	// Fix ineffassign: properly handle the error from doRequest
-	buffer, err := c.doRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return user, err
-	}
-
-	if err = json.Unmarshal(buffer, &user); err != nil {
-		return user, errors.Wrap(err, "Error unmarshalling user roles")
-	}
+	return c.GetOrgManagersContext(context.Background(), orgGuid, page)
+}
 
-	if user.Pagination.Next.HREF != "" {
-		NextPage, err := c.GetOrgManagers(orgGuid, page+1)
-		if err != nil {
-			return user, err
-		}
-		user.Resources = append(user.Resources, NextPage.Resources...)
+// GetOrgManagersContext is like GetOrgManagers, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetOrgManagersContext(ctx context.Context, orgGuid string, page int) (User, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	filter := RolesFilter{
+		Types:             []constant.RoleType{constant.OrgManagerRole},
+		OrganizationGUIDs: []string{orgGuid},
 	}
-
-	return user, nil
+	url := c.generateUrl(c.apiUrl+"/v3/roles", filter.queries(), page)
+	resources, err := collect(Paginate[Role](ctx, c, url))
+	return User{Resources: resources}, err
 }
 
 func (c *Client) GetAccessToken() *string {
-	return &c.accessToken
+	token, err := c.token()
+	if err != nil {
+		return &c.accessToken
+	}
+	return &token
 }
 
+// SetAccessToken make the client use a fixed access token, it replaces any token source
 func (c *Client) SetAccessToken(accessToken string) {
 	c.accessToken = accessToken
+	c.tokenSource = nil
 }
 
 func (c *Client) GetApiUrl() string {
@@ -290,30 +418,51 @@ func (c *Client) GetEndpoint() string {
 }
 
 func (c *Client) GetSpacesWithOrg(queries []ccv3.Query, page int) (Spaces, error) {
+	return c.GetSpacesWithOrgContext(context.Background(), queries, page)
+}
+
+// GetSpacesWithOrgContext is like GetSpacesWithOrg, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetSpacesWithOrgContext(ctx context.Context, queries []ccv3.Query, page int) (Spaces, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	curQueries := queries
 	curQueries = append(curQueries, ccv3.Query{Key: ccv3.Include, Values: []string{"organization"}})
 	curQueries = append(curQueries, Large)
-	var spaces Spaces
+	spaces := Spaces{Resources: make([]Space, 0)}
 	url := c.generateUrl(c.apiUrl+"/v3/spaces", curQueries, page)
-	buffer, err := c.doRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return spaces, err
-	}
-	if err = json.Unmarshal(buffer, &spaces); err != nil {
-		return spaces, errors.Wrap(err, "Error unmarshalling Spaces")
-	}
-	if spaces.Pagination.Next.HREF != "" {
-		NextPage, err := c.GetSpacesWithOrg(queries, page+1)
+	for spacesPage, err := range PaginatePages[Space](ctx, c, url) {
 		if err != nil {
 			return spaces, err
 		}
-		spaces.Resources = append(spaces.Resources, NextPage.Resources...)
-		spaces.Included.Organizations = append(spaces.Included.Organizations, NextPage.Included.Organizations...)
+		spaces.Resources = append(spaces.Resources, spacesPage.Resources...)
+		spaces.Included.Organizations = append(spaces.Included.Organizations, spacesPage.Included.Organizations...)
 	}
 	return spaces, nil
 }
 
+// GetSpacesCreatedAfter list spaces of orgs created at or after a given time
+func (c *Client) GetSpacesCreatedAfter(orgGuids []string, after time.Time) (Spaces, error) {
+	return c.GetSpacesCreatedAfterContext(context.Background(), orgGuids, after)
+}
+
+// GetSpacesCreatedAfterContext is like GetSpacesCreatedAfter, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetSpacesCreatedAfterContext(ctx context.Context, orgGuids []string, after time.Time) (Spaces, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.GetSpacesWithOrgContext(ctx, []ccv3.Query{
+		{Key: ccv3.OrganizationGUIDFilter, Values: orgGuids},
+		{Key: CreatedAtsAfterFilter, Values: []string{after.UTC().Format(time.RFC3339)}},
+	}, 0)
+}
+
 func (c *Client) GetSecGroupSpaces(secGroup *SecurityGroup) (Spaces, error) {
+	return c.GetSecGroupSpacesContext(context.Background(), secGroup)
+}
+
+// GetSecGroupSpacesContext is like GetSecGroupSpaces, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetSecGroupSpacesContext(ctx context.Context, secGroup *SecurityGroup) (Spaces, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 	var runningSpaceGuids []string
 	var stagingSpaceGuids []string
 	for _, data := range secGroup.Relationships.Running_Spaces.Data {
@@ -323,6 +472,9 @@ func (c *Client) GetSecGroupSpaces(secGroup *SecurityGroup) (Spaces, error) {
 		stagingSpaceGuids = append(stagingSpaceGuids, data.GUID)
 	}
 	spaceGuids := append(runningSpaceGuids, stagingSpaceGuids...)
+	if len(spaceGuids) == 0 {
+		return Spaces{}, nil
+	}
 	if len(spaceGuids) >= 50 {
 		// chunk spacesGuids
 		var spaces Spaces
@@ -331,7 +483,7 @@ func (c *Client) GetSecGroupSpaces(secGroup *SecurityGroup) (Spaces, error) {
 			if end > len(spaceGuids) {
 				end = len(spaceGuids)
 			}
-			spacesChunk, err := c.GetSpacesWithOrg([]ccv3.Query{{Key: ccv3.GUIDFilter, Values: spaceGuids[i:end]}, {Key: ccv3.Include, Values: []string{"organization"}}}, 0)
+			spacesChunk, err := c.GetSpacesWithOrgContext(ctx, []ccv3.Query{{Key: ccv3.GUIDFilter, Values: spaceGuids[i:end]}, {Key: ccv3.Include, Values: []string{"organization"}}}, 0)
 			if err != nil {
 				return spaces, err
 			}
@@ -340,10 +492,15 @@ func (c *Client) GetSecGroupSpaces(secGroup *SecurityGroup) (Spaces, error) {
 		}
 		return spaces, nil
 	}
-	return c.GetSpacesWithOrg([]ccv3.Query{{Key: ccv3.GUIDFilter, Values: spaceGuids}, {Key: ccv3.Include, Values: []string{"organization"}}}, 0)
+	return c.GetSpacesWithOrgContext(ctx, []ccv3.Query{{Key: ccv3.GUIDFilter, Values: spaceGuids}, {Key: ccv3.Include, Values: []string{"organization"}}}, 0)
 }
 
 func (c *Client) AddSecGroupRelationShips(secGroup *SecurityGroup, spaces Spaces) error {
+	return addSecGroupRelationShips(secGroup, spaces)
+}
+
+// addSecGroupRelationShips fill space, org names and org guid of bound spaces of a security group from spaces
+func addSecGroupRelationShips(secGroup *SecurityGroup, spaces Spaces) error {
 	for _, space := range spaces.Resources {
 		var orgName string
 		var orgGuid string
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+)
+
+// Inventory counts security groups of a foundation and their bindings to spaces
+type Inventory struct {
+	SecurityGroups int `json:"security_groups"`
+	// GloballyEnabled is the number of globally enabled security groups by lifecycle
+	GloballyEnabled map[string]int `json:"globally_enabled"`
+	// WideOpen is the number of security groups having a wide open rule, see Rule.WideOpen
+	WideOpen int `json:"wide_open"`
+	// Bindings is the number of security groups bound to spaces by org name and lifecycle
+	Bindings      map[string]map[string]int `json:"bindings"`
+	Spaces        int                       `json:"spaces"`
+	UnboundSpaces int                       `json:"unbound_spaces"`
+}
+
+// InventoryLimits abandon an inventory of a foundation having more security groups or spaces, 0 means no limit
+type InventoryLimits struct {
+	MaxSecurityGroups int
+	MaxSpaces         int
+}
+
+// TakeInventoryWith count security groups and their bindings using api, spaces without any security group bound
+// on running or staging are unbound, globally enabled security groups are not counted as bound
+func TakeInventoryWith(ctx context.Context, api API, limits InventoryLimits) (Inventory, error) {
+	inventory := Inventory{
+		GloballyEnabled: map[string]int{LifecycleRunning: 0, LifecycleStaging: 0},
+		Bindings:        make(map[string]map[string]int),
+	}
+	// spaces are listed page by page to stop as soon as there are too many
+	orgNames := make(map[string]string)
+	spaceOrgs := make(map[string]string)
+	for page, err := range api.IterSpacePagesWithOrg(ctx, []ccv3.Query{}) {
+		if err != nil {
+			return inventory, err
+		}
+		for _, org := range page.Included.Organizations {
+			orgNames[org.GUID] = org.Name
+		}
+		for _, space := range page.Resources {
+			orgGuid := space.Relationships[constant.RelationshipTypeOrganization].GUID
+			if orgNames[orgGuid] == "" {
+				orgNames[orgGuid] = orgGuid
+			}
+			spaceOrgs[space.GUID] = orgNames[orgGuid]
+		}
+		inventory.Spaces += len(page.Resources)
+		if limits.MaxSpaces > 0 && inventory.Spaces > limits.MaxSpaces {
+			return inventory, fmt.Errorf("inventory abandoned, more than %d spaces found", limits.MaxSpaces)
+		}
+	}
+
+	bound := make(map[string]bool)
+	for secGroup, err := range api.IterSecGroups(ctx, []ccv3.Query{}) {
+		if err != nil {
+			return inventory, err
+		}
+		inventory.SecurityGroups++
+		if limits.MaxSecurityGroups > 0 && inventory.SecurityGroups > limits.MaxSecurityGroups {
+			return inventory, fmt.Errorf("inventory abandoned, more than %d security groups found", limits.MaxSecurityGroups)
+		}
+		if secGroup.RunningGloballyEnabled != nil && *secGroup.RunningGloballyEnabled {
+			inventory.GloballyEnabled[LifecycleRunning]++
+		}
+		if secGroup.StagingGloballyEnabled != nil && *secGroup.StagingGloballyEnabled {
+			inventory.GloballyEnabled[LifecycleStaging]++
+		}
+		for _, rule := range secGroup.Rules {
+			if rule.WideOpen() {
+				inventory.WideOpen++
+				break
+			}
+		}
+		relationships := map[string][]Data{
+			LifecycleRunning: secGroup.Relationships.Running_Spaces.Data,
+			LifecycleStaging: secGroup.Relationships.Staging_Spaces.Data,
+		}
+		for lifecycle, data := range relationships {
+			for _, d := range data {
+				org, ok := spaceOrgs[d.GUID]
+				if !ok {
+					// space created after spaces were listed
+					continue
+				}
+				if inventory.Bindings[org] == nil {
+					inventory.Bindings[org] = make(map[string]int)
+				}
+				inventory.Bindings[org][lifecycle]++
+				bound[d.GUID] = true
+			}
+		}
+	}
+	inventory.UnboundSpaces = inventory.Spaces - len(bound)
+	return inventory, nil
+}
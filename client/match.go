@@ -0,0 +1,313 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProtocolAll    = "all"
+	ProtocolTCP    = "tcp"
+	ProtocolUDP    = "udp"
+	ProtocolICMP   = "icmp"
+	ProtocolICMPv6 = "icmpv6"
+)
+
+// ValidProtocol check if a protocol can be used in a security group rule
+func ValidProtocol(protocol string) bool {
+	switch protocol {
+	case ProtocolAll, ProtocolTCP, ProtocolUDP, ProtocolICMP, ProtocolICMPv6:
+		return true
+	}
+	return false
+}
+
+// ParsePort parse a port given by a user, an empty port is returned as 0 which means any port
+func ParsePort(port string) (int, error) {
+	if port == "" {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return 0, fmt.Errorf("invalid port '%s'", port)
+	}
+	return p, nil
+}
+
+// Allows check if the rule let traffic go to ip and port with the given protocol, a port 0 means any port
+func (r Rule) Allows(ip net.IP, port int, protocol string) bool {
+	return r.AllowsProtocol(protocol) && r.ContainsIP(ip) && r.ContainsPort(port)
+}
+
+// AllowsProtocol check if the rule protocol match the given protocol
+func (r Rule) AllowsProtocol(protocol string) bool {
+	return r.Protocol == ProtocolAll || protocol == "" || strings.EqualFold(r.Protocol, protocol)
+}
+
+// ContainsIP check if the rule destination contains ip,
+// a destination is a comma separated list of ips, cidrs or ip ranges
+func (r Rule) ContainsIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	return r.OverlapsNet(&net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+}
+
+// OverlapsNet check if the rule destination share at least one address with ipNet
+func (r Rule) OverlapsNet(ipNet *net.IPNet) bool {
+	netFirst, netLast := netBounds(ipNet)
+	for _, destination := range strings.Split(r.Destination, ",") {
+		first, last, ok := destinationBounds(strings.TrimSpace(destination))
+		if !ok {
+			continue
+		}
+		if bytes.Compare(first, netLast) <= 0 && bytes.Compare(last, netFirst) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsPort check if the rule ports contain port, rules without ports or a port 0 match any port
+func (r Rule) ContainsPort(port int) bool {
+	if port == 0 || r.Ports == "" || r.Protocol == ProtocolICMP || r.Protocol == ProtocolICMPv6 {
+		return true
+	}
+	for _, ports := range strings.Split(r.Ports, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(ports), "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				continue
+			}
+		}
+		if port >= start && port <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate check the syntax of the rule as cloud controller would: a known protocol,
+// destinations being ips, cidrs or ip ranges, ports or port ranges for tcp and udp
+// and type and code, between -1 and 255, required for icmp and icmpv6
+func (r Rule) Validate() error {
+	if !ValidProtocol(r.Protocol) {
+		return fmt.Errorf("invalid protocol '%s'", r.Protocol)
+	}
+	icmp := r.Protocol == ProtocolICMP || r.Protocol == ProtocolICMPv6
+	if icmp && (r.Type == nil || r.Code == nil) {
+		return fmt.Errorf("type and code are required with protocol %s", r.Protocol)
+	}
+	if !icmp && (r.Type != nil || r.Code != nil) {
+		return fmt.Errorf("type and code are only allowed with protocols icmp and icmpv6")
+	}
+	if r.Type != nil && (*r.Type < -1 || *r.Type > 255) {
+		return fmt.Errorf("invalid type %d", *r.Type)
+	}
+	if r.Code != nil && (*r.Code < -1 || *r.Code > 255) {
+		return fmt.Errorf("invalid code %d", *r.Code)
+	}
+	if strings.TrimSpace(r.Destination) == "" {
+		return fmt.Errorf("destination is required")
+	}
+	for _, destination := range strings.Split(r.Destination, ",") {
+		first, last, ok := destinationBounds(strings.TrimSpace(destination))
+		if !ok || bytes.Compare(first, last) > 0 {
+			return fmt.Errorf("invalid destination '%s'", strings.TrimSpace(destination))
+		}
+	}
+	if r.Ports == "" {
+		return nil
+	}
+	if r.Protocol != ProtocolTCP && r.Protocol != ProtocolUDP {
+		return fmt.Errorf("ports are only allowed with protocols tcp and udp")
+	}
+	if _, ok := parsePortRanges(r.Ports); !ok {
+		return fmt.Errorf("invalid ports '%s'", r.Ports)
+	}
+	return nil
+}
+
+// OverlapsPorts check if the rule ports share at least one port with ports, given in the same format,
+// empty ports on either side mean any port. Icmp rules have no ports and only overlap empty ports.
+// Ports which can't be parsed are considered to overlap.
+func (r Rule) OverlapsPorts(ports string) bool {
+	if ports == "" {
+		return true
+	}
+	if r.Protocol == ProtocolICMP || r.Protocol == ProtocolICMPv6 {
+		return false
+	}
+	if r.Ports == "" {
+		return true
+	}
+	ruleRanges, ok := parsePortRanges(r.Ports)
+	if !ok {
+		return true
+	}
+	otherRanges, ok := parsePortRanges(ports)
+	if !ok {
+		return true
+	}
+	for _, ruleRange := range ruleRanges {
+		for _, otherRange := range otherRanges {
+			if ruleRange[0] <= otherRange[1] && ruleRange[1] >= otherRange[0] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithinNets check if every ip, cidr or ip range of the rule destination is fully contained in one of ipNets,
+// a destination which can't be parsed is never contained
+func (r Rule) WithinNets(ipNets []*net.IPNet) bool {
+	for _, destination := range strings.Split(r.Destination, ",") {
+		first, last, ok := destinationBounds(strings.TrimSpace(destination))
+		if !ok {
+			return false
+		}
+		contained := false
+		for _, ipNet := range ipNets {
+			netFirst, netLast := netBounds(ipNet)
+			if bytes.Compare(first, netFirst) >= 0 && bytes.Compare(last, netLast) <= 0 {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	return true
+}
+
+// WithinPorts check if every port or port range of the rule is contained in the allowed ports,
+// given in the same format as rule ports, a rule without ports means any port and is only within an empty allowed list.
+// Icmp rules have no ports and are always within.
+func (r Rule) WithinPorts(allowed string) bool {
+	if allowed == "" || r.Protocol == ProtocolICMP || r.Protocol == ProtocolICMPv6 {
+		return true
+	}
+	if r.Ports == "" {
+		return false
+	}
+	allowedRanges, ok := parsePortRanges(allowed)
+	if !ok {
+		return false
+	}
+	ruleRanges, ok := parsePortRanges(r.Ports)
+	if !ok {
+		return false
+	}
+	for _, ruleRange := range ruleRanges {
+		contained := false
+		for _, allowedRange := range allowedRanges {
+			if ruleRange[0] >= allowedRange[0] && ruleRange[1] <= allowedRange[1] {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	return true
+}
+
+// WideOpen check if the rule let traffic go to any ipv4 address on any port, like 0.0.0.0/0 with protocol all,
+// tcp or udp rules without ports or with the range 1-65535 are wide open too
+func (r Rule) WideOpen() bool {
+	if r.Protocol != ProtocolAll && r.Protocol != ProtocolTCP && r.Protocol != ProtocolUDP {
+		return false
+	}
+	if r.Protocol != ProtocolAll && !(Rule{Protocol: r.Protocol, Ports: "1-65535"}).WithinPorts(r.Ports) {
+		return false
+	}
+	netFirst, netLast := netBounds(&net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)})
+	for _, destination := range strings.Split(r.Destination, ",") {
+		first, last, ok := destinationBounds(strings.TrimSpace(destination))
+		if ok && bytes.Compare(first, netFirst) <= 0 && bytes.Compare(last, netLast) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePortRanges parse comma separated ports and port ranges as [start, end] pairs
+func parsePortRanges(ports string) ([][2]int, bool) {
+	ranges := make([][2]int, 0)
+	for _, ports := range strings.Split(ports, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(ports), "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil || start < 1 || start > 65535 {
+			return nil, false
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil || end < start || end > 65535 {
+				return nil, false
+			}
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, true
+}
+
+// ParseDestination parse an ip or a cidr given by a user as a network
+func ParseDestination(destination string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(destination)
+	if err == nil {
+		return ipNet, nil
+	}
+	ip := net.ParseIP(destination)
+	if ip == nil {
+		return nil, fmt.Errorf("destination must be a valid ip or cidr, got '%s'", destination)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
+}
+
+// destinationBounds give first and last ip of a destination which can be an ip, a cidr or an ip range
+func destinationBounds(destination string) (net.IP, net.IP, bool) {
+	_, ipNet, err := net.ParseCIDR(destination)
+	if err == nil {
+		first, last := netBounds(ipNet)
+		return first, last, true
+	}
+	ips := strings.Split(destination, "-")
+	if len(ips) == 2 {
+		startIp := net.ParseIP(strings.TrimSpace(ips[0]))
+		endIp := net.ParseIP(strings.TrimSpace(ips[1]))
+		if startIp == nil || endIp == nil {
+			return nil, nil, false
+		}
+		return startIp.To16(), endIp.To16(), true
+	}
+	ip := net.ParseIP(destination)
+	if ip == nil {
+		return nil, nil, false
+	}
+	return ip.To16(), ip.To16(), true
+}
+
+func netBounds(ipNet *net.IPNet) (net.IP, net.IP) {
+	first := ipNet.IP.Mask(ipNet.Mask)
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^ipNet.Mask[i]
+	}
+	return first.To16(), last.To16()
+}
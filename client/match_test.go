@@ -0,0 +1,99 @@
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRuleOverlapsNet(t *testing.T) {
+	tests := []struct {
+		destination string
+		net         string
+		want        bool
+	}{
+		{destination: "10.0.0.1", net: "10.0.0.0/24", want: true},
+		{destination: "10.0.1.1", net: "10.0.0.0/24", want: false},
+		{destination: "10.0.0.0/8", net: "10.20.0.0/16", want: true},
+		{destination: "10.20.0.0/16", net: "10.0.0.0/8", want: true},
+		{destination: "10.0.0.0/24", net: "10.0.1.0/24", want: false},
+		{destination: "8.8.8.8, 10.0.0.1", net: "10.0.0.1/32", want: true},
+		{destination: "8.8.8.8,9.9.9.9", net: "10.0.0.0/8", want: false},
+		{destination: "10.0.0.250-10.0.1.5", net: "10.0.1.0/24", want: true},
+		{destination: "10.0.0.1-10.0.0.9", net: "10.0.0.10/32", want: false},
+		{destination: "10.0.0.10-10.0.0.20", net: "10.0.0.10/32", want: true},
+		{destination: "not-an-ip, 10.0.0.1", net: "10.0.0.0/24", want: true},
+		{destination: "not-an-ip", net: "0.0.0.0/0", want: false},
+	}
+	for _, tt := range tests {
+		_, ipNet, err := net.ParseCIDR(tt.net)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := (Rule{Destination: tt.destination}).OverlapsNet(ipNet); got != tt.want {
+			t.Errorf("%s overlaps %s = %v, want %v", tt.destination, tt.net, got, tt.want)
+		}
+	}
+}
+
+func TestRuleOverlapsPorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		ports string
+		want  bool
+	}{
+		{name: "any port asked", rule: Rule{Protocol: ProtocolTCP, Ports: "443"}, ports: "", want: true},
+		{name: "rule without ports", rule: Rule{Protocol: ProtocolTCP}, ports: "443", want: true},
+		{name: "same port", rule: Rule{Protocol: ProtocolTCP, Ports: "443"}, ports: "443", want: true},
+		{name: "other port", rule: Rule{Protocol: ProtocolTCP, Ports: "80"}, ports: "443", want: false},
+		{name: "range overlapping", rule: Rule{Protocol: ProtocolUDP, Ports: "1000-2000"}, ports: "1999-3000", want: true},
+		{name: "ranges touching", rule: Rule{Protocol: ProtocolTCP, Ports: "1000-2000"}, ports: "2000", want: true},
+		{name: "ranges apart", rule: Rule{Protocol: ProtocolTCP, Ports: "1000-2000"}, ports: "2001-3000", want: false},
+		{name: "lists with one common port", rule: Rule{Protocol: ProtocolTCP, Ports: "22, 80,443"}, ports: "8080,443", want: true},
+		{name: "lists apart", rule: Rule{Protocol: ProtocolTCP, Ports: "22,80"}, ports: "443,8000-8100", want: false},
+		{name: "icmp", rule: Rule{Protocol: ProtocolICMP}, ports: "443", want: false},
+		{name: "icmp on any port", rule: Rule{Protocol: ProtocolICMPv6}, ports: "", want: true},
+		{name: "protocol all without ports", rule: Rule{Protocol: ProtocolAll}, ports: "443", want: true},
+		{name: "unparsable ports", rule: Rule{Protocol: ProtocolTCP, Ports: "https"}, ports: "443", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.OverlapsPorts(tt.ports); got != tt.want {
+				t.Errorf("OverlapsPorts(%q) = %v, want %v", tt.ports, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	anyValue, echo, tooBig := -1, 8, 256
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "tcp with ports", rule: Rule{Protocol: ProtocolTCP, Destination: "10.0.0.1", Ports: "443,8000-8100"}},
+		{name: "all without ports", rule: Rule{Protocol: ProtocolAll, Destination: "10.0.0.0/8"}},
+		{name: "comma list and range", rule: Rule{Protocol: ProtocolUDP, Destination: "10.0.0.1, 10.0.1.1-10.0.1.9", Ports: "53"}},
+		{name: "icmp with type and code", rule: Rule{Protocol: ProtocolICMP, Destination: "10.0.0.1", Type: &echo, Code: &anyValue}},
+		{name: "icmpv6 with type and code", rule: Rule{Protocol: ProtocolICMPv6, Destination: "::1", Type: &anyValue, Code: &anyValue}},
+		{name: "unknown protocol", rule: Rule{Protocol: "sctp", Destination: "10.0.0.1"}, wantErr: true},
+		{name: "no destination", rule: Rule{Protocol: ProtocolTCP}, wantErr: true},
+		{name: "invalid destination", rule: Rule{Protocol: ProtocolTCP, Destination: "10.0.0.300"}, wantErr: true},
+		{name: "reversed range", rule: Rule{Protocol: ProtocolTCP, Destination: "10.0.0.9-10.0.0.1"}, wantErr: true},
+		{name: "ports with all", rule: Rule{Protocol: ProtocolAll, Destination: "10.0.0.1", Ports: "443"}, wantErr: true},
+		{name: "invalid ports", rule: Rule{Protocol: ProtocolTCP, Destination: "10.0.0.1", Ports: "0-80"}, wantErr: true},
+		{name: "icmp without type", rule: Rule{Protocol: ProtocolICMP, Destination: "10.0.0.1", Code: &anyValue}, wantErr: true},
+		{name: "icmp without code", rule: Rule{Protocol: ProtocolICMP, Destination: "10.0.0.1", Type: &echo}, wantErr: true},
+		{name: "icmp with invalid type", rule: Rule{Protocol: ProtocolICMP, Destination: "10.0.0.1", Type: &tooBig, Code: &anyValue}, wantErr: true},
+		{name: "type with tcp", rule: Rule{Protocol: ProtocolTCP, Destination: "10.0.0.1", Type: &echo, Code: &anyValue}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
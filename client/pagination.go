@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"github.com/pkg/errors"
+)
+
+// Page is one page of a cloud foundry list
+type Page[T any] struct {
+	Paginated
+	Resources []T                    `json:"resources"`
+	Included  ccv3.IncludedResources `json:"included"`
+}
+
+// PaginatePages iterate over pages of a cloud foundry list starting at firstUrl and following next links,
+// next links are requested on the host of firstUrl as cfsecurity server proxies some lists of cloud controller.
+// Iteration stops at the first error, the client timeout applies to the whole iteration.
+func PaginatePages[T any](ctx context.Context, c *Client, firstUrl string) iter.Seq2[Page[T], error] {
+	return func(yield func(Page[T], error) bool) {
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		nextUrl := firstUrl
+		for nextUrl != "" {
+			var page Page[T]
+			buffer, err := c.doRequest(ctx, http.MethodGet, nextUrl, nil)
+			if err != nil {
+				yield(page, err)
+				return
+			}
+			if err = json.Unmarshal(buffer, &page); err != nil {
+				yield(page, errors.Wrap(err, "Error unmarshalling page"))
+				return
+			}
+			if !yield(page, nil) {
+				return
+			}
+			nextUrl, err = rebaseUrl(firstUrl, page.Pagination.Next.HREF)
+			if err != nil {
+				yield(Page[T]{}, err)
+				return
+			}
+		}
+	}
+}
+
+// Paginate iterate over resources of a cloud foundry list, see PaginatePages
+func Paginate[T any](ctx context.Context, c *Client, firstUrl string) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range PaginatePages[T](ctx, c, firstUrl) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, resource := range page.Resources {
+				if !yield(resource, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// IterSecGroups iterate over security groups matching queries
+func (c *Client) IterSecGroups(ctx context.Context, queries []ccv3.Query) iter.Seq2[SecurityGroup, error] {
+	return Paginate[SecurityGroup](ctx, c, c.generateUrl(c.endpoint+"/v3/security_groups", queries, 0))
+}
+
+// IterSpacePagesWithOrg iterate over pages of spaces matching queries, each page includes the orgs of its spaces
+func (c *Client) IterSpacePagesWithOrg(ctx context.Context, queries []ccv3.Query) iter.Seq2[Page[Space], error] {
+	curQueries := append(slices.Clone(queries), ccv3.Query{Key: ccv3.Include, Values: []string{"organization"}})
+	return PaginatePages[Space](ctx, c, c.generateUrl(c.apiUrl+"/v3/spaces", curQueries, 0))
+}
+
+// IterRoles iterate over roles matching filter, organization and space guids are sent by batches
+func (c *Client) IterRoles(ctx context.Context, filter RolesFilter) iter.Seq2[Role, error] {
+	return func(yield func(Role, error) bool) {
+		for _, orgGuids := range chunkGuids(filter.OrganizationGUIDs) {
+			for _, spaceGuids := range chunkGuids(filter.SpaceGUIDs) {
+				batch := filter
+				batch.OrganizationGUIDs = orgGuids
+				batch.SpaceGUIDs = spaceGuids
+				url := c.generateUrl(c.apiUrl+"/v3/roles", batch.queries(), 0)
+				for role, err := range Paginate[Role](ctx, c, url) {
+					if !yield(role, err) || err != nil {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// collect gather all resources of a list
+func collect[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	resources := make([]T, 0)
+	for resource, err := range seq {
+		if err != nil {
+			return resources, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// rebaseUrl give next url with scheme and host of base url, an empty next means there is no next page
+func rebaseUrl(baseUrl string, next string) (string, error) {
+	if next == "" {
+		return "", nil
+	}
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return "", err
+	}
+	nextUrl, err := url.Parse(next)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid next page link")
+	}
+	nextUrl.Scheme = base.Scheme
+	nextUrl.Host = base.Host
+	nextUrl.User = base.User
+	return nextUrl.String(), nil
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"github.com/pkg/errors"
+)
+
+// SpaceAccess is a space, or all spaces for globally enabled security groups,
+// which can reach a destination through a security group rule
+type SpaceAccess struct {
+	OrganizationGUID  string `json:"organization_guid,omitempty"`
+	OrganizationName  string `json:"organization_name,omitempty"`
+	SpaceGUID         string `json:"space_guid,omitempty"`
+	SpaceName         string `json:"space_name,omitempty"`
+	Lifecycle         string `json:"lifecycle"`
+	SecurityGroupGUID string `json:"security_group_guid"`
+	SecurityGroupName string `json:"security_group_name"`
+	Rule              Rule   `json:"rule"`
+}
+
+type SpacesAccess struct {
+	Destination          string        `json:"destination"`
+	Port                 int           `json:"port,omitempty"`
+	Protocol             string        `json:"protocol"`
+	GlobalSecurityGroups []SpaceAccess `json:"global_security_groups"`
+	Spaces               []SpaceAccess `json:"spaces"`
+}
+
+// BuildSpacesAccess list spaces which can reach a destination network, a port 0 means any port
+func (c *Client) BuildSpacesAccess(ipNet *net.IPNet, port int, protocol string) (SpacesAccess, error) {
+	return c.BuildSpacesAccessContext(context.Background(), ipNet, port, protocol)
+}
+
+// BuildSpacesAccessContext is like BuildSpacesAccess, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) BuildSpacesAccessContext(ctx context.Context, ipNet *net.IPNet, port int, protocol string) (SpacesAccess, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return BuildSpacesAccessWith(ctx, c, ipNet, port, protocol)
+}
+
+// BuildSpacesAccessWith list spaces which can reach a destination network using api, see BuildSpacesAccess
+func BuildSpacesAccessWith(ctx context.Context, api API, ipNet *net.IPNet, port int, protocol string) (SpacesAccess, error) {
+	access := SpacesAccess{
+		Destination:          ipNet.String(),
+		Port:                 port,
+		Protocol:             protocol,
+		GlobalSecurityGroups: make([]SpaceAccess, 0),
+		Spaces:               make([]SpaceAccess, 0),
+	}
+	for secGroup, err := range api.IterSecGroups(ctx, []ccv3.Query{}) {
+		if err != nil {
+			return access, err
+		}
+		var matchedRule *Rule
+		for _, rule := range secGroup.Rules {
+			if rule.AllowsProtocol(protocol) && rule.ContainsPort(port) && rule.OverlapsNet(ipNet) {
+				matchedRule = &rule
+				break
+			}
+		}
+		if matchedRule == nil {
+			continue
+		}
+
+		globals := map[string]*bool{
+			LifecycleRunning: secGroup.RunningGloballyEnabled,
+			LifecycleStaging: secGroup.StagingGloballyEnabled,
+		}
+		for _, lifecycle := range []string{LifecycleRunning, LifecycleStaging} {
+			if globals[lifecycle] != nil && *globals[lifecycle] {
+				access.GlobalSecurityGroups = append(access.GlobalSecurityGroups, SpaceAccess{
+					Lifecycle:         lifecycle,
+					SecurityGroupGUID: secGroup.GUID,
+					SecurityGroupName: secGroup.Name,
+					Rule:              *matchedRule,
+				})
+			}
+		}
+
+		spaces, err := api.GetSecGroupSpacesContext(ctx, &secGroup)
+		if err != nil {
+			return access, err
+		}
+		err = addSecGroupRelationShips(&secGroup, spaces)
+		if err != nil {
+			return access, err
+		}
+		relationships := map[string][]Data{
+			LifecycleRunning: secGroup.Relationships.Running_Spaces.Data,
+			LifecycleStaging: secGroup.Relationships.Staging_Spaces.Data,
+		}
+		for _, lifecycle := range []string{LifecycleRunning, LifecycleStaging} {
+			for _, data := range relationships[lifecycle] {
+				access.Spaces = append(access.Spaces, SpaceAccess{
+					OrganizationGUID:  data.OrgGUID,
+					OrganizationName:  data.OrgName,
+					SpaceGUID:         data.GUID,
+					SpaceName:         data.SpaceName,
+					Lifecycle:         lifecycle,
+					SecurityGroupGUID: secGroup.GUID,
+					SecurityGroupName: secGroup.Name,
+					Rule:              *matchedRule,
+				})
+			}
+		}
+	}
+	return access, nil
+}
+
+// GetSpacesAccess ask cfsecurity server which spaces can reach a destination
+func (c *Client) GetSpacesAccess(destination string, port int, protocol string) (SpacesAccess, error) {
+	return c.GetSpacesAccessContext(context.Background(), destination, port, protocol)
+}
+
+// GetSpacesAccessContext is like GetSpacesAccess, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetSpacesAccessContext(ctx context.Context, destination string, port int, protocol string) (SpacesAccess, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var access SpacesAccess
+	query := url.Values{}
+	query.Set("destination", destination)
+	if port > 0 {
+		query.Set("port", strconv.Itoa(port))
+	}
+	if protocol != "" {
+		query.Set("protocol", protocol)
+	}
+	buffer, err := c.doRequest(ctx, http.MethodGet, c.endpoint+"/v3/reachable_spaces?"+query.Encode(), nil)
+	if err != nil {
+		return access, err
+	}
+	if err = json.Unmarshal(buffer, &access); err != nil {
+		return access, errors.Wrap(err, "Error unmarshalling spaces access")
+	}
+	return access, nil
+}
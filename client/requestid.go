@@ -0,0 +1,21 @@
+package client
+
+import (
+	"context"
+)
+
+// RequestIDHeader is the header correlating a request with the calls made for it, cloud controller logs it and sends it back
+const RequestIDHeader = "X-Vcap-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID give a context whose calls made by the client carry the request id in RequestIDHeader
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext give the request id set with WithRequestID, it is empty when there is none
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
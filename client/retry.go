@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryPolicy set how requests failing with a transient error are sent again, idempotent requests are retried
+// on network errors and 429, 502, 503 and 504 responses, other requests only on 429 and on 503 with a Retry-After.
+// Posts binding a space to a security group are idempotent, binding an already bound space doesn't change anything.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of times a request is sent, 1 or less disable retries
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, it doubles at each retry
+	InitialBackoff time.Duration
+	// MaxBackoff cap the wait between two attempts
+	MaxBackoff time.Duration
+	// MaxElapsed is the time after which no more attempt is made, 0 means no limit
+	MaxElapsed time.Duration
+	// OnRetry is called before waiting for the next attempt
+	OnRetry func(RetryEvent)
+}
+
+// RetryEvent describe a failed attempt which is going to be retried
+type RetryEvent struct {
+	Method     string
+	URL        string
+	Attempt    int
+	StatusCode int
+	Err        error
+	Wait       time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		MaxElapsed:     30 * time.Second,
+	}
+}
+
+// SetRetryPolicy change how requests made by the client are retried
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retryPolicy = policy
+}
+
+// do send a request, retrying it as set in the client retry policy, the call and its retries are traced in one span
+// and given to the call observer
+func (c *Client) do(request *http.Request) (resp *http.Response, err error) {
+	request, span := startCallSpan(request)
+	start := time.Now()
+	defer func() {
+		endCallSpan(span, resp, err)
+		if c.onCall == nil {
+			return
+		}
+		event := CallEvent{Operation: operationOf(request), Err: err, Duration: time.Since(start)}
+		if resp != nil {
+			event.StatusCode = resp.StatusCode
+		}
+		c.onCall(event)
+	}()
+	policy := c.retryPolicy
+	for attempt := 1; ; attempt++ {
+		resp, err = c.send(request)
+		if attempt >= policy.MaxAttempts || !retryable(request, resp, err) {
+			return resp, err
+		}
+		if request.Body != nil && request.GetBody == nil {
+			return resp, err
+		}
+
+		wait := policy.backoff(attempt)
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+		}
+		if policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.Int("http.response.status_code", statusCode),
+			attribute.String("wait", wait.String()),
+		))
+		if policy.OnRetry != nil {
+			policy.OnRetry(RetryEvent{
+				Method:     request.Method,
+				URL:        request.URL.String(),
+				Attempt:    attempt,
+				StatusCode: statusCode,
+				Err:        err,
+				Wait:       wait,
+			})
+		}
+		if err := sleepContext(request.Context(), wait); err != nil {
+			return nil, err
+		}
+		if request.GetBody != nil {
+			request.Body, err = request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryable check if a failed attempt can be sent again: a request refused with 429, or with 503 and a Retry-After,
+// was not processed, but after a network error, a 502 or a 504 it may have been and only idempotent requests are retried
+func retryable(request *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return request.Context().Err() == nil && idempotent(request)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return idempotent(request) || resp.Header.Get("Retry-After") != ""
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(request)
+	}
+	return false
+}
+
+type idempotentKey struct{}
+
+// withIdempotent give a context whose requests are idempotent whatever their method
+func withIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func idempotent(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := request.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// backoff give the wait before the next attempt, with a random jitter of up to half of it
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// parseRetryAfter read a Retry-After header given in seconds or as an http date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
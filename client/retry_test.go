@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		retryAfter string
+		err        error
+		marked     bool
+		want       bool
+	}{
+		{name: "get on network error", method: http.MethodGet, err: errors.New("connection reset"), want: true},
+		{name: "post on network error", method: http.MethodPost, err: errors.New("connection reset"), want: false},
+		{name: "get on 429", method: http.MethodGet, status: http.StatusTooManyRequests, want: true},
+		{name: "post on 429", method: http.MethodPost, status: http.StatusTooManyRequests, want: true},
+		{name: "get on 502", method: http.MethodGet, status: http.StatusBadGateway, want: true},
+		{name: "post on 502", method: http.MethodPost, status: http.StatusBadGateway, want: false},
+		{name: "delete on 504", method: http.MethodDelete, status: http.StatusGatewayTimeout, want: true},
+		{name: "post on 504", method: http.MethodPost, status: http.StatusGatewayTimeout, want: false},
+		{name: "idempotent post on 502", method: http.MethodPost, status: http.StatusBadGateway, marked: true, want: true},
+		{name: "idempotent post on 503", method: http.MethodPost, status: http.StatusServiceUnavailable, marked: true, want: true},
+		{name: "idempotent post on network error", method: http.MethodPost, err: errors.New("connection reset"), marked: true, want: true},
+		{name: "patch on 504", method: http.MethodPatch, status: http.StatusGatewayTimeout, want: false},
+		{name: "put on 503", method: http.MethodPut, status: http.StatusServiceUnavailable, want: true},
+		{name: "post on 503", method: http.MethodPost, status: http.StatusServiceUnavailable, want: false},
+		{name: "post on 503 with retry-after", method: http.MethodPost, status: http.StatusServiceUnavailable, retryAfter: "1", want: true},
+		{name: "get on 500", method: http.MethodGet, status: http.StatusInternalServerError, want: false},
+		{name: "get on 404", method: http.MethodGet, status: http.StatusNotFound, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, "http://cc/v3/security_groups", nil)
+			if tt.marked {
+				request = request.WithContext(withIdempotent(request.Context()))
+			}
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status, Header: http.Header{}}
+				if tt.retryAfter != "" {
+					resp.Header.Set("Retry-After", tt.retryAfter)
+				}
+			}
+			if got := retryable(request, resp, tt.err); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryableCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodGet, "http://cc/v3/security_groups", nil).WithContext(ctx)
+	if retryable(request, nil, context.Canceled) {
+		t.Error("a canceled request must not be retried")
+	}
+}
+
+func TestDoRetriesOnlyIdempotentRequestsOnGatewayTimeout(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	defer server.Close()
+	c := NewClient(server.URL, nil, "token", server.URL, http.DefaultTransport.(*http.Transport).Clone())
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	tests := []struct {
+		method string
+		want   int32
+	}{
+		{http.MethodGet, 3},
+		{http.MethodPost, 1},
+	}
+	for _, tt := range tests {
+		calls.Store(0)
+		err := c.DoJSON(context.Background(), tt.method, server.URL+"/v3/security_groups", map[string]string{"name": "sg"}, nil)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.method)
+		}
+		if got := calls.Load(); got != tt.want {
+			t.Errorf("%s: got %d attempts, want %d", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestBindRetriedOnBadGateway(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	c := NewClient(server.URL, nil, "token", server.URL, http.DefaultTransport.(*http.Transport).Clone())
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	binds := map[string]func(context.Context, string, string, string) error{
+		"running": c.BindRunningSecGroupToSpaceContext,
+		"staging": c.BindStagingSecGroupToSpaceContext,
+	}
+	for lifecycle, bind := range binds {
+		calls.Store(0)
+		if err := bind(context.Background(), "sg", "space", server.URL); err != nil {
+			t.Errorf("%s: %s", lifecycle, err)
+		}
+		if got := calls.Load(); got != 3 {
+			t.Errorf("%s: got %d attempts, want 3", lifecycle, got)
+		}
+	}
+}
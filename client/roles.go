@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+)
+
+// roleFilterChunk is the max number of guids given in one filter, to keep urls short
+const roleFilterChunk = 50
+
+// RolesFilter select roles to retrieve, empty fields are not filtered
+type RolesFilter struct {
+	Types             []constant.RoleType
+	UserGUIDs         []string
+	OrganizationGUIDs []string
+	SpaceGUIDs        []string
+}
+
+func (f RolesFilter) queries() []ccv3.Query {
+	queries := make([]ccv3.Query, 0)
+	if len(f.Types) > 0 {
+		types := make([]string, len(f.Types))
+		for i, t := range f.Types {
+			types[i] = string(t)
+		}
+		queries = append(queries, ccv3.Query{Key: ccv3.RoleTypesFilter, Values: types})
+	}
+	if len(f.UserGUIDs) > 0 {
+		queries = append(queries, ccv3.Query{Key: ccv3.UserGUIDFilter, Values: f.UserGUIDs})
+	}
+	if len(f.OrganizationGUIDs) > 0 {
+		queries = append(queries, ccv3.Query{Key: ccv3.OrganizationGUIDFilter, Values: f.OrganizationGUIDs})
+	}
+	if len(f.SpaceGUIDs) > 0 {
+		queries = append(queries, ccv3.Query{Key: ccv3.SpaceGUIDFilter, Values: f.SpaceGUIDs})
+	}
+	return queries
+}
+
+// GetRoles retrieve roles matching filter, organization and space guids are sent by batches
+func (c *Client) GetRoles(filter RolesFilter) (User, error) {
+	return c.GetRolesContext(context.Background(), filter)
+}
+
+// GetRolesContext is like GetRoles, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetRolesContext(ctx context.Context, filter RolesFilter) (User, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	resources, err := collect(c.IterRoles(ctx, filter))
+	return User{Resources: resources}, err
+}
+
+// GetManagedOrgs tell for each given org if the user is one of its org managers
+func (c *Client) GetManagedOrgs(userGuid string, orgGuids []string) (map[string]bool, error) {
+	return c.GetManagedOrgsContext(context.Background(), userGuid, orgGuids)
+}
+
+// GetManagedOrgsContext is like GetManagedOrgs, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetManagedOrgsContext(ctx context.Context, userGuid string, orgGuids []string) (map[string]bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	managed := make(map[string]bool)
+	if len(orgGuids) == 0 {
+		return managed, nil
+	}
+	for _, orgGuid := range orgGuids {
+		managed[orgGuid] = false
+	}
+	roles, err := c.GetRolesContext(ctx, RolesFilter{
+		Types:             []constant.RoleType{constant.OrgManagerRole},
+		UserGUIDs:         []string{userGuid},
+		OrganizationGUIDs: orgGuids,
+	})
+	if err != nil {
+		return managed, err
+	}
+	for _, role := range roles.Resources {
+		if role.Relationships.User.Data.GUID == userGuid {
+			managed[role.Relationships.Organization.Data.GUID] = true
+		}
+	}
+	return managed, nil
+}
+
+// GetManagedSpaces tell for each given space if the user is one of its space managers
+func (c *Client) GetManagedSpaces(userGuid string, spaceGuids []string) (map[string]bool, error) {
+	return c.GetManagedSpacesContext(context.Background(), userGuid, spaceGuids)
+}
+
+// GetManagedSpacesContext is like GetManagedSpaces, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetManagedSpacesContext(ctx context.Context, userGuid string, spaceGuids []string) (map[string]bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	managed := make(map[string]bool)
+	if len(spaceGuids) == 0 {
+		return managed, nil
+	}
+	for _, spaceGuid := range spaceGuids {
+		managed[spaceGuid] = false
+	}
+	roles, err := c.GetRolesContext(ctx, RolesFilter{
+		Types:      []constant.RoleType{constant.SpaceManagerRole},
+		UserGUIDs:  []string{userGuid},
+		SpaceGUIDs: spaceGuids,
+	})
+	if err != nil {
+		return managed, err
+	}
+	for _, role := range roles.Resources {
+		if role.Relationships.User.Data.GUID == userGuid {
+			managed[role.Relationships.Space.Data.GUID] = true
+		}
+	}
+	return managed, nil
+}
+
+// chunkGuids split guids in batches, no guids give one empty batch so that the filter is simply not set
+func chunkGuids(guids []string) [][]string {
+	if len(guids) == 0 {
+		return [][]string{nil}
+	}
+	chunks := make([][]string, 0)
+	for start := 0; start < len(guids); start += roleFilterChunk {
+		end := min(start+roleFilterChunk, len(guids))
+		chunks = append(chunks, guids[start:end])
+	}
+	return chunks
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// SecurityGroupParams is the body sent to cloud controller to create or update a security group,
+// an empty name, nil rules or a nil global enablement are left unchanged on update, rules pointing to an empty
+// slice remove all rules
+type SecurityGroupParams struct {
+	Name            string           `json:"name,omitempty"`
+	Rules           *[]Rule          `json:"rules,omitempty"`
+	GloballyEnabled *GloballyEnabled `json:"globally_enabled,omitempty"`
+}
+
+// GloballyEnabled enable a security group for all spaces on running or staging lifecycle, nil fields are left unchanged
+type GloballyEnabled struct {
+	Running *bool `json:"running,omitempty"`
+	Staging *bool `json:"staging,omitempty"`
+}
+
+// CreateSecurityGroup create a security group which is not bound to any space
+func (c *Client) CreateSecurityGroup(params SecurityGroupParams) (SecurityGroup, error) {
+	return c.CreateSecurityGroupContext(context.Background(), params)
+}
+
+// CreateSecurityGroupContext is like CreateSecurityGroup, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) CreateSecurityGroupContext(ctx context.Context, params SecurityGroupParams) (SecurityGroup, error) {
+	var secGroup SecurityGroup
+	err := c.DoJSON(ctx, http.MethodPost, c.endpoint+"/v3/security_groups", params, &secGroup)
+	return secGroup, err
+}
+
+// UpdateSecurityGroup replace name and rules of a security group, see SecurityGroupParams
+func (c *Client) UpdateSecurityGroup(guid string, params SecurityGroupParams) (SecurityGroup, error) {
+	return c.UpdateSecurityGroupContext(context.Background(), guid, params)
+}
+
+// UpdateSecurityGroupContext is like UpdateSecurityGroup, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) UpdateSecurityGroupContext(ctx context.Context, guid string, params SecurityGroupParams) (SecurityGroup, error) {
+	var secGroup SecurityGroup
+	err := c.DoJSON(ctx, http.MethodPatch, c.endpoint+"/v3/security_groups/"+url.PathEscape(guid), params, &secGroup)
+	return secGroup, err
+}
+
+// DeleteSecurityGroup delete a security group, cloud controller finishes the deletion asynchronously
+func (c *Client) DeleteSecurityGroup(guid string) error {
+	return c.DeleteSecurityGroupContext(context.Background(), guid)
+}
+
+// DeleteSecurityGroupContext is like DeleteSecurityGroup, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) DeleteSecurityGroupContext(ctx context.Context, guid string) error {
+	return c.DoJSON(ctx, http.MethodDelete, c.endpoint+"/v3/security_groups/"+url.PathEscape(guid), nil, nil)
+}
+
+// GetOrganization retrieve an org by its guid
+func (c *Client) GetOrganization(guid string) (Organization, error) {
+	return c.GetOrganizationContext(context.Background(), guid)
+}
+
+// GetOrganizationContext is like GetOrganization, the call is abandoned when ctx is done or after the client timeout
+func (c *Client) GetOrganizationContext(ctx context.Context, guid string) (Organization, error) {
+	var org Organization
+	err := c.DoJSON(ctx, http.MethodGet, c.apiUrl+"/v3/organizations/"+url.PathEscape(guid), nil, &org)
+	if err != nil {
+		return Organization{}, fmt.Errorf("organization %s: %w", guid, err)
+	}
+	return org, nil
+}
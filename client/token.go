@@ -0,0 +1,64 @@
+package client
+
+import (
+	"net/http"
+)
+
+// TokenSource give the token set in Authorization header of requests made by the client
+type TokenSource interface {
+	// Token return a valid token, renewing it when needed
+	Token() (string, error)
+	// Refresh renew a token which has been rejected by the api, it returns the same token when it can't be renewed
+	Refresh(rejected string) (string, error)
+}
+
+// SetTokenSource make the client take its tokens from ts instead of a fixed access token
+func (c *Client) SetTokenSource(ts TokenSource) {
+	c.tokenSource = ts
+}
+
+func (c *Client) token() (string, error) {
+	if c.tokenSource == nil {
+		return c.accessToken, nil
+	}
+	return c.tokenSource.Token()
+}
+
+// send a request with the client token, a request rejected with a 401 is sent once again with a renewed token
+func (c *Client) send(request *http.Request) (*http.Response, error) {
+	client := &http.Client{Transport: &c.transport}
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", token)
+	if requestID := RequestIDFromContext(request.Context()); requestID != "" {
+		request.Header.Set(RequestIDHeader, requestID)
+	}
+	resp, err := client.Do(request)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.tokenSource == nil {
+		return resp, err
+	}
+	if request.Body != nil && request.GetBody == nil {
+		return resp, nil
+	}
+	newToken, err := c.tokenSource.Refresh(token)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if newToken == token {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := request.Clone(request.Context())
+	if request.GetBody != nil {
+		retry.Body, err = request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", newToken)
+	return client.Do(retry)
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer giving spans of calls made by the client
+const TracerName = "github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+
+var guidSegmentRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// operationOf give the method and the path of a request where guids are replaced by {guid}, it names the call
+func operationOf(request *http.Request) string {
+	segments := strings.Split(request.URL.Path, "/")
+	for i, segment := range segments {
+		if guidSegmentRegex.MatchString(segment) {
+			segments[i] = "{guid}"
+		}
+	}
+	return request.Method + " " + strings.Join(segments, "/")
+}
+
+// CallEvent describe a call made by the client once it is done, retries included
+type CallEvent struct {
+	// Operation is the method and the path of the call where guids are replaced by {guid}
+	Operation string
+	// StatusCode is the status of the last response, 0 when no response was received
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+}
+
+// SetCallObserver make the client give each call it made to observer, to measure calls
+func (c *Client) SetCallObserver(observer func(CallEvent)) {
+	c.onCall = observer
+}
+
+// startCallSpan start the span of a call made by the client from the span of its context,
+// the trace context is propagated in the request headers with the global propagator
+func startCallSpan(request *http.Request) (*http.Request, trace.Span) {
+	ctx, span := otel.Tracer(TracerName).Start(request.Context(), operationOf(request),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", request.Method),
+			attribute.String("server.address", request.URL.Hostname()),
+			attribute.String("url.path", request.URL.Path),
+		),
+	)
+	request = request.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+	return request, span
+}
+
+// endCallSpan record the outcome of a call on its span and end it, error responses mark the span as failed
+func endCallSpan(span trace.Span, resp *http.Response, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case resp.StatusCode >= http.StatusBadRequest:
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		span.SetStatus(codes.Error, resp.Status)
+	default:
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	}
+	span.End()
+}
@@ -3,16 +3,149 @@ package model
 import "code.cloudfoundry.org/cli/v8/resources"
 
 type ConfigServer struct {
-	LogLevel              string   `cloud:"log_level"`
-	LogJSON               *bool    `cloud:"log_json"`
-	LogNoColor            bool     `cloud:"log_no_color"`
-	FallbackToSqlite      bool     `cloud:"fallback_to_sqlite"`
-	SSLCertFile           string   `cloud:"ssl_cert_file" cloud-default:""`
-	SSLKeyFile            string   `cloud:"ssl_key_file" cloud-default:""`
-	TrustedCaCertificates []string `cloud:"trusted_ca_certificates"`
-	CloudFoundry          CFConfig `cloud:"cloud_foundry"`
-	AuthKey               string   `cloud:"auth_key"`
-	JWT                   JWT      `cloud:"jwt"`
+	LogLevel               string                 `cloud:"log_level"`
+	LogJSON                *bool                  `cloud:"log_json"`
+	LogNoColor             bool                   `cloud:"log_no_color"`
+	FallbackToSqlite       bool                   `cloud:"fallback_to_sqlite"`
+	SSLCertFile            string                 `cloud:"ssl_cert_file" cloud-default:""`
+	SSLKeyFile             string                 `cloud:"ssl_key_file" cloud-default:""`
+	TrustedCaCertificates  []string               `cloud:"trusted_ca_certificates"`
+	CloudFoundry           CFConfig               `cloud:"cloud_foundry"`
+	AuthKey                string                 `cloud:"auth_key"`
+	JWT                    JWT                    `cloud:"jwt"`
+	OrgBindingPollInterval int                    `cloud:"org_binding_poll_interval" cloud-default:"60"`
+	StrictMode             bool                   `cloud:"strict_mode"`
+	Cache                  CacheConfig            `cloud:"cache"`
+	Retry                  RetryConfig            `cloud:"retry"`
+	PrivateSecurityGroups  PrivateSecGroupsConfig `cloud:"private_security_groups"`
+	ForbiddenDestinations  []ForbiddenDestination `cloud:"forbidden_destinations"`
+	BindingQuotas          BindingQuotasConfig    `cloud:"binding_quotas"`
+	RuleEstimate           RuleEstimateConfig     `cloud:"rule_estimate"`
+	RateLimit              RateLimitConfig        `cloud:"rate_limit"`
+	Tracing                TracingConfig          `cloud:"tracing"`
+	Inventory              InventoryConfig        `cloud:"inventory"`
+}
+
+// CacheConfig set how long space and role lookups are kept, a ttl of 0 disable caching
+type CacheConfig struct {
+	TTL        int `cloud:"ttl" cloud-default:"60"`
+	MaxEntries int `cloud:"max_entries" cloud-default:"10000"`
+}
+
+// RetryConfig set how calls to cloud controller failing with a transient error are retried
+type RetryConfig struct {
+	MaxAttempts      int `cloud:"max_attempts" cloud-default:"4"`
+	InitialBackoffMs int `cloud:"initial_backoff_ms" cloud-default:"200"`
+	MaxBackoffMs     int `cloud:"max_backoff_ms" cloud-default:"5000"`
+	MaxElapsedMs     int `cloud:"max_elapsed_ms" cloud-default:"30000"`
+}
+
+// PrivateSecGroupsConfig let org managers create security groups owned by their org,
+// their name get NamePrefix where {{org}} is replaced by the org name and their rules must follow the org policy
+type PrivateSecGroupsConfig struct {
+	Enabled    bool                    `cloud:"enabled"`
+	NamePrefix string                  `cloud:"name_prefix" cloud-default:"{{org}}-"`
+	Default    PrivateSecGroupPolicy   `cloud:"default"`
+	Orgs       []PrivateSecGroupPolicy `cloud:"orgs"`
+	Templates  []SecGroupTemplate      `cloud:"templates"`
+}
+
+// PrivateSecGroupPolicy set which rules are allowed in private security groups, destinations are cidrs
+// and ports are ports or port ranges, an empty list of ports allow any port.
+// Policies in Orgs apply to the org of OrganizationGUID, their empty lists are taken from the default policy.
+type PrivateSecGroupPolicy struct {
+	OrganizationGUID    string   `cloud:"organization_guid" json:"organization_guid,omitempty"`
+	AllowedDestinations []string `cloud:"allowed_destinations" json:"allowed_destinations"`
+	AllowedPorts        []string `cloud:"allowed_ports" json:"allowed_ports"`
+	AllowedProtocols    []string `cloud:"allowed_protocols" json:"allowed_protocols"`
+}
+
+// SecGroupTemplate is a set of rules written by admins, {{param}} in rules are replaced by values
+// given by org managers when creating a private security group from the template
+type SecGroupTemplate struct {
+	Name        string                 `cloud:"name" json:"name"`
+	Description string                 `cloud:"description" json:"description,omitempty"`
+	Params      []string               `cloud:"params" json:"params"`
+	Rules       []SecGroupTemplateRule `cloud:"rules" json:"rules"`
+}
+
+type SecGroupTemplateRule struct {
+	Protocol    string `cloud:"protocol" json:"protocol"`
+	Destination string `cloud:"destination" json:"destination"`
+	Ports       string `cloud:"ports" json:"ports,omitempty"`
+}
+
+// ForbiddenDestination refuse to bind a security group having a rule which reaches Destinations, cidrs or ips,
+// on Ports with Protocols to spaces of the org of OrganizationGUID whose name match SpacePattern, a regular expression.
+// Empty fields match anything.
+type ForbiddenDestination struct {
+	Name             string   `cloud:"name"`
+	OrganizationGUID string   `cloud:"organization_guid"`
+	SpacePattern     string   `cloud:"space_pattern"`
+	Destinations     []string `cloud:"destinations"`
+	Ports            string   `cloud:"ports"`
+	Protocols        []string `cloud:"protocols"`
+}
+
+// BindingQuotasConfig limit security groups bound to spaces, the Default quota applies to all orgs
+// and entries of Orgs override it for their organization_guid
+type BindingQuotasConfig struct {
+	Default BindingQuota   `cloud:"default"`
+	Orgs    []BindingQuota `cloud:"orgs"`
+}
+
+// BindingQuota set the max number of security groups bound to a space, on running or staging lifecycle,
+// and the max number of distinct rules they give to the space, 0 means no limit.
+// In Orgs, 0 takes the limit of the default quota and -1 removes it.
+type BindingQuota struct {
+	OrganizationGUID          string `cloud:"organization_guid" json:"organization_guid,omitempty"`
+	MaxSecurityGroupsPerSpace int    `cloud:"max_security_groups_per_space" json:"max_security_groups_per_space"`
+	MaxRulesPerSpace          int    `cloud:"max_rules_per_space" json:"max_rules_per_space"`
+}
+
+// RuleEstimateConfig set thresholds on the rules garden writes for a space, see client.RuleEstimate,
+// bindings giving more rules than HardThreshold are refused and the ones above WarningThreshold get a warning, 0 disables a threshold
+type RuleEstimateConfig struct {
+	WarningThreshold int `cloud:"warning_threshold"`
+	HardThreshold    int `cloud:"hard_threshold"`
+}
+
+// RateLimitConfig limit requests of each user or client with token buckets, reads are GET and HEAD requests
+// and writes are the other ones, admins get the Admin limits
+type RateLimitConfig struct {
+	User  RateLimits `cloud:"user"`
+	Admin RateLimits `cloud:"admin"`
+}
+
+// RateLimits set how many requests per second are allowed on average and how many can be made at once,
+// a rate of 0 disables the limit and a burst of 0 takes the rate rounded up
+type RateLimits struct {
+	ReadsPerSecond  float64 `cloud:"reads_per_second"`
+	ReadBurst       int     `cloud:"read_burst"`
+	WritesPerSecond float64 `cloud:"writes_per_second"`
+	WriteBurst      int     `cloud:"write_burst"`
+}
+
+// TracingConfig export traces of requests and of their calls to cloud controller, Exporter is otlp to send spans
+// over http to Endpoint, an url like http://localhost:4318, or stdout to write them, tracing is disabled when it is empty.
+// SampleRatio is the share of traces kept when the caller did not decide it.
+type TracingConfig struct {
+	Exporter    string  `cloud:"exporter"`
+	Endpoint    string  `cloud:"endpoint"`
+	SampleRatio float64 `cloud:"sample_ratio" cloud-default:"1"`
+	ServiceName string  `cloud:"service_name" cloud-default:"cfsecurity"`
+}
+
+// InventoryConfig set how often, in seconds, security groups and their bindings are counted for the inventory gauges,
+// an interval of 0 disables them. A count taking more than Timeout seconds or finding more than MaxSecurityGroups
+// security groups or MaxSpaces spaces is abandoned, 0 means no limit. Only the MaxOrgs orgs with most bindings
+// get their own series, bindings of other orgs are summed in a series of their own.
+type InventoryConfig struct {
+	Interval          int `cloud:"interval"`
+	Timeout           int `cloud:"timeout" cloud-default:"120"`
+	MaxSecurityGroups int `cloud:"max_security_groups" cloud-default:"10000"`
+	MaxSpaces         int `cloud:"max_spaces" cloud-default:"50000"`
+	MaxOrgs           int `cloud:"max_orgs" cloud-default:"100"`
 }
 
 type JWT struct {
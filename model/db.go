@@ -1,6 +1,85 @@
 package model
 
+import (
+	"time"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+)
+
 type BindingParams struct {
 	SecurityGroupGUID string `json:"security_group_guid"`
 	SpaceGUID         string `json:"space_guid"`
 }
+
+// OrgBindingParams bind a security group to all spaces of an org, current and future ones,
+// lifecycle can be running or staging, both are bound when empty
+type OrgBindingParams struct {
+	SecurityGroupGUID string `json:"security_group_guid"`
+	OrganizationGUID  string `json:"organization_guid"`
+	Lifecycle         string `json:"lifecycle,omitempty"`
+}
+
+// OrgBinding is an org-level binding, spaces created in the org after LastCheckedAt are bound automatically,
+// RuleEstimates are only given when the org binding is created
+type OrgBinding struct {
+	SecurityGroupGUID string                `gorm:"primary_key" json:"security_group_guid"`
+	OrganizationGUID  string                `gorm:"primary_key" json:"organization_guid"`
+	Running           bool                  `json:"running"`
+	Staging           bool                  `json:"staging"`
+	LastCheckedAt     time.Time             `json:"last_checked_at"`
+	CreatedAt         time.Time             `json:"created_at"`
+	UpdatedAt         time.Time             `json:"updated_at"`
+	RuleEstimates     []client.RuleEstimate `gorm:"-" json:"rule_estimates,omitempty"`
+}
+
+// OrgBindingAction record a binding made automatically on a new space because of an org binding,
+// a failed binding is attempted again on next polls until it succeeds or Attempts reaches the max attempts
+type OrgBindingAction struct {
+	ID                uint      `gorm:"primary_key" json:"id"`
+	SecurityGroupGUID string    `gorm:"index" json:"security_group_guid"`
+	OrganizationGUID  string    `gorm:"index" json:"organization_guid"`
+	SpaceGUID         string    `gorm:"index" json:"space_guid"`
+	SpaceName         string    `json:"space_name"`
+	Lifecycle         string    `json:"lifecycle"`
+	Error             string    `json:"error,omitempty"`
+	Attempts          int       `json:"attempts"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// OrgSecurityGroupParams create or update a security group owned by an org, rules are given directly
+// or rendered from an admin template with its params, on update nil rules are left unchanged and empty ones removed
+type OrgSecurityGroupParams struct {
+	OrganizationGUID string            `json:"organization_guid"`
+	Name             string            `json:"name"`
+	Rules            *[]client.Rule    `json:"rules,omitempty"`
+	Template         string            `json:"template,omitempty"`
+	Params           map[string]string `json:"params,omitempty"`
+}
+
+// OrgSecurityGroup is a security group created by an org manager, it can only be bound to spaces of its org
+type OrgSecurityGroup struct {
+	SecurityGroupGUID string        `gorm:"primary_key" json:"security_group_guid"`
+	OrganizationGUID  string        `gorm:"index" json:"organization_guid"`
+	Name              string        `json:"name"`
+	Template          string        `json:"template,omitempty"`
+	CreatedBy         string        `json:"created_by"`
+	Rules             []client.Rule `gorm:"-" json:"rules,omitempty"`
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
+}
+
+// QuotaUsage is the usage of binding quotas by the spaces of an org, limits of 0 mean no limit
+type QuotaUsage struct {
+	OrganizationGUID string            `json:"organization_guid"`
+	Quota            BindingQuota      `json:"quota"`
+	Spaces           []SpaceQuotaUsage `json:"spaces"`
+}
+
+// SpaceQuotaUsage count security groups bound to a space, on running or staging lifecycle, and the distinct rules they give
+type SpaceQuotaUsage struct {
+	SpaceGUID      string `json:"space_guid"`
+	SpaceName      string `json:"space_name"`
+	SecurityGroups int    `json:"security_groups"`
+	Rules          int    `json:"rules"`
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
 
+	"github.com/olekukonko/tablewriter"
+	cli "github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
 	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/plugin/messages"
 )
 
@@ -15,6 +18,7 @@ type BindOptions struct {
 
 type BindCommand struct {
 	Api         string      `short:"a" long:"api" description:"api to cf security"`
+	Estimate    bool        `short:"e" long:"estimate" description:"show the rules garden writes for the spaces once bound, with destinations and ports lists multiplied out"`
 	BindOptions BindOptions `required:"2" positional-args:"true"`
 }
 
@@ -45,6 +49,18 @@ func (c *BindCommand) Execute(_ []string) error {
 	if err != nil {
 		return err
 	}
+	if c.BindOptions.Space == "" {
+		estimates, err := client.BindUnbindOrgSecurityGroup(secGroup.GUID, orgId, http.MethodPost, client.GetEndpoint())
+		if err != nil {
+			return err
+		}
+		messages.Println(messages.C.Green("OK\n"))
+		if c.Estimate {
+			printRuleEstimates(estimates...)
+		}
+		messages.Println("TIP: Spaces created later in this org will be bound automatically.")
+		return nil
+	}
 
 	spaces, err := getOrgSpaces(orgId)
 	if err != nil {
@@ -54,11 +70,14 @@ func (c *BindCommand) Execute(_ []string) error {
 		if c.BindOptions.Space != "" && c.BindOptions.Space != space.Name {
 			continue
 		}
-		err := client.BindUnbindSecurityGroup(secGroup.GUID, space.Guid, http.MethodPost, client.GetEndpoint())
+		estimate, err := client.BindUnbindSecurityGroup(secGroup.GUID, space.Guid, http.MethodPost, client.GetEndpoint())
 		if err != nil {
 			return err
 		}
 		messages.Println(messages.C.Green("OK\n"))
+		if c.Estimate {
+			printRuleEstimates(estimate)
+		}
 		messages.Println("TIP: If Dynamic ASG's are enabled, changes will automatically apply for running and staging applications. Otherwise, changes will require an app restart (for running) or restage (for staging) to apply to existing applications.")
 		return nil
 	}
@@ -67,8 +86,33 @@ func (c *BindCommand) Execute(_ []string) error {
 
 }
 
+// printRuleEstimates show the rules of spaces after binding, nothing is shown without estimates
+func printRuleEstimates(estimates ...cli.RuleEstimate) {
+	if len(estimates) == 0 {
+		return
+	}
+	data := make([][]string, 0)
+	for _, estimate := range estimates {
+		data = append(data, []string{
+			estimate.SpaceName,
+			fmt.Sprint(estimate.Running),
+			fmt.Sprint(estimate.Staging),
+		})
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header("space", "running rules", "staging rules")
+	_ = table.Bulk(data)
+	_ = table.Render()
+	for _, estimate := range estimates {
+		if estimate.Warning != "" {
+			messages.Warningf("space %s: %s", estimate.SpaceName, estimate.Warning)
+		}
+	}
+	messages.Println("")
+}
+
 func init() {
-	desc := `Bind a security group to a particular space, or all existing spaces of an org by an org manager`
+	desc := `Bind a security group to a particular space, or all existing and future spaces of an org by an org manager`
 	_, err := parser.AddCommand(
 		"bind-manager-security-group",
 		desc,
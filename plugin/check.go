@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	cli "github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/plugin/messages"
+)
+
+type CheckOptions struct {
+	Org         string `positional-arg-name:"ORG"`
+	Space       string `positional-arg-name:"SPACE"`
+	Destination string `positional-arg-name:"DESTINATION"`
+	Port        string `positional-arg-name:"PORT"`
+}
+
+type CheckCommand struct {
+	Api          string       `short:"a" long:"api" description:"api to cf security"`
+	Protocol     string       `short:"p" long:"protocol" description:"protocol to check (tcp, udp, icmp, all)" default:"tcp"`
+	CheckOptions CheckOptions `required:"3" positional-args:"true"`
+}
+
+var checkCommand CheckCommand
+
+func (c *CheckCommand) Execute(_ []string) error {
+	client := genClient(c.Api)
+	username, err := cliConnection.Username()
+	if err != nil {
+		return err
+	}
+	port, err := cli.ParsePort(c.CheckOptions.Port)
+	if err != nil {
+		return err
+	}
+	destination := c.CheckOptions.Destination
+	if port > 0 {
+		destination = fmt.Sprintf("%s:%d", destination, port)
+	}
+	messages.Printf("Checking egress to %s (%s) from %s/%s as %s...\n",
+		messages.C.Cyan(destination),
+		messages.C.Cyan(c.Protocol),
+		messages.C.Cyan(c.CheckOptions.Org),
+		messages.C.Cyan(c.CheckOptions.Space),
+		messages.C.Cyan(username),
+	)
+	orgId, err := getOrgID(c.CheckOptions.Org)
+	if err != nil {
+		return err
+	}
+	spaceId, err := getSpaceID(orgId, c.CheckOptions.Space)
+	if err != nil {
+		return err
+	}
+	// the server checks an ip, hostnames are resolved here and each of their addresses is checked
+	ips, err := resolveDestination(c.CheckOptions.Destination)
+	if err != nil {
+		return err
+	}
+	checks := make([]cli.EgressCheck, 0, len(ips))
+	for _, ip := range ips {
+		if ones, bits := ip.Mask.Size(); ones != bits {
+			return fmt.Errorf("destination %s must be an ip or a hostname, not a cidr", c.CheckOptions.Destination)
+		}
+		check, err := client.GetEgressCheck(spaceId, ip.IP.String(), port, c.Protocol)
+		if err != nil {
+			return err
+		}
+		checks = append(checks, check)
+	}
+	messages.Println(messages.C.Green("OK\n"))
+
+	for i, check := range checks {
+		if len(checks) > 1 {
+			if i > 0 {
+				messages.Println("")
+			}
+			messages.Printf("%s resolved to %s\n", c.CheckOptions.Destination, messages.C.Cyan(check.Destination))
+		}
+		printEgressCheck(check)
+	}
+	return nil
+}
+
+// printEgressCheck show the result of each lifecycle and security groups which would allow the destination
+func printEgressCheck(check cli.EgressCheck) {
+	for _, lifecycle := range check.Lifecycles {
+		if !lifecycle.Allowed {
+			messages.Printf("%s: %s\n", messages.C.Cyan(lifecycle.Lifecycle), messages.C.Red("denied"))
+			continue
+		}
+		messages.Printf("%s: %s\n", messages.C.Cyan(lifecycle.Lifecycle), messages.C.Green("allowed"))
+		for _, match := range lifecycle.Matches {
+			messages.Printf("\tby %s (%s) with rule %s %s %s\n",
+				messages.C.Cyan(match.SecurityGroupName),
+				match.Source,
+				match.Rule.Protocol,
+				match.Rule.Destination,
+				match.Rule.Ports,
+			)
+		}
+	}
+
+	if len(check.BindableSecurityGroups) == 0 {
+		return
+	}
+	messages.Println(messages.C.Cyan("\nSecurity groups which would allow this destination"))
+	data := make([][]string, 0)
+	for i, match := range check.BindableSecurityGroups {
+		data = append(data, []string{
+			fmt.Sprintf("#%d", i),
+			match.SecurityGroupName,
+			match.Rule.Protocol,
+			match.Rule.Destination,
+			match.Rule.Ports,
+		})
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header("#", "name", "protocol", "destination", "ports")
+	_ = table.Bulk(data)
+	_ = table.Render()
+}
+
+func init() {
+	desc := `Check if apps in a space can reach a destination`
+	_, err := parser.AddCommand(
+		"manager-check-egress",
+		desc,
+		desc,
+		&checkCommand)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -8,11 +9,13 @@ import (
 
 	"code.cloudfoundry.org/cli/v8/plugin"
 	"github.com/jessevdk/go-flags"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
 	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/plugin/messages"
 	"github.com/prometheus/common/version"
 )
 
 type Options struct {
+	Timeout int `long:"timeout" description:"timeout in seconds of each call made to cf security and cloud foundry" default:"60"`
 }
 
 var options Options
@@ -48,14 +51,14 @@ func (p *SecurityPlugin) GetMetadata() plugin.PluginMetadata {
 		Commands: []plugin.Command{
 			{
 				Name:     "bind-manager-security-group",
-				HelpText: "Bind a security group to a particular space, or all existing spaces of an org by an org manager",
+				HelpText: "Bind a security group to a particular space, or all existing and future spaces of an org by an org manager",
 				UsageDetails: plugin.Usage{
-					Usage: "bind-manager-security-group SECURITY_GROUP ORG [SPACE]",
+					Usage: "bind-manager-security-group SECURITY_GROUP ORG [SPACE] [-e|--estimate]",
 				},
 			},
 			{
 				Name:     "unbind-manager-security-group",
-				HelpText: "Unbind a security group to a particular space, or all existing spaces of an org by an org manager",
+				HelpText: "Unbind a security group to a particular space, or all spaces of an org by an org manager",
 				UsageDetails: plugin.Usage{
 					Usage: "unbind-manager-security-group SECURITY_GROUP ORG [SPACE]",
 				},
@@ -76,9 +79,23 @@ func (p *SecurityPlugin) GetMetadata() plugin.PluginMetadata {
 			},
 			{
 				Name:     "manager-search-security-groups",
-				HelpText: "Search IP in security groups",
+				HelpText: "Search an IP, a CIDR or a hostname in security groups",
 				UsageDetails: plugin.Usage{
-					Usage: "manager-search-security-groups DESTINATION [PORT]",
+					Usage: "manager-search-security-groups DESTINATION [PORT] [--spaces [-p|--protocol PROTOCOL]]",
+				},
+			},
+			{
+				Name:     "manager-space-security-groups",
+				HelpText: "Show security groups applied to a space, globally enabled or bound, with their merged rules",
+				UsageDetails: plugin.Usage{
+					Usage: "manager-space-security-groups ORG SPACE",
+				},
+			},
+			{
+				Name:     "manager-check-egress",
+				HelpText: "Check if apps in a space can reach a destination",
+				UsageDetails: plugin.Usage{
+					Usage: "manager-check-egress ORG SPACE DESTINATION [PORT] [-p|--protocol PROTOCOL]",
 				},
 			},
 		},
@@ -111,6 +128,11 @@ func (p *SecurityPlugin) Run(cc plugin.CliConnection, args []string) {
 
 	err = Parse(args)
 	if err != nil {
+		// the request id lets operators find the failed request in cf security and cloud controller logs
+		var httpErr client.CloudFoundryHTTPError
+		if errors.As(err, &httpErr) && httpErr.RequestID != "" {
+			_, _ = messages.Printfln("Request id: %s", httpErr.RequestID)
+		}
 		messages.Fatal(err.Error())
 	}
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"net"
 	"os"
@@ -15,32 +14,47 @@ import (
 )
 
 type SearchOptions struct {
-	Ip   string `positional-arg-name:"IP" required:"true"`
+	Ip   string `positional-arg-name:"DESTINATION" required:"true"`
 	Port string `positional-arg-name:"PORT"`
 }
 
 type SearchCommand struct {
 	Api           string        `short:"a" long:"api" description:"api to cf security"`
+	Spaces        bool          `long:"spaces" description:"list spaces which can reach destination instead of security groups"`
+	Protocol      string        `short:"p" long:"protocol" description:"protocol used with --spaces (tcp, udp, icmp, all)" default:"tcp"`
 	SearchOptions SearchOptions `positional-args:"true"`
 }
 
 var searchCommand SearchCommand
 
 func (c *SearchCommand) Execute(_ []string) error {
+	if c.Spaces {
+		return c.executeSpaces()
+	}
 	client := genClient(c.Api)
 	username, err := cliConnection.Username()
 	if err != nil {
 		return err
 	}
-	// Parse IP and port
-	searchedIp := net.ParseIP(c.SearchOptions.Ip)
+	// Parse destination and port
+	destinations, err := resolveDestination(c.SearchOptions.Ip)
+	if err != nil {
+		return err
+	}
 	searchedPort, err := strconv.Atoi(c.SearchOptions.Port)
 	if err != nil {
 		searchedPort = 0
 	}
 
 	// Show header message
-	text := fmt.Sprintf("Searching security groups for %s", messages.C.Cyan(searchedIp))
+	text := fmt.Sprintf("Searching security groups for %s", messages.C.Cyan(c.SearchOptions.Ip))
+	if len(destinations) > 1 || destinationString(destinations[0]) != c.SearchOptions.Ip {
+		resolved := make([]string, 0)
+		for _, destination := range destinations {
+			resolved = append(resolved, destinationString(destination))
+		}
+		text = fmt.Sprintf("%s (%s)", text, strings.Join(resolved, ", "))
+	}
 	if searchedPort > 0 {
 		text = fmt.Sprintf("%s and port %s", text, messages.C.Cyan(fmt.Sprintf("%d", searchedPort)))
 	}
@@ -52,70 +66,23 @@ func (c *SearchCommand) Execute(_ []string) error {
 		return err
 	}
 
-	// Match IP
-	matchedIpSecGroups := make([]client2.SecurityGroup, 0)
+	// Match destination and port, keeping resolved addresses which matched
+	matchedSecGroups := make([]client2.SecurityGroup, 0)
+	matchedAddresses := make([][]string, 0)
 	for _, secGroup := range secGroups.Resources {
-		for _, rule := range secGroup.Rules {
-			matched := false
-			for _, destination := range strings.Split(rule.Destination, ",") {
-				_, ipNet, err := net.ParseCIDR(destination)
-				if err == nil {
-					if ipNet.Contains(searchedIp) {
-						matchedIpSecGroups = append(matchedIpSecGroups, secGroup)
-						matched = true
-						break
-					}
-				} else {
-					ips := strings.Split(destination, "-")
-					if len(ips) == 2 {
-						startIp := net.ParseIP(ips[0])
-						endIp := net.ParseIP(ips[1])
-						if bytes.Compare(searchedIp, startIp) >= 0 && bytes.Compare(searchedIp, endIp) <= 0 {
-							matchedIpSecGroups = append(matchedIpSecGroups, secGroup)
-							matched = true
-							break
-						}
-					} else {
-						if searchedIp.Equal(net.ParseIP(destination)) {
-							matchedIpSecGroups = append(matchedIpSecGroups, secGroup)
-							matched = true
-							break
-						}
-					}
-				}
-			}
-			if matched {
-				break
-			}
-		}
-	}
-
-	// Match port
-	var matchedSecGroups []client2.SecurityGroup
-	if searchedPort > 0 {
-		matchedSecGroups = make([]client2.SecurityGroup, 0)
-		for _, secGroup := range matchedIpSecGroups {
+		addresses := make([]string, 0)
+		for _, destination := range destinations {
 			for _, rule := range secGroup.Rules {
-				matched := false
-				for _, destination := range strings.Split(rule.Ports, ",") {
-					if destination == "" {
-						matchedSecGroups = append(matchedSecGroups, secGroup)
-						matched = true
-						break
-					}
-					if destination == fmt.Sprintf("%d", searchedPort) {
-						matchedSecGroups = append(matchedSecGroups, secGroup)
-						matched = true
-						break
-					}
-				}
-				if matched {
+				if rule.OverlapsNet(destination) && rule.ContainsPort(searchedPort) {
+					addresses = append(addresses, destinationString(destination))
 					break
 				}
 			}
 		}
-	} else {
-		matchedSecGroups = matchedIpSecGroups
+		if len(addresses) > 0 {
+			matchedSecGroups = append(matchedSecGroups, secGroup)
+			matchedAddresses = append(matchedAddresses, addresses)
+		}
 	}
 
 	// Show result
@@ -129,14 +96,14 @@ func (c *SearchCommand) Execute(_ []string) error {
 	data := make([][]string, 0)
 	for iSec, secGroup := range matchedSecGroups {
 		subData := make([]string, 0)
-		subData = append(subData, fmt.Sprintf("#%d", iSec), secGroup.Name)
+		subData = append(subData, fmt.Sprintf("#%d", iSec), secGroup.Name, strings.Join(matchedAddresses[iSec], ", "))
 		nbLines := 0
 		for _, rule := range secGroup.Rules {
 			for _, destination := range strings.Split(rule.Destination, ",") {
 				for _, port := range strings.Split(rule.Ports, ",") {
 					if nbLines > 0 {
 						subData = make([]string, 0)
-						subData = append(subData, "", "")
+						subData = append(subData, "", "", "")
 					}
 					subData = append(subData, destination, port)
 					data = append(data, subData)
@@ -146,21 +113,116 @@ func (c *SearchCommand) Execute(_ []string) error {
 		}
 	}
 
-	text = fmt.Sprintf("Found %s security-group(s) for destination %s", messages.C.Cyan(fmt.Sprintf("%d", len(matchedSecGroups))), messages.C.Cyan(searchedIp))
+	text = fmt.Sprintf("Found %s security-group(s) for destination %s", messages.C.Cyan(fmt.Sprintf("%d", len(matchedSecGroups))), messages.C.Cyan(c.SearchOptions.Ip))
 	if searchedPort > 0 {
 		text = fmt.Sprintf("%s and port %s", text, messages.C.Cyan(fmt.Sprintf("%d", searchedPort)))
 	}
 	_, _ = messages.Println(text)
 	table := tablewriter.NewWriter(os.Stdout)
-	table.Header("#", "Name", "Destination", "Port")
+	table.Header("#", "Name", "Matched", "Destination", "Port")
 	// Fix errcheck: ignore table rendering errors (output to stdout)
 	_ = table.Bulk(data)
 	_ = table.Render()
 	return nil
 }
 
+// resolveDestination parse an ip or a cidr, anything else is taken as a hostname
+// and resolved locally to all its A and AAAA records
+func resolveDestination(destination string) ([]*net.IPNet, error) {
+	ipNet, err := client2.ParseDestination(destination)
+	if err == nil {
+		return []*net.IPNet{ipNet}, nil
+	}
+	ips, err := net.LookupIP(destination)
+	if err != nil {
+		return nil, fmt.Errorf("destination %s is not an ip, a cidr or a resolvable hostname: %s", destination, err)
+	}
+	destinations := make([]*net.IPNet, 0)
+	for _, ip := range ips {
+		ipNet, err := client2.ParseDestination(ip.String())
+		if err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, ipNet)
+	}
+	return destinations, nil
+}
+
+// destinationString show a single address without its mask
+func destinationString(destination *net.IPNet) string {
+	ones, bits := destination.Mask.Size()
+	if ones == bits {
+		return destination.IP.String()
+	}
+	return destination.String()
+}
+
+func (c *SearchCommand) executeSpaces() error {
+	client := genClient(c.Api)
+	username, err := cliConnection.Username()
+	if err != nil {
+		return err
+	}
+	port, err := client2.ParsePort(c.SearchOptions.Port)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Searching spaces which can reach %s", messages.C.Cyan(c.SearchOptions.Ip))
+	if port > 0 {
+		text = fmt.Sprintf("%s and port %s", text, messages.C.Cyan(fmt.Sprintf("%d", port)))
+	}
+	_, _ = messages.Printf("%s (%s) as %s...\n", text, messages.C.Cyan(c.Protocol), messages.C.Cyan(username))
+
+	access, err := client.GetSpacesAccess(c.SearchOptions.Ip, port, c.Protocol)
+	if err != nil {
+		return err
+	}
+	_, _ = messages.Println(messages.C.Green("OK\n"))
+
+	if len(access.GlobalSecurityGroups) > 0 {
+		_, _ = messages.Println(messages.C.Cyan("Globally enabled security groups, all spaces can reach destination"))
+		data := make([][]string, 0)
+		for i, global := range access.GlobalSecurityGroups {
+			data = append(data, []string{
+				fmt.Sprintf("#%d", i),
+				global.SecurityGroupName,
+				global.Lifecycle,
+				global.Rule.Destination,
+				global.Rule.Ports,
+			})
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header("#", "security group", "lifecycle", "destination", "port")
+		_ = table.Bulk(data)
+		_ = table.Render()
+		_, _ = messages.Println("")
+	}
+
+	_, _ = messages.Printf("Found %s space(s) which can reach destination\n", messages.C.Cyan(fmt.Sprintf("%d", len(access.Spaces))))
+	if len(access.Spaces) == 0 {
+		return nil
+	}
+	data := make([][]string, 0)
+	for i, space := range access.Spaces {
+		data = append(data, []string{
+			fmt.Sprintf("#%d", i),
+			space.OrganizationName,
+			space.SpaceName,
+			space.Lifecycle,
+			space.SecurityGroupName,
+			space.Rule.Destination,
+			space.Rule.Ports,
+		})
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header("#", "organization", "space", "lifecycle", "security group", "destination", "port")
+	_ = table.Bulk(data)
+	_ = table.Render()
+	return nil
+}
+
 func init() {
-	desc := `Search IP in security groups`
+	desc := `Search an IP, a CIDR or a hostname in security groups`
 	_, err := parser.AddCommand(
 		"manager-search-security-groups",
 		desc,
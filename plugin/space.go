@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/plugin/messages"
+)
+
+type SpaceOptions struct {
+	Org   string `positional-arg-name:"ORG"`
+	Space string `positional-arg-name:"SPACE"`
+}
+
+type SpaceCommand struct {
+	Api          string       `short:"a" long:"api" description:"api to cf security"`
+	SpaceOptions SpaceOptions `required:"2" positional-args:"true"`
+}
+
+var spaceCommand SpaceCommand
+
+func (c *SpaceCommand) Execute(_ []string) error {
+	client := genClient(c.Api)
+	username, err := cliConnection.Username()
+	if err != nil {
+		return err
+	}
+	messages.Printf("Getting effective security groups for %s/%s as %s...\n",
+		messages.C.Cyan(c.SpaceOptions.Org),
+		messages.C.Cyan(c.SpaceOptions.Space),
+		messages.C.Cyan(username),
+	)
+	orgId, err := getOrgID(c.SpaceOptions.Org)
+	if err != nil {
+		return err
+	}
+	spaceId, err := getSpaceID(orgId, c.SpaceOptions.Space)
+	if err != nil {
+		return err
+	}
+	effective, err := client.GetEffectiveSecGroups(spaceId)
+	if err != nil {
+		return err
+	}
+	messages.Println(messages.C.Green("OK\n"))
+
+	if len(effective.SecurityGroups) == 0 {
+		return nil
+	}
+	data := make([][]string, 0)
+	for i, secGroup := range effective.SecurityGroups {
+		data = append(data, []string{
+			fmt.Sprintf("#%d", i),
+			secGroup.Name,
+			secGroup.Lifecycle,
+			secGroup.Source,
+		})
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.Header("#", "name", "lifecycle", "applied by")
+	_ = table.Bulk(data)
+	_ = table.Render()
+
+	messages.Println(messages.C.Cyan("\nRules"))
+	data = make([][]string, 0)
+	for i, rule := range effective.Rules {
+		data = append(data, []string{
+			fmt.Sprintf("#%d", i),
+			rule.Protocol,
+			rule.Destination,
+			rule.Ports,
+			strings.Join(rule.Lifecycles, ", "),
+			strings.Join(rule.SecurityGroups, ", "),
+		})
+	}
+	table = tablewriter.NewWriter(os.Stdout)
+	table.Header("#", "protocol", "destination", "ports", "lifecycle", "security groups")
+	_ = table.Bulk(data)
+	_ = table.Render()
+	return nil
+}
+
+func init() {
+	desc := `Show security groups applied to a space, globally enabled or bound, with their merged rules`
+	_, err := parser.AddCommand(
+		"manager-space-security-groups",
+		desc,
+		desc,
+		&spaceCommand)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -41,6 +41,16 @@ func (c *UnbindCommand) Execute(_ []string) error {
 		return err
 	}
 
+	if c.BindOptions.Space == "" {
+		_, err = client.BindUnbindOrgSecurityGroup(secGroup.GUID, orgId, http.MethodDelete, client.GetEndpoint())
+		if err != nil {
+			return err
+		}
+		messages.Println(messages.C.Green("OK\n"))
+		messages.Println("TIP: If Dynamic ASG's are enabled, changes will automatically apply for running and staging applications. Otherwise, changes will require an app restart (for running) or restage (for staging) to apply to existing applications.")
+		return nil
+	}
+
 	spaces, err := getOrgSpaces(orgId)
 	if err != nil {
 		return err
@@ -50,7 +60,7 @@ func (c *UnbindCommand) Execute(_ []string) error {
 		if c.BindOptions.Space != "" && c.BindOptions.Space != space.Name {
 			continue
 		}
-		err := client.BindUnbindSecurityGroup(secGroup.GUID, space.Guid, http.MethodDelete, client.GetEndpoint())
+		_, err := client.BindUnbindSecurityGroup(secGroup.GUID, space.Guid, http.MethodDelete, client.GetEndpoint())
 		if err != nil {
 			return err
 		}
@@ -61,7 +71,7 @@ func (c *UnbindCommand) Execute(_ []string) error {
 }
 
 func init() {
-	desc := `Unbind a security group to a particular space, or all existing spaces of an org by an org manager`
+	desc := `Unbind a security group to a particular space, or all spaces of an org by an org manager`
 	_, err := parser.AddCommand(
 		"unbind-manager-security-group",
 		desc,
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
 	ccWrapper "code.cloudfoundry.org/cli/v8/api/cloudcontroller/wrapper"
@@ -90,6 +91,19 @@ func getOrgSpaces(orgId string) ([]plugin_models.GetOrg_Space, error) {
 	return spaceModel, nil
 }
 
+func getSpaceID(orgId, spaceName string) (string, error) {
+	spaces, err := getOrgSpaces(orgId)
+	if err != nil {
+		return "", err
+	}
+	for _, space := range spaces {
+		if space.Name == spaceName {
+			return space.Guid, nil
+		}
+	}
+	return "", fmt.Errorf("space %s not found", spaceName)
+}
+
 func joinResult(result []string) string {
 	return strings.Join(result, "\n")
 }
@@ -150,5 +164,7 @@ func genClient(endpoint string) *client.Client {
 		Proxy:           http.ProxyFromEnvironment,
 	}
 
-	return client.NewClient(endpoint, ccClientV3, accessToken, apiUrl, tr)
+	c := client.NewClient(endpoint, ccClientV3, accessToken, apiUrl, tr)
+	c.SetTimeout(time.Duration(options.Timeout) * time.Second)
+	return c
 }
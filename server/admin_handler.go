@@ -7,6 +7,7 @@ import (
 
 	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
 	"github.com/gorilla/context"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
 	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
 )
 
@@ -55,14 +56,14 @@ func handleBindSecGroup(w http.ResponseWriter, req *http.Request) {
 		serverErrorCode(w, req, http.StatusBadRequest, err)
 		return
 	}
-	space, err := cfclient.GetSpaceByGuid(binding.SpaceGUID)
+	space, err := getSpaceByGuid(req.Context(), binding.SpaceGUID)
 	if err != nil {
 		serverError(w, req, err)
 		return
 	}
 	orgGuid := space.Relationships[constant.RelationshipTypeOrganization].GUID
 	if !context.Get(req, ContextIsAdmin).(bool) {
-		hasAccess, err := isUserOrgManager(userId, orgGuid)
+		hasAccess, err := isUserOrgManager(req.Context(), userId, orgGuid)
 		if err != nil {
 			serverError(w, req, err)
 			return
@@ -73,13 +74,28 @@ func handleBindSecGroup(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 	if req.Method == http.MethodDelete {
-		err = cfclient.UnBindSecurityGroup(binding.SecurityGroupGUID, binding.SpaceGUID, cfclient.GetApiUrl())
-	} else {
-		err = cfclient.BindSecurityGroup(binding.SecurityGroupGUID, binding.SpaceGUID, cfclient.GetApiUrl())
+		err = cfclient.UnBindSecurityGroupContext(req.Context(), binding.SecurityGroupGUID, binding.SpaceGUID, cfclient.GetApiUrl())
+		countBindings("unbind", bindingOutcome(err), 1, client.LifecycleRunning, client.LifecycleStaging)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	estimates, ok := checkBindGuardrails(w, req, binding.SecurityGroupGUID, orgGuid, []string{client.LifecycleRunning, client.LifecycleStaging}, space)
+	if !ok {
+		return
+	}
+	if req.URL.Query().Get("dry_run") == "true" {
+		writeRuleEstimate(w, estimates[0])
+		return
 	}
+	err = cfclient.BindSecurityGroupContext(req.Context(), binding.SecurityGroupGUID, binding.SpaceGUID, cfclient.GetApiUrl())
+	countBindings("bind", bindingOutcome(err), 1, client.LifecycleRunning, client.LifecycleStaging)
 	if err != nil {
 		serverError(w, req, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	writeRuleEstimate(w, estimates[0])
 }
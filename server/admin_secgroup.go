@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/jinzhu/gorm"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// secGroupBody is the body of a request creating or updating a security group, as sent to cloud controller
+// by admins or with an organization_guid by org managers for private security groups
+type secGroupBody struct {
+	Name             string                  `json:"name"`
+	OrganizationGUID string                  `json:"organization_guid"`
+	Rules            *[]client.Rule          `json:"rules"`
+	GloballyEnabled  *client.GloballyEnabled `json:"globally_enabled"`
+	Relationships    json.RawMessage         `json:"relationships"`
+}
+
+// rules given in the body, nil when not set
+func (b secGroupBody) rules() []client.Rule {
+	if b.Rules == nil {
+		return nil
+	}
+	return *b.Rules
+}
+
+// create a security group, admins pass requests without organization_guid through to cloud controller,
+// other ones create private security groups
+func handleCreateSecGroup(w http.ResponseWriter, req *http.Request) {
+	body, ok := readSecGroupBody(w, req)
+	if !ok {
+		return
+	}
+	if body.OrganizationGUID != "" || !context.Get(req, ContextIsAdmin).(bool) {
+		handleCreateOrgSecGroup(w, req)
+		return
+	}
+	if body.Name == "" {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("name is required"))
+		return
+	}
+	if len(body.Relationships) > 0 && string(body.Relationships) != "null" {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("relationships can't be set on creation, bind spaces once the security group is created"))
+		return
+	}
+	if !checkRulesSyntax(w, req, body.rules()) {
+		return
+	}
+	globallyEnabled := body.GloballyEnabled != nil &&
+		((body.GloballyEnabled.Running != nil && *body.GloballyEnabled.Running) || (body.GloballyEnabled.Staging != nil && *body.GloballyEnabled.Staging))
+	if globallyEnabled {
+		offending, err := checkSecGroupChange(req.Context(), client.SecurityGroup{}, body.rules(), true)
+		if !checkOffendingRules(w, req, body.Name, offending, err) {
+			return
+		}
+	}
+
+	secGroup, err := cfclient.CreateSecurityGroupContext(req.Context(), client.SecurityGroupParams{
+		Name:            body.Name,
+		Rules:           body.Rules,
+		GloballyEnabled: body.GloballyEnabled,
+	})
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	auditSecGroup(req, "create", secGroup).Infof("security group %s created", secGroup.Name)
+	writeSecGroup(w, http.StatusCreated, secGroup)
+}
+
+// update or delete a security group, admins pass requests on security groups not owned by an org through to cloud controller,
+// other ones change private security groups
+func handleChangeSecGroup(w http.ResponseWriter, req *http.Request) {
+	secGroupGuid := strings.Split(req.URL.Path, "/")[3]
+	var body secGroupBody
+	if req.Method == http.MethodPatch {
+		var ok bool
+		body, ok = readSecGroupBody(w, req)
+		if !ok {
+			return
+		}
+	}
+	owned, err := isOrgSecGroup(secGroupGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if owned && body.GloballyEnabled != nil {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("security group %s is owned by an organization and can't be globally enabled", secGroupGuid))
+		return
+	}
+	if owned || !context.Get(req, ContextIsAdmin).(bool) {
+		handleChangeOrgSecGroup(w, req)
+		return
+	}
+
+	secGroup, err := getSecGroup(req.Context(), secGroupGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if req.Method == http.MethodDelete {
+		err = cfclient.DeleteSecurityGroupContext(req.Context(), secGroupGuid)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		auditSecGroup(req, "delete", secGroup).Infof("security group %s deleted", secGroup.Name)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if len(body.Relationships) > 0 && string(body.Relationships) != "null" {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("relationships can't be updated, use relationships endpoints to bind spaces"))
+		return
+	}
+	if !checkRulesSyntax(w, req, body.rules()) {
+		return
+	}
+	if body.Rules != nil || body.GloballyEnabled != nil {
+		rules := secGroup.Rules
+		if body.Rules != nil {
+			rules = *body.Rules
+		}
+		running := secGroup.RunningGloballyEnabled != nil && *secGroup.RunningGloballyEnabled
+		staging := secGroup.StagingGloballyEnabled != nil && *secGroup.StagingGloballyEnabled
+		if body.GloballyEnabled != nil && body.GloballyEnabled.Running != nil {
+			running = *body.GloballyEnabled.Running
+		}
+		if body.GloballyEnabled != nil && body.GloballyEnabled.Staging != nil {
+			staging = *body.GloballyEnabled.Staging
+		}
+		offending, err := checkSecGroupChange(req.Context(), secGroup, rules, running || staging)
+		if !checkOffendingRules(w, req, secGroup.Name, offending, err) {
+			return
+		}
+	}
+
+	updated, err := cfclient.UpdateSecurityGroupContext(req.Context(), secGroupGuid, client.SecurityGroupParams{
+		Name:            body.Name,
+		Rules:           body.Rules,
+		GloballyEnabled: body.GloballyEnabled,
+	})
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	auditSecGroup(req, "update", updated).Infof("security group %s updated", updated.Name)
+	writeSecGroup(w, http.StatusOK, updated)
+}
+
+// readSecGroupBody decode the body of a request creating or updating a security group, the body can be read again
+func readSecGroupBody(w http.ResponseWriter, req *http.Request) (secGroupBody, bool) {
+	var body secGroupBody
+	buf, err := io.ReadAll(req.Body)
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return body, false
+	}
+	req.Body = io.NopCloser(bytes.NewReader(buf))
+	if err = json.Unmarshal(buf, &body); err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return body, false
+	}
+	return body, true
+}
+
+// checkRulesSyntax refuse rules cloud controller would refuse, before sending them
+func checkRulesSyntax(w http.ResponseWriter, req *http.Request, rules []client.Rule) bool {
+	invalid := make([]string, 0)
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			invalid = append(invalid, fmt.Sprintf("rule %d: %s", i+1, err.Error()))
+		}
+	}
+	if len(invalid) > 0 {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("invalid rules: %s", strings.Join(invalid, "; ")))
+		return false
+	}
+	return true
+}
+
+func checkOffendingRules(w http.ResponseWriter, req *http.Request, secGroupName string, offending []string, err error) bool {
+	if err != nil {
+		serverError(w, req, err)
+		return false
+	}
+	if len(offending) > 0 {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("security group %s reaches forbidden destinations: %s", secGroupName, strings.Join(offending, "; ")))
+		return false
+	}
+	return true
+}
+
+// isOrgSecGroup check if a security group is a private security group owned by an org
+func isOrgSecGroup(secGroupGuid string) (bool, error) {
+	if gormDb == nil {
+		return false, nil
+	}
+	err := gormDb.Where("security_group_guid = ?", secGroupGuid).First(&model.OrgSecurityGroup{}).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// auditSecGroup give a log entry recording a change made by an admin on a security group
+func auditSecGroup(req *http.Request, action string, secGroup client.SecurityGroup) *log.Entry {
+	userId, _ := getUserId(req)
+	rules, _ := json.Marshal(secGroup.Rules)
+	return requestLog(req).WithFields(log.Fields{
+		"audit":               true,
+		"action":              action,
+		"user_id":             userId,
+		"security_group_guid": secGroup.GUID,
+		"security_group_name": secGroup.Name,
+		"rules":               string(rules),
+		"running_globally":    secGroup.RunningGloballyEnabled != nil && *secGroup.RunningGloballyEnabled,
+		"staging_globally":    secGroup.StagingGloballyEnabled != nil && *secGroup.StagingGloballyEnabled,
+	})
+}
+
+func writeSecGroup(w http.ResponseWriter, status int, secGroup client.SecurityGroup) {
+	b, _ := json.MarshalIndent(secGroup, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(b)
+}
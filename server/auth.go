@@ -14,13 +14,18 @@ import (
 
 const ContextIsAdmin = "isAdmin"
 
+// ContextPrincipal is the user id of the token, or its client id for a client token
+const ContextPrincipal = "principal"
+
 type AuthToken struct {
 	Type  string
 	Value string
 }
 
 type ScopeClaims struct {
-	Scope []string `json:"scope"`
+	Scope    []string `json:"scope"`
+	UserID   string   `json:"user_id"`
+	ClientID string   `json:"client_id"`
 	jwt.RegisteredClaims
 }
 
@@ -46,6 +51,17 @@ func (c ScopeClaims) IsAdmin() bool {
 	return false
 }
 
+// Principal give the user id of the token, or its client id for a client token
+func (c ScopeClaims) Principal() string {
+	if c.UserID != "" {
+		return c.UserID
+	}
+	if c.ClientID != "" {
+		return c.ClientID
+	}
+	return c.Subject
+}
+
 func NewAuth(jwt *model.JWT) *Auth {
 	return &Auth{
 		Jwt: jwt,
@@ -95,6 +111,7 @@ func (ah *Auth) authHandler(next http.Handler) http.Handler {
 		}
 
 		context.Set(r, ContextIsAdmin, claims.IsAdmin())
+		context.Set(r, ContextPrincipal, claims.Principal())
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type orgUserKey struct {
+	OrgGUID  string
+	UserGUID string
+}
+
+var spaceCache *TTLCache[string, client.Space]
+var orgManagerCache *TTLCache[orgUserKey, bool]
+
+func loadCaches(c model.ConfigServer) {
+	ttl := time.Duration(c.Cache.TTL) * time.Second
+	if c.StrictMode {
+		ttl = 0
+	}
+	spaceCache = NewTTLCache[string, client.Space]("space", ttl, c.Cache.MaxEntries)
+	orgManagerCache = NewTTLCache[orgUserKey, bool]("org_manager", ttl, c.Cache.MaxEntries)
+}
+
+type cacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTLCache is a size limited cache where entries expire after a ttl, a ttl of 0 disable the cache
+type TTLCache[K comparable, V any] struct {
+	mu         sync.Mutex
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	entries    map[K]cacheEntry[V]
+}
+
+func NewTTLCache[K comparable, V any](name string, ttl time.Duration, maxEntries int) *TTLCache[K, V] {
+	return &TTLCache[K, V]{
+		name:       name,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[K]cacheEntry[V]),
+	}
+}
+
+func (c *TTLCache[K, V]) Enabled() bool {
+	return c != nil && c.ttl > 0 && c.maxEntries > 0
+}
+
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if !c.Enabled() {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.expiresAt.Before(time.Now()) {
+		delete(c.entries, key)
+		gCacheTotal.WithLabelValues(c.name, "miss").Inc()
+		return zero, false
+	}
+	gCacheTotal.WithLabelValues(c.name, "hit").Inc()
+	return entry.value, true
+}
+
+func (c *TTLCache[K, V]) Set(key K, value V) {
+	if !c.Enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[key] = cacheEntry[V]{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *TTLCache[K, V]) Len() int {
+	if !c.Enabled() {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// evict remove expired entries, or the entry closest to expiration if none has expired
+func (c *TTLCache[K, V]) evict() {
+	now := time.Now()
+	var oldestKey K
+	var oldest *cacheEntry[V]
+	for k, entry := range c.entries {
+		if entry.expiresAt.Before(now) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldest == nil || entry.expiresAt.Before(oldest.expiresAt) {
+			oldestKey = k
+			oldest = &entry
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldest != nil {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// getSpaceByGuid retrieve a space from cache or from cloud controller
+func getSpaceByGuid(ctx context.Context, spaceGuid string) (client.Space, error) {
+	if space, ok := spaceCache.Get(spaceGuid); ok {
+		return space, nil
+	}
+	space, err := cfclient.GetSpaceByGuidContext(ctx, spaceGuid)
+	if err != nil {
+		return space, err
+	}
+	spaceCache.Set(spaceGuid, space)
+	return space, nil
+}
+
+// getManagedOrgs tell for each org if the user is an org manager of it, orgs missing from cache are retrieved at once.
+// Only managed orgs are cached so that a user granted the role is not refused until the entry expires.
+func getManagedOrgs(ctx context.Context, userId string, orgGuids []string) (map[string]bool, error) {
+	managed := make(map[string]bool)
+	missing := make([]string, 0)
+	for _, orgGuid := range orgGuids {
+		if _, ok := managed[orgGuid]; ok {
+			continue
+		}
+		isManager, ok := orgManagerCache.Get(orgUserKey{OrgGUID: orgGuid, UserGUID: userId})
+		if !ok {
+			missing = append(missing, orgGuid)
+		}
+		managed[orgGuid] = isManager
+	}
+	if len(missing) == 0 {
+		return managed, nil
+	}
+	retrieved, err := cfclient.GetManagedOrgsContext(ctx, userId, missing)
+	if err != nil {
+		return nil, err
+	}
+	for orgGuid, isManager := range retrieved {
+		if isManager {
+			orgManagerCache.Set(orgUserKey{OrgGUID: orgGuid, UserGUID: userId}, true)
+		}
+		managed[orgGuid] = isManager
+	}
+	return managed, nil
+}
+
+func init() {
+	prometheus.MustRegister(gCacheTotal)
+	prometheus.MustRegister(gCacheEntries...)
+}
+
+var gCacheTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "cfsecurity",
+		Name:      "cache_total",
+		Help:      "Number of cache lookups by result",
+	},
+	[]string{"cache", "result"},
+)
+
+// gCacheEntries give the number of entries of each cache at scrape time, expired ones included until they are evicted
+var gCacheEntries = []prometheus.Collector{
+	newCacheEntriesGauge("space", func() int { return spaceCache.Len() }),
+	newCacheEntriesGauge("org_manager", func() int { return orgManagerCache.Len() }),
+}
+
+func newCacheEntriesGauge(name string, size func() int) prometheus.GaugeFunc {
+	return prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   "cfsecurity",
+			Name:        "cache_entries",
+			Help:        "Number of entries in cache",
+			ConstLabels: prometheus.Labels{"cache": name},
+		},
+		func() float64 { return float64(size()) },
+	)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var ruleEstimateConfig model.RuleEstimateConfig
+
+// estimateBinding estimate the rules of spaces once a security group is bound to them on lifecycles,
+// estimates above the warning threshold get a warning
+func estimateBinding(ctx stdcontext.Context, secGroupGuid string, lifecycles []string, spaces ...client.Space) ([]client.RuleEstimate, error) {
+	secGroup, err := getSecGroup(ctx, secGroupGuid)
+	if err != nil {
+		return nil, err
+	}
+	estimates, err := client.EstimateRulesWith(ctx, cfclient, &secGroup, lifecycles, spaces...)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]client.RuleEstimate, 0, len(spaces))
+	for _, space := range spaces {
+		estimate := estimates[space.GUID]
+		estimate.WarningThreshold = ruleEstimateConfig.WarningThreshold
+		estimate.HardThreshold = ruleEstimateConfig.HardThreshold
+		if estimate.WarningThreshold > 0 && max(estimate.Running, estimate.Staging) > estimate.WarningThreshold {
+			estimate.Warning = fmt.Sprintf("%d rules on running and %d on staging exceed the warning threshold of %d, containers of the space may start slowly",
+				estimate.Running, estimate.Staging, estimate.WarningThreshold)
+			log.WithField("space_guid", space.GUID).Warnf("binding security group %s: %s", secGroup.Name, estimate.Warning)
+		}
+		result = append(result, estimate)
+	}
+	return result, nil
+}
+
+// overHardThreshold describe the estimates giving more rules than the hard threshold
+func overHardThreshold(estimates []client.RuleEstimate) []string {
+	exceeded := make([]string, 0)
+	if ruleEstimateConfig.HardThreshold <= 0 {
+		return exceeded
+	}
+	for _, estimate := range estimates {
+		if max(estimate.Running, estimate.Staging) > ruleEstimateConfig.HardThreshold {
+			exceeded = append(exceeded, fmt.Sprintf("space %s: %d rules on running and %d on staging, hard threshold is %d",
+				estimate.SpaceName, estimate.Running, estimate.Staging, ruleEstimateConfig.HardThreshold))
+		}
+	}
+	return exceeded
+}
+
+func writeRuleEstimate(w http.ResponseWriter, estimate client.RuleEstimate) {
+	b, _ := json.MarshalIndent(estimate, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+var forbiddenDestinations []forbiddenDestination
+
+// forbiddenDestination is a forbidden destination from config with its space pattern and destinations parsed
+type forbiddenDestination struct {
+	model.ForbiddenDestination
+	spaceRegex *regexp.Regexp
+	nets       []*net.IPNet
+}
+
+func loadForbiddenDestinations(c model.ConfigServer) error {
+	forbiddenDestinations = make([]forbiddenDestination, 0, len(c.ForbiddenDestinations))
+	for i, config := range c.ForbiddenDestinations {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("forbidden_destinations[%d]", i)
+		}
+		fd := forbiddenDestination{ForbiddenDestination: config}
+		if config.SpacePattern != "" {
+			spaceRegex, err := regexp.Compile(config.SpacePattern)
+			if err != nil {
+				return fmt.Errorf("invalid space pattern of forbidden destination %s: %s", config.Name, err)
+			}
+			fd.spaceRegex = spaceRegex
+		}
+		for _, destination := range config.Destinations {
+			ipNet, err := client.ParseDestination(strings.TrimSpace(destination))
+			if err != nil {
+				return fmt.Errorf("invalid forbidden destination %s: %s", config.Name, err)
+			}
+			fd.nets = append(fd.nets, ipNet)
+		}
+		if err := (client.Rule{Protocol: client.ProtocolTCP, Destination: "0.0.0.0", Ports: config.Ports}).Validate(); err != nil {
+			return fmt.Errorf("invalid forbidden destination %s: %s", config.Name, err)
+		}
+		forbiddenDestinations = append(forbiddenDestinations, fd)
+	}
+	return nil
+}
+
+// appliesTo check if the forbidden destination is set for a space
+func (fd forbiddenDestination) appliesTo(space client.Space) bool {
+	if fd.OrganizationGUID != "" && fd.OrganizationGUID != space.Relationships[constant.RelationshipTypeOrganization].GUID {
+		return false
+	}
+	return fd.spaceRegex == nil || fd.spaceRegex.MatchString(space.Name)
+}
+
+// reachedBy check if a rule let traffic go to the forbidden destination
+func (fd forbiddenDestination) reachedBy(rule client.Rule) bool {
+	if len(fd.Protocols) > 0 && !slices.Contains(fd.Protocols, client.ProtocolAll) && !slices.ContainsFunc(fd.Protocols, rule.AllowsProtocol) {
+		return false
+	}
+	if !rule.OverlapsPorts(fd.Ports) {
+		return false
+	}
+	if len(fd.nets) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(fd.nets, rule.OverlapsNet)
+}
+
+// checkBindGuardrails check that a security group can be bound to spaces of an org on lifecycles, an error is written
+// when it can't: private security groups of another org are refused and so are security groups reaching forbidden
+// destinations, exceeding binding quotas or giving more rules than the hard threshold. Rule estimates of the spaces are given.
+// Refused bindings are counted, except for dry runs.
+func checkBindGuardrails(w http.ResponseWriter, req *http.Request, secGroupGuid, orgGuid string, lifecycles []string, spaces ...client.Space) (estimates []client.RuleEstimate, ok bool) {
+	mw := NewMetricResponseWriter(w)
+	w = mw
+	defer func() {
+		if ok || req.URL.Query().Get("dry_run") == "true" {
+			return
+		}
+		outcome := "refused"
+		if mw.statusCode >= http.StatusInternalServerError {
+			outcome = "error"
+		}
+		countBindings("bind", outcome, len(spaces), lifecycles...)
+	}()
+	bindable, err := isBindableInOrg(secGroupGuid, orgGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return nil, false
+	}
+	if !bindable {
+		serverErrorCode(w, req, http.StatusForbidden, fmt.Errorf("security group %s is owned by another organization", secGroupGuid))
+		return nil, false
+	}
+	offending, err := checkForbiddenDestinations(req.Context(), secGroupGuid, spaces...)
+	if !checkOffendingRules(w, req, secGroupGuid, offending, err) {
+		return nil, false
+	}
+	exceeded, err := checkBindingQuotas(req.Context(), secGroupGuid, orgGuid, spaces...)
+	if err != nil {
+		serverError(w, req, err)
+		return nil, false
+	}
+	if len(exceeded) > 0 {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("security group %s exceeds binding quotas: %s", secGroupGuid, strings.Join(exceeded, "; ")))
+		return nil, false
+	}
+	estimates, err = estimateBinding(req.Context(), secGroupGuid, lifecycles, spaces...)
+	if err != nil {
+		serverError(w, req, err)
+		return nil, false
+	}
+	if exceeded = overHardThreshold(estimates); len(exceeded) > 0 {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("security group %s gives too many rules: %s", secGroupGuid, strings.Join(exceeded, "; ")))
+		return nil, false
+	}
+	return estimates, true
+}
+
+// checkNewSpaceGuardrails is like checkBindGuardrails for a space created in an org bound to a security group,
+// the reason of a refusal is given as an error
+func checkNewSpaceGuardrails(ctx stdcontext.Context, orgBinding model.OrgBinding, space client.Space) error {
+	offending, err := checkForbiddenDestinations(ctx, orgBinding.SecurityGroupGUID, space)
+	if err != nil {
+		return err
+	}
+	if len(offending) > 0 {
+		return fmt.Errorf("security group reaches forbidden destinations: %s", strings.Join(offending, "; "))
+	}
+	exceeded, err := checkBindingQuotas(ctx, orgBinding.SecurityGroupGUID, orgBinding.OrganizationGUID, space)
+	if err != nil {
+		return err
+	}
+	if len(exceeded) > 0 {
+		return fmt.Errorf("security group exceeds binding quotas: %s", strings.Join(exceeded, "; "))
+	}
+	if ruleEstimateConfig.HardThreshold <= 0 {
+		return nil
+	}
+	estimates, err := estimateBinding(ctx, orgBinding.SecurityGroupGUID, orgBindingLifecycles(orgBinding), space)
+	if err != nil {
+		return err
+	}
+	if exceeded = overHardThreshold(estimates); len(exceeded) > 0 {
+		return fmt.Errorf("security group gives too many rules: %s", strings.Join(exceeded, "; "))
+	}
+	return nil
+}
+
+// checkForbiddenDestinations give the rules of a security group reaching destinations forbidden in the spaces,
+// the security group is only retrieved when a forbidden destination applies to one of the spaces
+func checkForbiddenDestinations(ctx stdcontext.Context, secGroupGuid string, spaces ...client.Space) ([]string, error) {
+	if !slices.ContainsFunc(spaces, func(space client.Space) bool {
+		return slices.ContainsFunc(forbiddenDestinations, func(fd forbiddenDestination) bool { return fd.appliesTo(space) })
+	}) {
+		return nil, nil
+	}
+	secGroup, err := getSecGroup(ctx, secGroupGuid)
+	if err != nil {
+		return nil, err
+	}
+	return forbiddenRulesInSpaces(secGroup.Rules, spaces...), nil
+}
+
+// checkSecGroupChange give the rules reaching forbidden destinations when a security group get new rules
+// or is globally enabled, in which case every forbidden destination applies
+func checkSecGroupChange(ctx stdcontext.Context, secGroup client.SecurityGroup, rules []client.Rule, globallyEnabled bool) ([]string, error) {
+	if len(forbiddenDestinations) == 0 {
+		return nil, nil
+	}
+	if globallyEnabled {
+		offending := make([]string, 0)
+		for _, fd := range forbiddenDestinations {
+			offending = append(offending, fd.offendingRules(rules, "all spaces")...)
+		}
+		return offending, nil
+	}
+	spaces, err := cfclient.GetSecGroupSpacesContext(ctx, &secGroup)
+	if err != nil {
+		return nil, err
+	}
+	return forbiddenRulesInSpaces(rules, spaces.Resources...), nil
+}
+
+func forbiddenRulesInSpaces(rules []client.Rule, spaces ...client.Space) []string {
+	offending := make([]string, 0)
+	for _, space := range spaces {
+		for _, fd := range forbiddenDestinations {
+			if fd.appliesTo(space) {
+				offending = append(offending, fd.offendingRules(rules, "space "+space.Name)...)
+			}
+		}
+	}
+	return offending
+}
+
+// offendingRules describe rules reaching the forbidden destination, where tell which spaces are concerned
+func (fd forbiddenDestination) offendingRules(rules []client.Rule, where string) []string {
+	offending := make([]string, 0)
+	for i, rule := range rules {
+		if fd.reachedBy(rule) {
+			offending = append(offending, fmt.Sprintf("%s: rule %d (%s) reaches forbidden destination %s", where, i+1, formatRule(rule), fd.Name))
+		}
+	}
+	return offending
+}
+
+func getSecGroup(ctx stdcontext.Context, secGroupGuid string) (client.SecurityGroup, error) {
+	secGroups, err := cfclient.GetSecGroupsContext(ctx, []ccv3.Query{{Key: ccv3.GUIDFilter, Values: []string{secGroupGuid}}}, 0)
+	if err != nil {
+		return client.SecurityGroup{}, err
+	}
+	if len(secGroups.Resources) == 0 {
+		return client.SecurityGroup{}, fmt.Errorf("security group %s %w", secGroupGuid, client.ErrNotFound)
+	}
+	return secGroups.Resources[0], nil
+}
+
+func formatRule(rule client.Rule) string {
+	if rule.Ports == "" {
+		return rule.Protocol + " " + rule.Destination
+	}
+	return rule.Protocol + " " + rule.Destination + " " + rule.Ports
+}
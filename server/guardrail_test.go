@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+	"code.cloudfoundry.org/cli/v8/resources"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+// loadTestForbiddenDestinations load forbidden destinations for the test only
+func loadTestForbiddenDestinations(t *testing.T, configs ...model.ForbiddenDestination) []forbiddenDestination {
+	t.Helper()
+	t.Cleanup(func() { forbiddenDestinations = nil })
+	if err := loadForbiddenDestinations(model.ConfigServer{ForbiddenDestinations: configs}); err != nil {
+		t.Fatal(err)
+	}
+	return forbiddenDestinations
+}
+
+func testSpace(orgGuid, name string) client.Space {
+	return client.Space{Space: resources.Space{
+		Name: name,
+		Relationships: resources.Relationships{
+			constant.RelationshipTypeOrganization: resources.Relationship{GUID: orgGuid},
+		},
+	}}
+}
+
+func TestForbiddenDestinationReachedBy(t *testing.T) {
+	fds := loadTestForbiddenDestinations(t,
+		model.ForbiddenDestination{
+			Name:         "pci",
+			Destinations: []string{"10.20.0.0/16", " 192.168.1.10 "},
+			Ports:        "443,8000-8100",
+			Protocols:    []string{client.ProtocolTCP},
+		},
+		model.ForbiddenDestination{
+			Name:         "vault",
+			Destinations: []string{"10.30.0.5"},
+		},
+	)
+	pci, vault := fds[0], fds[1]
+
+	tests := []struct {
+		name string
+		fd   forbiddenDestination
+		rule client.Rule
+		want bool
+	}{
+		{name: "ip in cidr on port", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.20.1.5", Ports: "443"}, want: true},
+		{name: "ip in cidr on other port", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.20.1.5", Ports: "80"}, want: false},
+		{name: "forbidden ip", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "192.168.1.10", Ports: "8080"}, want: true},
+		{name: "ip outside", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.21.0.1", Ports: "443"}, want: false},
+		{name: "wider cidr", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.0.0.0/8", Ports: "443"}, want: true},
+		{name: "comma list with one forbidden", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "8.8.8.8, 10.20.3.3", Ports: "443"}, want: true},
+		{name: "comma list outside", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "8.8.8.8,192.168.1.11", Ports: "443"}, want: false},
+		{name: "range overlapping", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.19.255.250-10.20.0.2", Ports: "8050"}, want: true},
+		{name: "range around forbidden ip", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "192.168.1.1-192.168.1.20", Ports: "443"}, want: true},
+		{name: "range outside", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "192.168.1.11-192.168.1.20", Ports: "443"}, want: false},
+		{name: "no ports means any port", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.20.0.0/24"}, want: true},
+		{name: "port range overlapping", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.20.1.5", Ports: "8100-9000"}, want: true},
+		{name: "port list outside", fd: pci, rule: client.Rule{Protocol: "tcp", Destination: "10.20.1.5", Ports: "80,8101-9000"}, want: false},
+		{name: "other protocol", fd: pci, rule: client.Rule{Protocol: "udp", Destination: "10.20.1.5", Ports: "443"}, want: false},
+		{name: "protocol all", fd: pci, rule: client.Rule{Protocol: "all", Destination: "10.20.1.5"}, want: true},
+		{name: "icmp on forbidden ports", fd: pci, rule: client.Rule{Protocol: "icmp", Destination: "10.20.1.5"}, want: false},
+		{name: "icmp on any port and protocol", fd: vault, rule: client.Rule{Protocol: "icmp", Destination: "10.30.0.0/24"}, want: true},
+		{name: "udp on any port and protocol", fd: vault, rule: client.Rule{Protocol: "udp", Destination: "10.30.0.5", Ports: "53"}, want: true},
+		{name: "outside any port and protocol", fd: vault, rule: client.Rule{Protocol: "all", Destination: "10.30.0.6"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fd.reachedBy(tt.rule); got != tt.want {
+				t.Errorf("reachedBy(%+v) = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForbiddenDestinationAppliesTo(t *testing.T) {
+	fds := loadTestForbiddenDestinations(t,
+		model.ForbiddenDestination{Name: "pci-prod", OrganizationGUID: "org-pci", SpacePattern: "^prod", Destinations: []string{"10.20.0.0/16"}},
+		model.ForbiddenDestination{Name: "pci-org", OrganizationGUID: "org-pci", Destinations: []string{"10.20.0.0/16"}},
+		model.ForbiddenDestination{Name: "prod", SpacePattern: "^prod", Destinations: []string{"10.20.0.0/16"}},
+		model.ForbiddenDestination{Name: "everywhere", Destinations: []string{"10.20.0.0/16"}},
+	)
+
+	tests := []struct {
+		space client.Space
+		want  []bool
+	}{
+		{space: testSpace("org-pci", "prod-eu"), want: []bool{true, true, true, true}},
+		{space: testSpace("org-pci", "dev"), want: []bool{false, true, false, true}},
+		{space: testSpace("org-other", "prod"), want: []bool{false, false, true, true}},
+		{space: testSpace("org-other", "preprod"), want: []bool{false, false, false, true}},
+	}
+	for _, tt := range tests {
+		for i, fd := range fds {
+			if got := fd.appliesTo(tt.space); got != tt.want[i] {
+				t.Errorf("%s applies to %s of %s = %v, want %v", fd.Name, tt.space.Name,
+					tt.space.Relationships[constant.RelationshipTypeOrganization].GUID, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestLoadForbiddenDestinations(t *testing.T) {
+	t.Cleanup(func() { forbiddenDestinations = nil })
+	tests := []struct {
+		name    string
+		config  model.ForbiddenDestination
+		wantErr string
+	}{
+		{name: "valid", config: model.ForbiddenDestination{Destinations: []string{"10.0.0.0/8", "192.168.1.1"}, Ports: "443,8000-8100"}},
+		{name: "invalid space pattern", config: model.ForbiddenDestination{SpacePattern: "prod("}, wantErr: "invalid space pattern"},
+		{name: "invalid destination", config: model.ForbiddenDestination{Destinations: []string{"10.0.0.300"}}, wantErr: "invalid forbidden destination"},
+		{name: "ip range destination", config: model.ForbiddenDestination{Destinations: []string{"10.0.0.1-10.0.0.5"}}, wantErr: "invalid forbidden destination"},
+		{name: "invalid ports", config: model.ForbiddenDestination{Ports: "0-100"}, wantErr: "invalid ports"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadForbiddenDestinations(model.ConfigServer{ForbiddenDestinations: []model.ForbiddenDestination{tt.config}})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(forbiddenDestinations) != 1 || forbiddenDestinations[0].Name != "forbidden_destinations[0]" {
+					t.Errorf("forbidden destinations = %+v, want one with a default name", forbiddenDestinations)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestForbiddenRulesInSpaces(t *testing.T) {
+	loadTestForbiddenDestinations(t,
+		model.ForbiddenDestination{Name: "pci", OrganizationGUID: "org-pci", SpacePattern: "^prod", Destinations: []string{"10.20.0.0/16"}},
+	)
+	rules := []client.Rule{
+		{Protocol: "tcp", Destination: "8.8.8.8", Ports: "53"},
+		{Protocol: "tcp", Destination: "10.20.0.1", Ports: "443"},
+	}
+
+	if offending := forbiddenRulesInSpaces(rules, testSpace("org-pci", "dev"), testSpace("org-other", "prod")); len(offending) != 0 {
+		t.Errorf("offending = %v, want none outside prod spaces of org-pci", offending)
+	}
+	offending := forbiddenRulesInSpaces(rules, testSpace("org-pci", "dev"), testSpace("org-pci", "prod"))
+	if len(offending) != 1 || !strings.Contains(offending[0], "rule 2") || !strings.Contains(offending[0], "pci") {
+		t.Errorf("offending = %v, want rule 2 reaching pci", offending)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	stdcontext "context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// InventoryCollector count security groups and their bindings periodically for the inventory gauges,
+// scrapes only give the last count so that they never call cloud controller
+type InventoryCollector struct {
+	config model.InventoryConfig
+}
+
+func NewInventoryCollector(config model.InventoryConfig) *InventoryCollector {
+	return &InventoryCollector{config: config}
+}
+
+// Run count security groups at once and then on each interval, gauges keep the last successful count on failure
+func (ic *InventoryCollector) Run() {
+	ticker := time.NewTicker(time.Duration(ic.config.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		ctx, span := otel.Tracer(tracerName).Start(stdcontext.Background(), "InventoryCollector.collect")
+		err := ic.collect(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			log.Errorf("error when collecting security groups inventory: %s", err.Error())
+		}
+		span.End()
+		<-ticker.C
+	}
+}
+
+func (ic *InventoryCollector) collect(ctx stdcontext.Context) error {
+	if ic.config.Timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		ctx, cancel = stdcontext.WithTimeout(ctx, time.Duration(ic.config.Timeout)*time.Second)
+		defer cancel()
+	}
+	start := time.Now()
+	inventory, err := client.TakeInventoryWith(ctx, cfclient, client.InventoryLimits{
+		MaxSecurityGroups: ic.config.MaxSecurityGroups,
+		MaxSpaces:         ic.config.MaxSpaces,
+	})
+	gInventoryDuration.Set(time.Since(start).Seconds())
+	if err != nil {
+		gInventoryTotal.WithLabelValues("failure").Inc()
+		return err
+	}
+	gInventory.set(inventory, ic.config.MaxOrgs)
+	gInventoryTotal.WithLabelValues("success").Inc()
+	gInventoryLastSuccess.SetToCurrentTime()
+	return nil
+}
+
+// limitOrgs keep bindings of the maxOrgs orgs with most bindings and give the others summed by lifecycle, 0 means no limit
+func limitOrgs(bindings map[string]map[string]int, maxOrgs int) (map[string]map[string]int, map[string]int) {
+	if maxOrgs <= 0 || len(bindings) <= maxOrgs {
+		return bindings, nil
+	}
+	total := func(org string) int {
+		count := 0
+		for _, n := range bindings[org] {
+			count += n
+		}
+		return count
+	}
+	orgs := make([]string, 0, len(bindings))
+	for org := range bindings {
+		orgs = append(orgs, org)
+	}
+	slices.SortFunc(orgs, func(a, b string) int {
+		if total(a) != total(b) {
+			return total(b) - total(a)
+		}
+		return strings.Compare(a, b)
+	})
+	limited := make(map[string]map[string]int, maxOrgs)
+	others := make(map[string]int)
+	for i, org := range orgs {
+		if i < maxOrgs {
+			limited[org] = bindings[org]
+			continue
+		}
+		for lifecycle, n := range bindings[org] {
+			others[lifecycle] += n
+		}
+	}
+	return limited, others
+}
+
+// inventoryMetrics give the gauges of the last inventory, none before the first successful count
+type inventoryMetrics struct {
+	mu      sync.RWMutex
+	metrics []prometheus.Metric
+
+	securityGroups  *prometheus.Desc
+	globallyEnabled *prometheus.Desc
+	wideOpen        *prometheus.Desc
+	bindings        *prometheus.Desc
+	otherBindings   *prometheus.Desc
+	spaces          *prometheus.Desc
+	unboundSpaces   *prometheus.Desc
+}
+
+func newInventoryMetrics() *inventoryMetrics {
+	return &inventoryMetrics{
+		securityGroups:  prometheus.NewDesc("cfsecurity_inventory_security_groups", "Number of security groups", nil, nil),
+		globallyEnabled: prometheus.NewDesc("cfsecurity_inventory_globally_enabled_security_groups", "Number of security groups globally enabled by lifecycle", []string{"lifecycle"}, nil),
+		wideOpen:        prometheus.NewDesc("cfsecurity_inventory_wide_open_security_groups", "Number of security groups with a rule reaching any ipv4 address on any port", nil, nil),
+		bindings:        prometheus.NewDesc("cfsecurity_inventory_bindings", "Number of security groups bound to spaces by org and lifecycle", []string{"org", "lifecycle"}, nil),
+		otherBindings:   prometheus.NewDesc("cfsecurity_inventory_other_orgs_bindings", "Number of security groups bound to spaces of orgs beyond max orgs by lifecycle", []string{"lifecycle"}, nil),
+		spaces:          prometheus.NewDesc("cfsecurity_inventory_spaces", "Number of spaces", nil, nil),
+		unboundSpaces:   prometheus.NewDesc("cfsecurity_inventory_unbound_spaces", "Number of spaces without any security group bound, globally enabled ones aside", nil, nil),
+	}
+}
+
+func (im *inventoryMetrics) set(inventory client.Inventory, maxOrgs int) {
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(im.securityGroups, prometheus.GaugeValue, float64(inventory.SecurityGroups)),
+		prometheus.MustNewConstMetric(im.wideOpen, prometheus.GaugeValue, float64(inventory.WideOpen)),
+		prometheus.MustNewConstMetric(im.spaces, prometheus.GaugeValue, float64(inventory.Spaces)),
+		prometheus.MustNewConstMetric(im.unboundSpaces, prometheus.GaugeValue, float64(inventory.UnboundSpaces)),
+	}
+	for lifecycle, n := range inventory.GloballyEnabled {
+		metrics = append(metrics, prometheus.MustNewConstMetric(im.globallyEnabled, prometheus.GaugeValue, float64(n), lifecycle))
+	}
+	bindings, others := limitOrgs(inventory.Bindings, maxOrgs)
+	for org, lifecycles := range bindings {
+		for lifecycle, n := range lifecycles {
+			metrics = append(metrics, prometheus.MustNewConstMetric(im.bindings, prometheus.GaugeValue, float64(n), org, lifecycle))
+		}
+	}
+	for lifecycle, n := range others {
+		metrics = append(metrics, prometheus.MustNewConstMetric(im.otherBindings, prometheus.GaugeValue, float64(n), lifecycle))
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.metrics = metrics
+}
+
+func (im *inventoryMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- im.securityGroups
+	ch <- im.globallyEnabled
+	ch <- im.wideOpen
+	ch <- im.bindings
+	ch <- im.otherBindings
+	ch <- im.spaces
+	ch <- im.unboundSpaces
+}
+
+func (im *inventoryMetrics) Collect(ch chan<- prometheus.Metric) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+	for _, metric := range im.metrics {
+		ch <- metric
+	}
+}
+
+var (
+	gInventory         = newInventoryMetrics()
+	gInventoryDuration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "cfsecurity",
+			Name:      "inventory_collect_duration_seconds",
+			Help:      "Duration of the last count of security groups for the inventory",
+		},
+	)
+	gInventoryLastSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "cfsecurity",
+			Name:      "inventory_last_success_timestamp_seconds",
+			Help:      "Time of the last successful count of security groups for the inventory in unix seconds",
+		},
+	)
+	gInventoryTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cfsecurity",
+			Name:      "inventory_collect_total",
+			Help:      "Number of counts of security groups for the inventory by result",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(gInventory, gInventoryDuration, gInventoryLastSuccess, gInventoryTotal)
+}
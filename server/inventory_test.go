@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLimitOrgs(t *testing.T) {
+	bindings := map[string]map[string]int{
+		"big":   {"running": 10, "staging": 5},
+		"other": {"running": 4},
+		"small": {"running": 1, "staging": 1},
+		"tiny":  {"staging": 1},
+	}
+
+	tests := []struct {
+		name       string
+		maxOrgs    int
+		wantOrgs   []string
+		wantOthers map[string]int
+	}{
+		{name: "no limit", maxOrgs: 0, wantOrgs: []string{"big", "other", "small", "tiny"}},
+		{name: "under the limit", maxOrgs: 4, wantOrgs: []string{"big", "other", "small", "tiny"}},
+		{name: "org named other kept apart", maxOrgs: 2, wantOrgs: []string{"big", "other"}, wantOthers: map[string]int{"running": 1, "staging": 2}},
+		{name: "org named other summed", maxOrgs: 1, wantOrgs: []string{"big"}, wantOthers: map[string]int{"running": 5, "staging": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limited, others := limitOrgs(bindings, tt.maxOrgs)
+			if len(limited) != len(tt.wantOrgs) {
+				t.Errorf("orgs = %v, want %v", limited, tt.wantOrgs)
+			}
+			for _, org := range tt.wantOrgs {
+				if limited[org] == nil || limited[org]["running"] != bindings[org]["running"] || limited[org]["staging"] != bindings[org]["staging"] {
+					t.Errorf("bindings of %s = %v, want %v", org, limited[org], bindings[org])
+				}
+			}
+			if len(others) != len(tt.wantOthers) {
+				t.Errorf("others = %v, want %v", others, tt.wantOthers)
+			}
+			for lifecycle, n := range tt.wantOthers {
+				if others[lifecycle] != n {
+					t.Errorf("others on %s = %d, want %d", lifecycle, others[lifecycle], n)
+				}
+			}
+		})
+	}
+}
@@ -2,13 +2,19 @@ package main
 
 import (
 	"net/http"
+	"regexp"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/context"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
 	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
 	log "github.com/sirupsen/logrus"
 )
 
+// requestIDRegex is the request ids kept from requests, gorouter ids are uuids optionally joined by ::
+var requestIDRegex = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,255}$`)
+
 func loadLogConfig(c model.ConfigServer) {
 	if c.LogJSON != nil {
 		if *c.LogJSON {
@@ -42,9 +48,28 @@ func loadLogConfig(c model.ConfigServer) {
 	}
 }
 
+// requestIDHandler give each request the id sent in X-Vcap-Request-Id or a new one when it is missing or invalid,
+// the id is sent back in response headers, logged and forwarded to cloud controller
+func requestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(client.RequestIDHeader)
+		if !requestIDRegex.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		res.Header().Set(client.RequestIDHeader, requestID)
+		next.ServeHTTP(res, req.WithContext(client.WithRequestID(req.Context(), requestID)))
+	})
+}
+
+// requestLog give a log entry with the id of the request
+func requestLog(req *http.Request) *log.Entry {
+	return log.WithField("request_id", client.RequestIDFromContext(req.Context()))
+}
+
 func logHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		fields := log.Fields{
+			"request_id": client.RequestIDFromContext(req.Context()),
 			"method":     req.Method,
 			"path":       req.RequestURI,
 			"remote":     req.RemoteAddr,
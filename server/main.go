@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
@@ -20,6 +23,7 @@ import (
 	_ "github.com/cloudfoundry-community/gautocloud/connectors/databases/gorm"
 	"github.com/cloudfoundry-community/gautocloud/connectors/generic"
 	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
 
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
@@ -50,8 +54,9 @@ func main() {
 	panic(boot())
 }
 
-var expiresAt time.Time
-var cfclient *client.Client
+var tokenManager *TokenManager
+var cfclient client.API
+var gormDb *gorm.DB
 
 func boot() error {
 	kingpin.Version(version.Print("cfsecurity-server"))
@@ -65,35 +70,109 @@ func boot() error {
 	if err != nil {
 		return err
 	}
+	r, err := setup(config)
+	if err != nil {
+		return err
+	}
+	go reloadOnHangup()
+
+	port := gautocloud.GetAppInfo().Port
+	if port == 0 {
+		port = 8091
+	}
+	if (config.SSLCertFile != "") && (config.SSLKeyFile != "") {
+		log.Infof("serving https on %s", fmt.Sprintf(":%d", port))
+		return http.ListenAndServeTLS(fmt.Sprintf(":%d", port), config.SSLCertFile, config.SSLKeyFile, r)
+	}
+	log.Infof("serving http on %s", fmt.Sprintf(":%d", port))
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), r)
+}
+
+// setup load clients, caches and database from config and give the router of the server,
+// tests can use it to run the server against the fake cloud controller of package clienttest
+func setup(config model.ConfigServer) (*mux.Router, error) {
 	loadLogConfig(config)
+	err := loadTracing(config.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	loadCaches(config)
+	privateSecGroups = config.PrivateSecurityGroups
+	bindingQuotas = config.BindingQuotas
+	ruleEstimateConfig = config.RuleEstimate
+	rateLimiter.Load(config.RateLimit)
+	err = loadForbiddenDestinations(config)
+	if err != nil {
+		return nil, err
+	}
 	err = loadClient(shallowDefaultTransport(config.TrustedCaCertificates, config.CloudFoundry.SkipSSLValidation), config)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if config.Inventory.Interval > 0 {
+		go NewInventoryCollector(config.Inventory).Run()
+	}
+
+	gormDb, err = loadDb(config)
+	if err != nil {
+		log.Warnf("org bindings and private security groups are disabled, no database available: %s", err.Error())
+	} else {
+		watcher := NewSpaceWatcher(gormDb, time.Duration(config.OrgBindingPollInterval)*time.Second)
+		go watcher.Run()
 	}
 
 	r := mux.NewRouter()
 	auth := NewAuth(&config.JWT)
+	r.Use(requestIDHandler)
+	r.Use(tracingHandler)
+	r.Use(metricHandler)
 	r.Use(auth.authHandler)
 	r.Use(logHandler)
-	r.Use(metricHandler)
+	r.Use(rateLimitHandler)
 
 	r.HandleFunc("/v2/security_entitlement", handleEntitleSecGroup).Methods("POST")
 	r.HandleFunc("/v2/security_entitlement", handleRevokeSecGroup).Methods("DELETE")
 	r.HandleFunc("/v2/security_entitlement", handleListSecGroup).Methods("GET")
-	r.PathPrefix("/v3/security_groups").HandlerFunc(secGoupsHandler).Methods("GET", "POST", "DELETE")
+	r.HandleFunc("/v3/security_groups", findSecGroup).Methods("GET")
+	r.HandleFunc("/v3/security_groups", handleCreateSecGroup).Methods("POST")
+	r.HandleFunc("/v3/security_groups/{guid}", findSecGroup).Methods("GET")
+	r.HandleFunc("/v3/security_groups/{guid}", handleChangeSecGroup).Methods("PATCH", "DELETE")
+	r.HandleFunc("/v3/security_groups/{guid}/relationships/running_spaces", bindOrUnbindSecGroup).Methods("POST")
+	r.HandleFunc("/v3/security_groups/{guid}/relationships/running_spaces/{space_guid}", bindOrUnbindSecGroup).Methods("DELETE")
+	r.HandleFunc("/v3/security_groups/{guid}/relationships/staging_spaces", bindOrUnbindSecGroup).Methods("POST")
+	r.HandleFunc("/v3/security_groups/{guid}/relationships/staging_spaces/{space_guid}", bindOrUnbindSecGroup).Methods("DELETE")
+	r.HandleFunc("/v3/security_groups/{guid}/relationships/spaces/{space_guid}/check", checkBind).Methods("GET")
+	r.HandleFunc("/v3/security_group_templates", handleListSecGroupTemplates).Methods("GET")
 	r.HandleFunc("/v3/bindings", handleBindSecGroup).Methods("POST", "DELETE")
+	r.HandleFunc("/v3/spaces/{guid}/effective_security_groups", handleEffectiveSecGroups).Methods("GET")
+	r.HandleFunc("/v3/spaces/{guid}/check_egress", handleCheckEgress).Methods("GET")
+	r.HandleFunc("/v3/reachable_spaces", handleReachableSpaces).Methods("GET")
+	r.HandleFunc("/v3/org_bindings", handleOrgBinding).Methods("POST", "DELETE")
+	r.HandleFunc("/v3/org_bindings", handleListOrgBindings).Methods("GET")
+	r.HandleFunc("/v3/org_bindings/actions", handleListOrgBindingActions).Methods("GET")
+	r.HandleFunc("/v3/org_security_groups", handleListOrgSecGroups).Methods("GET")
+	r.HandleFunc("/v3/org_security_groups/policy", handleOrgSecGroupPolicy).Methods("GET")
+	r.HandleFunc("/v3/binding_quotas", handleBindingQuotaUsage).Methods("GET")
 	r.Handle("/metrics", promhttp.Handler())
+	return r, nil
+}
 
-	port := gautocloud.GetAppInfo().Port
-	if port == 0 {
-		port = 8091
-	}
-	if (config.SSLCertFile != "") && (config.SSLKeyFile != "") {
-		log.Infof("serving https on %s", fmt.Sprintf(":%d", port))
-		return http.ListenAndServeTLS(fmt.Sprintf(":%d", port), config.SSLCertFile, config.SSLKeyFile, r)
+// reloadOnHangup reload config when the server receives SIGHUP, only rate limits are taken from the new config
+func reloadOnHangup() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		gautocloud.Reload()
+		var config model.ConfigServer
+		err := gautocloud.Inject(&config)
+		if err != nil {
+			log.Errorf("error when reloading config: %s", err.Error())
+			continue
+		}
+		rateLimiter.Load(config.RateLimit)
+		log.Info("rate limits reloaded")
 	}
-	log.Infof("serving http on %s", fmt.Sprintf(":%d", port))
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), r)
 }
 
 func loadClient(transport *http.Transport, c model.ConfigServer) error {
@@ -151,22 +230,48 @@ func loadClient(transport *http.Transport, c model.ConfigServer) error {
 	}
 	tr := shallowDefaultTransport(c.TrustedCaCertificates, c.CloudFoundry.SkipSSLValidation)
 
-	accessToken, _, err := AuthenticateWithExpire(c.CloudFoundry.UAAEndpoint, config.UAAOAuthClient(), config.UAAOAuthClientSecret(), tr)
-	if err != nil {
-		return fmt.Errorf("error when authenticate on cf: %s", err)
-	}
-	if accessToken == "" {
-		return fmt.Errorf("a pair of username/password or a pair of client_id/client_secret muste be set")
-	}
-
-	cfclient = client.NewClient(c.CloudFoundry.Endpoint, ccClientV3, accessToken, info.Links.Self.HREF, tr)
+	tokenManager = NewTokenManager(func() (string, time.Time, error) {
+		accessToken, expiresAt, err := AuthenticateWithExpire(c.CloudFoundry.UAAEndpoint, config.UAAOAuthClient(), config.UAAOAuthClientSecret(), tr)
+		if err != nil {
+			return "", expiresAt, fmt.Errorf("error when authenticate on cf: %s", err)
+		}
+		return accessToken, expiresAt, nil
+	})
+	accessToken, err := tokenManager.Token()
 	if err != nil {
 		return err
 	}
 
+	cc := client.NewClient(c.CloudFoundry.Endpoint, ccClientV3, accessToken, info.Links.Self.HREF, tr)
+	cc.SetTokenSource(tokenManager)
+	cc.SetRetryPolicy(retryPolicy(c.Retry))
+	cc.SetCallObserver(observeCall)
+	cfclient = cc
+	go tokenManager.Run()
+
 	return nil
 }
 
+func loadDb(c model.ConfigServer) (*gorm.DB, error) {
+	var db *gorm.DB
+	err := gautocloud.Inject(&db)
+	if err != nil {
+		if !c.FallbackToSqlite {
+			return nil, err
+		}
+		log.Warnf("no database found, falling back to sqlite: %s", err.Error())
+		db, err = gorm.Open("sqlite3", "cfsecurity.db")
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = db.AutoMigrate(&model.OrgBinding{}, &model.OrgBindingAction{}, &model.OrgSecurityGroup{}).Error
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
 func loadTranslatedTransportUaa(httpClient *http.Client, transport *http.Transport, c model.ConfigServer) (http.RoundTripper, error) {
 	var roundTripper http.RoundTripper
 	roundTripper = transport
@@ -263,13 +368,13 @@ func AuthenticateWithExpire(endpoint string, clientId string, clientSecret strin
 		return "", time.Now(), errors.Wrap(err, "Error unmarshalling Auth")
 	}
 
+	if accessTokens.AccessToken == "" {
+		return "", time.Now(), fmt.Errorf("a pair of username/password or a pair of client_id/client_secret muste be set")
+	}
 	accessToken := fmt.Sprintf("bearer %s", accessTokens.AccessToken)
 
 	expiresIn := time.Duration(accessTokens.Expires) * time.Second
-	expires := time.Now().Add(expiresIn)
-
-	// Taking 10 minute off the timer to have a margin of error
-	expiresAt = expires.Add(time.Duration(-10) * time.Minute)
+	expiresAt := time.Now().Add(expiresIn)
 
 	return accessToken, expiresAt, err
 }
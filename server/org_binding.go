@@ -0,0 +1,444 @@
+package main
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"github.com/gorilla/context"
+	"github.com/jinzhu/gorm"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// bind or unbind a security group to all spaces of an org, the org binding is kept to bind spaces created later
+func handleOrgBinding(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if !checkOrgBindingsEnabled(w, req) {
+		return
+	}
+	var params model.OrgBindingParams
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	if params.SecurityGroupGUID == "" || params.OrganizationGUID == "" {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("security_group_guid and organization_guid are required"))
+		return
+	}
+	orgBinding := model.OrgBinding{
+		SecurityGroupGUID: params.SecurityGroupGUID,
+		OrganizationGUID:  params.OrganizationGUID,
+		Running:           params.Lifecycle == "" || params.Lifecycle == client.LifecycleRunning,
+		Staging:           params.Lifecycle == "" || params.Lifecycle == client.LifecycleStaging,
+	}
+	if !orgBinding.Running && !orgBinding.Staging {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("invalid lifecycle '%s'", params.Lifecycle))
+		return
+	}
+	hasAccess, err := canManageOrg(req, params.OrganizationGUID)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if !hasAccess {
+		serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+		return
+	}
+
+	checkedAt := time.Now()
+	spaces, err := cfclient.GetSpacesWithOrgContext(req.Context(), []ccv3.Query{{Key: ccv3.OrganizationGUIDFilter, Values: []string{params.OrganizationGUID}}}, 0)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if req.Method != http.MethodDelete {
+		estimates, ok := checkBindGuardrails(w, req, params.SecurityGroupGUID, params.OrganizationGUID, orgBindingLifecycles(orgBinding), spaces.Resources...)
+		if !ok {
+			return
+		}
+		orgBinding.RuleEstimates = estimates
+		if req.URL.Query().Get("dry_run") == "true" {
+			b, _ := json.MarshalIndent(orgBinding, "", "  ")
+			w.Header().Add("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(b)
+			return
+		}
+	}
+
+	var stored model.OrgBinding
+	err = gormDb.Where("security_group_guid = ? AND organization_guid = ?", params.SecurityGroupGUID, params.OrganizationGUID).First(&stored).Error
+	exists := err == nil
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		serverError(w, req, err)
+		return
+	}
+
+	if req.Method == http.MethodDelete {
+		err = unbindOrgSpaces(req.Context(), orgBinding, spaces)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		if exists {
+			// only the given lifecycles are unbound, the org binding is kept for the other one
+			stored.Running = stored.Running && !orgBinding.Running
+			stored.Staging = stored.Staging && !orgBinding.Staging
+			if stored.Running || stored.Staging {
+				err = gormDb.Save(&stored).Error
+			} else {
+				err = gormDb.Delete(&stored).Error
+			}
+			if err != nil {
+				serverError(w, req, err)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	for _, space := range spaces.Resources {
+		for _, lifecycle := range orgBindingLifecycles(orgBinding) {
+			err = bindSpaceLifecycle(req.Context(), orgBinding.SecurityGroupGUID, space.GUID, lifecycle)
+			if err != nil {
+				serverError(w, req, err)
+				return
+			}
+		}
+	}
+	if exists {
+		// lifecycles already bound stay bound, new spaces keep being checked from the last check
+		stored.Running = stored.Running || orgBinding.Running
+		stored.Staging = stored.Staging || orgBinding.Staging
+		stored.RuleEstimates = orgBinding.RuleEstimates
+		orgBinding = stored
+		err = gormDb.Save(&orgBinding).Error
+	} else {
+		// spaces created before the check were bound above
+		orgBinding.CreatedAt = checkedAt
+		orgBinding.LastCheckedAt = checkedAt
+		err = gormDb.Create(&orgBinding).Error
+	}
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	b, _ := json.MarshalIndent(orgBinding, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(b)
+}
+
+// list org bindings, org managers must give an organization_guid they manage
+func handleListOrgBindings(w http.ResponseWriter, req *http.Request) {
+	if !checkOrgBindingsEnabled(w, req) {
+		return
+	}
+	var orgBindings []model.OrgBinding
+	listOrgRecords(w, req, &orgBindings)
+}
+
+// list bindings made automatically on new spaces
+func handleListOrgBindingActions(w http.ResponseWriter, req *http.Request) {
+	if !checkOrgBindingsEnabled(w, req) {
+		return
+	}
+	var actions []model.OrgBindingAction
+	listOrgRecords(w, req, &actions)
+}
+
+// checkOrgBindingsEnabled answer 501 when no database is configured to keep org bindings
+func checkOrgBindingsEnabled(w http.ResponseWriter, req *http.Request) bool {
+	if gormDb == nil {
+		serverErrorCode(w, req, http.StatusNotImplemented, fmt.Errorf("org bindings require a database"))
+		return false
+	}
+	return true
+}
+
+// listOrgRecords write records of the database filtered on the organization_guid query param,
+// callers check the database is configured
+func listOrgRecords(w http.ResponseWriter, req *http.Request, records interface{}) {
+	orgGuid := req.URL.Query().Get("organization_guid")
+	if orgGuid == "" && !context.Get(req, ContextIsAdmin).(bool) {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("organization_guid is required"))
+		return
+	}
+	db := gormDb
+	if orgGuid != "" {
+		hasAccess, err := canManageOrg(req, orgGuid)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		if !hasAccess {
+			serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+			return
+		}
+		db = db.Where("organization_guid = ?", orgGuid)
+	}
+	err := db.Find(records).Error
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	b, _ := json.MarshalIndent(records, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+func orgBindingLifecycles(orgBinding model.OrgBinding) []string {
+	lifecycles := make([]string, 0)
+	if orgBinding.Running {
+		lifecycles = append(lifecycles, client.LifecycleRunning)
+	}
+	if orgBinding.Staging {
+		lifecycles = append(lifecycles, client.LifecycleStaging)
+	}
+	return lifecycles
+}
+
+func bindSpaceLifecycle(ctx stdcontext.Context, secGroupGuid, spaceGuid, lifecycle string) error {
+	var err error
+	if lifecycle == client.LifecycleStaging {
+		err = cfclient.BindStagingSecGroupToSpaceContext(ctx, secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+	} else {
+		err = cfclient.BindRunningSecGroupToSpaceContext(ctx, secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+	}
+	countBindings("bind", bindingOutcome(err), 1, lifecycle)
+	return err
+}
+
+// unbindOrgSpaces unbind a security group from spaces of an org which are currently bound to it
+func unbindOrgSpaces(ctx stdcontext.Context, orgBinding model.OrgBinding, spaces client.Spaces) error {
+	secGroup, err := getSecGroup(ctx, orgBinding.SecurityGroupGUID)
+	if err != nil {
+		return err
+	}
+	orgSpaces := make(map[string]bool)
+	for _, space := range spaces.Resources {
+		orgSpaces[space.GUID] = true
+	}
+	if orgBinding.Running {
+		for _, data := range secGroup.Relationships.Running_Spaces.Data {
+			if !orgSpaces[data.GUID] {
+				continue
+			}
+			err = cfclient.UnBindRunningSecGroupToSpaceContext(ctx, orgBinding.SecurityGroupGUID, data.GUID, cfclient.GetApiUrl())
+			countBindings("unbind", bindingOutcome(err), 1, client.LifecycleRunning)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if orgBinding.Staging {
+		for _, data := range secGroup.Relationships.Staging_Spaces.Data {
+			if !orgSpaces[data.GUID] {
+				continue
+			}
+			err = cfclient.UnBindStagingSecGroupToSpaceContext(ctx, orgBinding.SecurityGroupGUID, data.GUID, cfclient.GetApiUrl())
+			countBindings("unbind", bindingOutcome(err), 1, client.LifecycleStaging)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// maxOrgBindingAttempts is how many times binding a new space from an org binding is attempted when it keeps failing
+const maxOrgBindingAttempts = 5
+
+// SpaceWatcher poll cloud controller for spaces created in orgs having org bindings and bind them
+type SpaceWatcher struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+func NewSpaceWatcher(db *gorm.DB, interval time.Duration) *SpaceWatcher {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &SpaceWatcher{db: db, interval: interval}
+}
+
+func (sw *SpaceWatcher) Run() {
+	ticker := time.NewTicker(sw.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, span := otel.Tracer(tracerName).Start(stdcontext.Background(), "SpaceWatcher.check")
+		err := sw.check(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// check bind spaces created in orgs having org bindings, an error on an org is logged and doesn't prevent
+// checking the other orgs, errors of all orgs are given back joined
+func (sw *SpaceWatcher) check(ctx stdcontext.Context) error {
+	var orgBindings []model.OrgBinding
+	err := sw.db.Find(&orgBindings).Error
+	if err != nil {
+		log.Errorf("error when checking new spaces for org bindings: %s", err.Error())
+		return err
+	}
+	if len(orgBindings) == 0 {
+		return nil
+	}
+
+	byOrg := make(map[string][]model.OrgBinding)
+	for _, orgBinding := range orgBindings {
+		byOrg[orgBinding.OrganizationGUID] = append(byOrg[orgBinding.OrganizationGUID], orgBinding)
+	}
+	var errs []error
+	for orgGuid, bindings := range byOrg {
+		err = sw.checkOrg(ctx, orgGuid, bindings)
+		if err != nil {
+			log.WithField("organization_guid", orgGuid).Errorf("error when checking new spaces for org bindings: %s", err.Error())
+			errs = append(errs, fmt.Errorf("organization %s: %w", orgGuid, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkOrg bind spaces created in an org since its org bindings were last checked and retry failed ones
+func (sw *SpaceWatcher) checkOrg(ctx stdcontext.Context, orgGuid string, bindings []model.OrgBinding) error {
+	after := bindings[0].LastCheckedAt
+	for _, orgBinding := range bindings {
+		if orgBinding.LastCheckedAt.Before(after) {
+			after = orgBinding.LastCheckedAt
+		}
+	}
+	checkedAt := time.Now()
+	// cloud controller clock may differ from ours, already bound spaces are skipped thanks to recorded actions
+	spaces, err := cfclient.GetSpacesCreatedAfterContext(ctx, []string{orgGuid}, after.Add(-sw.interval))
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]bool, len(spaces.Resources))
+	for _, space := range spaces.Resources {
+		listed[space.GUID] = true
+		for _, orgBinding := range bindings {
+			if space.CreatedAt.Before(orgBinding.CreatedAt) {
+				// bound when the org binding was made
+				continue
+			}
+			sw.bindNewSpace(ctx, orgBinding, space)
+		}
+	}
+	for _, orgBinding := range bindings {
+		err = sw.retryFailedSpaces(ctx, orgBinding, listed)
+		if err != nil {
+			return err
+		}
+	}
+	return sw.db.Model(&model.OrgBinding{}).
+		Where("organization_guid = ?", orgGuid).
+		Update("last_checked_at", checkedAt).Error
+}
+
+// retryFailedSpaces bind again spaces whose binding from an org binding failed and which were not just listed,
+// they have left the window of new spaces. Deleted spaces are given up.
+func (sw *SpaceWatcher) retryFailedSpaces(ctx stdcontext.Context, orgBinding model.OrgBinding, listed map[string]bool) error {
+	var spaceGuids []string
+	err := sw.db.Model(&model.OrgBindingAction{}).
+		Where("security_group_guid = ? AND organization_guid = ? AND lifecycle IN (?) AND error <> ''",
+			orgBinding.SecurityGroupGUID, orgBinding.OrganizationGUID, orgBindingLifecycles(orgBinding)).
+		Where("NOT EXISTS (SELECT 1 FROM org_binding_actions bound WHERE bound.security_group_guid = org_binding_actions.security_group_guid "+
+			"AND bound.space_guid = org_binding_actions.space_guid AND bound.lifecycle = org_binding_actions.lifecycle AND bound.error = '')").
+		Group("space_guid, lifecycle").
+		Having("MAX(attempts) < ?", maxOrgBindingAttempts).
+		Pluck("space_guid", &spaceGuids).Error
+	if err != nil {
+		return err
+	}
+	retried := make(map[string]bool)
+	for _, spaceGuid := range spaceGuids {
+		if listed[spaceGuid] || retried[spaceGuid] {
+			continue
+		}
+		retried[spaceGuid] = true
+		space, err := cfclient.GetSpaceByGuidContext(ctx, spaceGuid)
+		if errors.Is(err, client.ErrNotFound) {
+			err = sw.db.Model(&model.OrgBindingAction{}).
+				Where("security_group_guid = ? AND space_guid = ? AND error <> ''", orgBinding.SecurityGroupGUID, spaceGuid).
+				Updates(map[string]interface{}{"attempts": maxOrgBindingAttempts, "error": err.Error()}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if space.GUID != "" {
+			sw.bindNewSpace(ctx, orgBinding, space)
+		}
+	}
+	return nil
+}
+
+// pendingAction give the action to attempt for binding a space on a lifecycle, the last failed one
+// or a new one, false is given when the space is already bound or attempts are exhausted
+func (sw *SpaceWatcher) pendingAction(orgBinding model.OrgBinding, space client.Space, lifecycle string) (model.OrgBindingAction, bool) {
+	key := sw.db.Where("security_group_guid = ? AND space_guid = ? AND lifecycle = ?", orgBinding.SecurityGroupGUID, space.GUID, lifecycle)
+	var bound int
+	key.Model(&model.OrgBindingAction{}).Where("error = ''").Count(&bound)
+	if bound > 0 {
+		return model.OrgBindingAction{}, false
+	}
+	var action model.OrgBindingAction
+	if key.Order("attempts desc, id desc").First(&action).RecordNotFound() {
+		action = model.OrgBindingAction{
+			SecurityGroupGUID: orgBinding.SecurityGroupGUID,
+			OrganizationGUID:  orgBinding.OrganizationGUID,
+			SpaceGUID:         space.GUID,
+			Lifecycle:         lifecycle,
+		}
+	}
+	action.SpaceName = space.Name
+	return action, action.Attempts < maxOrgBindingAttempts
+}
+
+func (sw *SpaceWatcher) bindNewSpace(ctx stdcontext.Context, orgBinding model.OrgBinding, space client.Space) {
+	err := checkNewSpaceGuardrails(ctx, orgBinding, space)
+	for _, lifecycle := range orgBindingLifecycles(orgBinding) {
+		action, ok := sw.pendingAction(orgBinding, space, lifecycle)
+		if !ok {
+			continue
+		}
+		entry := log.WithFields(log.Fields{
+			"security_group_guid": action.SecurityGroupGUID,
+			"organization_guid":   action.OrganizationGUID,
+			"space_guid":          action.SpaceGUID,
+			"lifecycle":           action.Lifecycle,
+		})
+		bindErr := err
+		if bindErr == nil {
+			bindErr = bindSpaceLifecycle(ctx, orgBinding.SecurityGroupGUID, space.GUID, lifecycle)
+		} else {
+			countBindings("bind", "refused", 1, lifecycle)
+		}
+		action.Attempts++
+		action.Error = ""
+		if bindErr != nil {
+			action.Error = bindErr.Error()
+			entry.Errorf("error when binding new space from org binding (attempt %d of %d): %s", action.Attempts, maxOrgBindingAttempts, bindErr.Error())
+		} else {
+			entry.Infof("new space bound from org binding")
+		}
+		if err := sw.db.Save(&action).Error; err != nil {
+			entry.Errorf("error when recording org binding action: %s", err.Error())
+		}
+	}
+}
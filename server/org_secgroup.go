@@ -0,0 +1,426 @@
+package main
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/jinzhu/gorm"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var privateSecGroups model.PrivateSecGroupsConfig
+
+// defaultAllowedProtocols are used when neither the org policy nor the default one set protocols
+var defaultAllowedProtocols = []string{client.ProtocolTCP, client.ProtocolUDP}
+
+// create a security group owned by an org, cloud controller is called with the server credentials
+// once the org manager and the rules have been checked
+func handleCreateOrgSecGroup(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if !checkPrivateSecGroupsEnabled(w, req) {
+		return
+	}
+	var params model.OrgSecurityGroupParams
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	if params.OrganizationGUID == "" {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("organization_guid is required"))
+		return
+	}
+	if params.Name == "" {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("name is required"))
+		return
+	}
+	userId, err := getUserId(req)
+	if err != nil && !context.Get(req, ContextIsAdmin).(bool) {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	hasAccess, err := canManageOrg(req, params.OrganizationGUID)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if !hasAccess {
+		serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+		return
+	}
+	rules, err := orgSecGroupRules(params)
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	if len(rules) == 0 {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("rules or template is required"))
+		return
+	}
+	violations := checkOrgSecGroupRules(rules, orgSecGroupPolicy(params.OrganizationGUID))
+	if len(violations) > 0 {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("rules are not allowed in organization %s: %s", params.OrganizationGUID, strings.Join(violations, "; ")))
+		return
+	}
+	name, err := orgSecGroupName(req.Context(), params.OrganizationGUID, params.Name)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+
+	secGroup, err := cfclient.CreateSecurityGroupContext(req.Context(), client.SecurityGroupParams{Name: name, Rules: &rules})
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	orgSecGroup := model.OrgSecurityGroup{
+		SecurityGroupGUID: secGroup.GUID,
+		OrganizationGUID:  params.OrganizationGUID,
+		Name:              secGroup.Name,
+		Template:          params.Template,
+		CreatedBy:         userId,
+	}
+	err = gormDb.Create(&orgSecGroup).Error
+	if err != nil {
+		// an unrecorded security group would be an admin one, it is removed rather than left unowned
+		if errDelete := cfclient.DeleteSecurityGroupContext(req.Context(), secGroup.GUID); errDelete != nil {
+			requestLog(req).Errorf("error when deleting unrecorded security group %s: %s", secGroup.GUID, errDelete.Error())
+		}
+		serverError(w, req, err)
+		return
+	}
+	requestLog(req).WithFields(log.Fields{
+		"security_group_guid": orgSecGroup.SecurityGroupGUID,
+		"organization_guid":   orgSecGroup.OrganizationGUID,
+		"user_id":             userId,
+	}).Infof("org security group %s created", orgSecGroup.Name)
+	orgSecGroup.Rules = secGroup.Rules
+	b, _ := json.MarshalIndent(orgSecGroup, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(b)
+}
+
+// update or delete a security group owned by an org, security groups not owned by an org are refused
+func handleChangeOrgSecGroup(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	if !checkPrivateSecGroupsEnabled(w, req) {
+		return
+	}
+	secGroupGuid := strings.Split(req.URL.Path, "/")[3]
+	var orgSecGroup model.OrgSecurityGroup
+	err := gormDb.Where("security_group_guid = ?", secGroupGuid).First(&orgSecGroup).Error
+	if gorm.IsRecordNotFoundError(err) {
+		serverErrorCode(w, req, http.StatusForbidden, fmt.Errorf("security group %s is not owned by an organization", secGroupGuid))
+		return
+	}
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	hasAccess, err := canManageOrg(req, orgSecGroup.OrganizationGUID)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if !hasAccess {
+		serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+		return
+	}
+	userId, _ := getUserId(req)
+	entry := requestLog(req).WithFields(log.Fields{
+		"security_group_guid": orgSecGroup.SecurityGroupGUID,
+		"organization_guid":   orgSecGroup.OrganizationGUID,
+		"user_id":             userId,
+	})
+
+	if req.Method == http.MethodDelete {
+		err = cfclient.DeleteSecurityGroupContext(req.Context(), secGroupGuid)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		err = gormDb.Delete(&orgSecGroup).Error
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		entry.Infof("org security group %s deleted", orgSecGroup.Name)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var params model.OrgSecurityGroupParams
+	err = json.NewDecoder(req.Body).Decode(&params)
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	if params.OrganizationGUID != "" && params.OrganizationGUID != orgSecGroup.OrganizationGUID {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("organization of a security group can't be changed"))
+		return
+	}
+	rules, err := orgSecGroupRules(params)
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	violations := checkOrgSecGroupRules(rules, orgSecGroupPolicy(orgSecGroup.OrganizationGUID))
+	if len(violations) > 0 {
+		serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("rules are not allowed in organization %s: %s", orgSecGroup.OrganizationGUID, strings.Join(violations, "; ")))
+		return
+	}
+	if len(rules) > 0 && len(forbiddenDestinations) > 0 {
+		secGroup, err := getSecGroup(req.Context(), secGroupGuid)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		offending, err := checkSecGroupChange(req.Context(), secGroup, rules, false)
+		if !checkOffendingRules(w, req, orgSecGroup.Name, offending, err) {
+			return
+		}
+	}
+	var name string
+	if params.Name != "" {
+		name, err = orgSecGroupName(req.Context(), orgSecGroup.OrganizationGUID, params.Name)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+	}
+
+	update := client.SecurityGroupParams{Name: name}
+	if rules != nil {
+		update.Rules = &rules
+	}
+	secGroup, err := cfclient.UpdateSecurityGroupContext(req.Context(), secGroupGuid, update)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	orgSecGroup.Name = secGroup.Name
+	if params.Template != "" {
+		orgSecGroup.Template = params.Template
+	} else if params.Rules != nil {
+		orgSecGroup.Template = ""
+	}
+	err = gormDb.Save(&orgSecGroup).Error
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	entry.Infof("org security group %s updated", orgSecGroup.Name)
+	orgSecGroup.Rules = secGroup.Rules
+	b, _ := json.MarshalIndent(orgSecGroup, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// list security groups owned by orgs, org managers must give an organization_guid they manage
+func handleListOrgSecGroups(w http.ResponseWriter, req *http.Request) {
+	if !checkPrivateSecGroupsEnabled(w, req) {
+		return
+	}
+	var orgSecGroups []model.OrgSecurityGroup
+	listOrgRecords(w, req, &orgSecGroups)
+}
+
+// give rules allowed in private security groups of an org
+func handleOrgSecGroupPolicy(w http.ResponseWriter, req *http.Request) {
+	if !checkPrivateSecGroupsEnabled(w, req) {
+		return
+	}
+	orgGuid := req.URL.Query().Get("organization_guid")
+	if orgGuid == "" {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("organization_guid is required"))
+		return
+	}
+	hasAccess, err := canManageOrg(req, orgGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if !hasAccess {
+		serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+		return
+	}
+	policy := orgSecGroupPolicy(orgGuid)
+	policy.OrganizationGUID = orgGuid
+	b, _ := json.MarshalIndent(policy, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// list templates which can be used to create private security groups
+func handleListSecGroupTemplates(w http.ResponseWriter, req *http.Request) {
+	templates := privateSecGroups.Templates
+	if templates == nil {
+		templates = make([]model.SecGroupTemplate, 0)
+	}
+	b, _ := json.MarshalIndent(templates, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+func checkPrivateSecGroupsEnabled(w http.ResponseWriter, req *http.Request) bool {
+	if !privateSecGroups.Enabled {
+		serverErrorCode(w, req, http.StatusNotImplemented, fmt.Errorf("private security groups are disabled"))
+		return false
+	}
+	if gormDb == nil {
+		serverErrorCode(w, req, http.StatusNotImplemented, fmt.Errorf("private security groups require a database"))
+		return false
+	}
+	return true
+}
+
+// isBindableInOrg check that a security group is not owned by another org than the one of the space to bind
+func isBindableInOrg(secGroupGuid, orgGuid string) (bool, error) {
+	if gormDb == nil {
+		return true, nil
+	}
+	var orgSecGroup model.OrgSecurityGroup
+	err := gormDb.Where("security_group_guid = ?", secGroupGuid).First(&orgSecGroup).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return orgSecGroup.OrganizationGUID == orgGuid, nil
+}
+
+// orgSecGroupPolicy give the policy of an org, lists it doesn't set are taken from the default policy
+func orgSecGroupPolicy(orgGuid string) model.PrivateSecGroupPolicy {
+	policy := privateSecGroups.Default
+	for _, orgPolicy := range privateSecGroups.Orgs {
+		if orgPolicy.OrganizationGUID != orgGuid {
+			continue
+		}
+		if len(orgPolicy.AllowedDestinations) > 0 {
+			policy.AllowedDestinations = orgPolicy.AllowedDestinations
+		}
+		if len(orgPolicy.AllowedPorts) > 0 {
+			policy.AllowedPorts = orgPolicy.AllowedPorts
+		}
+		if len(orgPolicy.AllowedProtocols) > 0 {
+			policy.AllowedProtocols = orgPolicy.AllowedProtocols
+		}
+	}
+	if len(policy.AllowedProtocols) == 0 {
+		policy.AllowedProtocols = defaultAllowedProtocols
+	}
+	policy.OrganizationGUID = ""
+	return policy
+}
+
+// checkOrgSecGroupRules give the reasons why rules are refused by the policy, one per faulty rule
+func checkOrgSecGroupRules(rules []client.Rule, policy model.PrivateSecGroupPolicy) []string {
+	allowedNets := make([]*net.IPNet, 0, len(policy.AllowedDestinations))
+	for _, destination := range policy.AllowedDestinations {
+		ipNet, err := client.ParseDestination(strings.TrimSpace(destination))
+		if err != nil {
+			log.Warnf("ignoring allowed destination of private security groups: %s", err.Error())
+			continue
+		}
+		allowedNets = append(allowedNets, ipNet)
+	}
+	allowedPorts := strings.Join(policy.AllowedPorts, ",")
+
+	violations := make([]string, 0)
+	for i, rule := range rules {
+		reason := ""
+		if err := rule.Validate(); err != nil {
+			reason = err.Error()
+		} else if !slices.ContainsFunc(policy.AllowedProtocols, func(p string) bool { return strings.EqualFold(p, rule.Protocol) }) {
+			reason = fmt.Sprintf("protocol %s is not allowed", rule.Protocol)
+		} else if !rule.WithinNets(allowedNets) {
+			reason = fmt.Sprintf("destination %s is not within allowed destinations", rule.Destination)
+		} else if !rule.WithinPorts(allowedPorts) {
+			ports := rule.Ports
+			if ports == "" {
+				ports = "all"
+			}
+			reason = fmt.Sprintf("ports %s are not within allowed ports", ports)
+		}
+		if reason != "" {
+			violations = append(violations, fmt.Sprintf("rule %d: %s", i+1, reason))
+		}
+	}
+	return violations
+}
+
+// orgSecGroupRules give rules of the params, rendered from the template when one is given, nil when neither is given
+func orgSecGroupRules(params model.OrgSecurityGroupParams) ([]client.Rule, error) {
+	if params.Template == "" {
+		if len(params.Params) > 0 {
+			return nil, fmt.Errorf("params can only be given with a template")
+		}
+		if params.Rules == nil {
+			return nil, nil
+		}
+		// not nil even when empty, rules are removed on update
+		return append(make([]client.Rule, 0, len(*params.Rules)), *params.Rules...), nil
+	}
+	if params.Rules != nil {
+		return nil, fmt.Errorf("rules and template can't be given together")
+	}
+	idx := slices.IndexFunc(privateSecGroups.Templates, func(t model.SecGroupTemplate) bool {
+		return t.Name == params.Template
+	})
+	if idx < 0 {
+		return nil, fmt.Errorf("unknown template '%s'", params.Template)
+	}
+	template := privateSecGroups.Templates[idx]
+	for name := range params.Params {
+		if !slices.Contains(template.Params, name) {
+			return nil, fmt.Errorf("unknown param '%s' for template '%s'", name, template.Name)
+		}
+	}
+	oldNew := make([]string, 0, 2*len(template.Params))
+	for _, name := range template.Params {
+		value, ok := params.Params[name]
+		if !ok || value == "" {
+			return nil, fmt.Errorf("missing param '%s' for template '%s'", name, template.Name)
+		}
+		oldNew = append(oldNew, "{{"+name+"}}", value)
+	}
+	replacer := strings.NewReplacer(oldNew...)
+	rules := make([]client.Rule, 0, len(template.Rules))
+	for _, templateRule := range template.Rules {
+		rules = append(rules, client.Rule{
+			Protocol:    replacer.Replace(templateRule.Protocol),
+			Destination: replacer.Replace(templateRule.Destination),
+			Ports:       replacer.Replace(templateRule.Ports),
+		})
+	}
+	return rules, nil
+}
+
+// orgSecGroupName add the name prefix of the org when the name doesn't already start with it
+func orgSecGroupName(ctx stdcontext.Context, orgGuid, name string) (string, error) {
+	prefix := privateSecGroups.NamePrefix
+	if strings.Contains(prefix, "{{org}}") {
+		org, err := cfclient.GetOrganizationContext(ctx, orgGuid)
+		if err != nil {
+			return "", err
+		}
+		prefix = strings.ReplaceAll(prefix, "{{org}}", org.Name)
+	}
+	if strings.HasPrefix(name, prefix) {
+		return name, nil
+	}
+	return prefix + name, nil
+}
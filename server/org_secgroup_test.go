@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+// setPrivateSecGroups set the private security groups config for the test only
+func setPrivateSecGroups(t *testing.T, config model.PrivateSecGroupsConfig) {
+	t.Helper()
+	previous := privateSecGroups
+	t.Cleanup(func() { privateSecGroups = previous })
+	config.Enabled = true
+	privateSecGroups = config
+}
+
+func TestCheckOrgSecGroupRules(t *testing.T) {
+	setPrivateSecGroups(t, model.PrivateSecGroupsConfig{
+		Default: model.PrivateSecGroupPolicy{
+			AllowedDestinations: []string{"10.0.0.0/8", "192.168.1.10"},
+			AllowedPorts:        []string{"443", "8000-8100"},
+		},
+		Orgs: []model.PrivateSecGroupPolicy{
+			{OrganizationGUID: "org-ping", AllowedProtocols: []string{client.ProtocolICMP}},
+			{OrganizationGUID: "org-closed", AllowedDestinations: []string{"172.16.0.0/12"}, AllowedPorts: []string{"22"}},
+		},
+	})
+	echo, anyCode := 8, -1
+
+	tests := []struct {
+		name      string
+		org       string
+		rule      client.Rule
+		violation string
+	}{
+		{name: "within policy", rule: client.Rule{Protocol: "tcp", Destination: "10.1.2.3", Ports: "443"}},
+		{name: "allowed ip with port range", rule: client.Rule{Protocol: "udp", Destination: "192.168.1.10", Ports: "8000-8050"}},
+		{name: "range within", rule: client.Rule{Protocol: "tcp", Destination: "10.0.0.1-10.0.0.9", Ports: "443"}},
+		{name: "destination outside", rule: client.Rule{Protocol: "tcp", Destination: "11.0.0.1", Ports: "443"}, violation: "not within allowed destinations"},
+		{name: "comma list with one outside", rule: client.Rule{Protocol: "tcp", Destination: "10.0.0.1,0.0.0.0/0", Ports: "443"}, violation: "not within allowed destinations"},
+		{name: "range crossing", rule: client.Rule{Protocol: "tcp", Destination: "10.255.255.250-11.0.0.1", Ports: "443"}, violation: "not within allowed destinations"},
+		{name: "cidr wider", rule: client.Rule{Protocol: "tcp", Destination: "10.0.0.0/7", Ports: "443"}, violation: "not within allowed destinations"},
+		{name: "port outside", rule: client.Rule{Protocol: "tcp", Destination: "10.1.2.3", Ports: "22"}, violation: "ports 22 are not within allowed ports"},
+		{name: "port range crossing", rule: client.Rule{Protocol: "tcp", Destination: "10.1.2.3", Ports: "8050-8200"}, violation: "not within allowed ports"},
+		{name: "any port", rule: client.Rule{Protocol: "tcp", Destination: "10.1.2.3"}, violation: "ports all are not within allowed ports"},
+		{name: "protocol not allowed", rule: client.Rule{Protocol: "all", Destination: "10.1.2.3"}, violation: "protocol all is not allowed"},
+		{name: "icmp not allowed by default", rule: client.Rule{Protocol: "icmp", Destination: "10.1.2.3", Type: &echo, Code: &anyCode}, violation: "protocol icmp is not allowed"},
+		{name: "icmp allowed in org", org: "org-ping", rule: client.Rule{Protocol: "icmp", Destination: "10.1.2.3", Type: &echo, Code: &anyCode}},
+		{name: "tcp not allowed in org", org: "org-ping", rule: client.Rule{Protocol: "tcp", Destination: "10.1.2.3", Ports: "443"}, violation: "protocol tcp is not allowed"},
+		{name: "org destinations replace default", org: "org-closed", rule: client.Rule{Protocol: "tcp", Destination: "10.1.2.3", Ports: "22"}, violation: "not within allowed destinations"},
+		{name: "org ports replace default", org: "org-closed", rule: client.Rule{Protocol: "tcp", Destination: "172.16.0.1", Ports: "443"}, violation: "not within allowed ports"},
+		{name: "invalid syntax", rule: client.Rule{Protocol: "tcp", Destination: "10.1.2.300", Ports: "443"}, violation: "invalid destination"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := checkOrgSecGroupRules([]client.Rule{tt.rule}, orgSecGroupPolicy(tt.org))
+			if tt.violation == "" {
+				if len(violations) != 0 {
+					t.Errorf("violations = %v, want none", violations)
+				}
+				return
+			}
+			if len(violations) != 1 || !strings.HasPrefix(violations[0], "rule 1: ") || !strings.Contains(violations[0], tt.violation) {
+				t.Errorf("violations = %v, want %q", violations, tt.violation)
+			}
+		})
+	}
+}
+
+func TestCheckOrgSecGroupRulesEmptyPolicy(t *testing.T) {
+	setPrivateSecGroups(t, model.PrivateSecGroupsConfig{})
+	rules := []client.Rule{
+		{Protocol: "tcp", Destination: "10.1.2.3", Ports: "443"},
+		{Protocol: "udp", Destination: "0.0.0.0/0"},
+	}
+	violations := checkOrgSecGroupRules(rules, orgSecGroupPolicy("org-1"))
+	if len(violations) != len(rules) {
+		t.Errorf("violations = %v, want every rule refused without allowed destinations", violations)
+	}
+}
+
+func TestOrgSecGroupTemplateRules(t *testing.T) {
+	setPrivateSecGroups(t, model.PrivateSecGroupsConfig{
+		Default: model.PrivateSecGroupPolicy{
+			AllowedDestinations: []string{"10.0.0.0/8"},
+			AllowedPorts:        []string{"5432", "3306"},
+		},
+		Templates: []model.SecGroupTemplate{{
+			Name:   "database",
+			Params: []string{"host", "port"},
+			Rules:  []model.SecGroupTemplateRule{{Protocol: "tcp", Destination: "{{host}}", Ports: "{{port}}"}},
+		}},
+	})
+
+	tests := []struct {
+		name      string
+		params    map[string]string
+		violation string
+	}{
+		{name: "values within policy", params: map[string]string{"host": "10.1.2.3", "port": "5432"}},
+		{name: "values as lists within policy", params: map[string]string{"host": "10.1.2.3,10.1.2.4", "port": "5432,3306"}},
+		{name: "host adding a destination", params: map[string]string{"host": "10.1.2.3,0.0.0.0/0", "port": "5432"}, violation: "not within allowed destinations"},
+		{name: "host as a wide range", params: map[string]string{"host": "10.0.0.1-11.0.0.1", "port": "5432"}, violation: "not within allowed destinations"},
+		{name: "port adding a port", params: map[string]string{"host": "10.1.2.3", "port": "5432,22"}, violation: "not within allowed ports"},
+		{name: "port as a wide range", params: map[string]string{"host": "10.1.2.3", "port": "1-65535"}, violation: "not within allowed ports"},
+		{name: "value breaking syntax", params: map[string]string{"host": "10.1.2.3", "port": "5432-"}, violation: "invalid ports"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := orgSecGroupRules(model.OrgSecurityGroupParams{Template: "database", Params: tt.params})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rules) != 1 || rules[0].Destination != tt.params["host"] || rules[0].Ports != tt.params["port"] {
+				t.Fatalf("rules = %+v, want the template rendered with %v", rules, tt.params)
+			}
+			violations := checkOrgSecGroupRules(rules, orgSecGroupPolicy("org-1"))
+			if tt.violation == "" {
+				if len(violations) != 0 {
+					t.Errorf("violations = %v, want none", violations)
+				}
+				return
+			}
+			if len(violations) != 1 || !strings.Contains(violations[0], tt.violation) {
+				t.Errorf("violations = %v, want %q", violations, tt.violation)
+			}
+		})
+	}
+}
+
+func TestOrgSecGroupRulesParams(t *testing.T) {
+	setPrivateSecGroups(t, model.PrivateSecGroupsConfig{
+		Templates: []model.SecGroupTemplate{{
+			Name:   "database",
+			Params: []string{"host"},
+			Rules:  []model.SecGroupTemplateRule{{Protocol: "tcp", Destination: "{{host}}", Ports: "5432"}},
+		}},
+	})
+	rules := []client.Rule{{Protocol: "tcp", Destination: "10.1.2.3", Ports: "443"}}
+
+	tests := []struct {
+		name    string
+		params  model.OrgSecurityGroupParams
+		wantErr string
+		want    int
+	}{
+		{name: "rules", params: model.OrgSecurityGroupParams{Rules: &rules}, want: 1},
+		{name: "template", params: model.OrgSecurityGroupParams{Template: "database", Params: map[string]string{"host": "10.1.2.3"}}, want: 1},
+		{name: "unknown template", params: model.OrgSecurityGroupParams{Template: "cache"}, wantErr: "unknown template"},
+		{name: "missing param", params: model.OrgSecurityGroupParams{Template: "database"}, wantErr: "missing param 'host'"},
+		{name: "empty param", params: model.OrgSecurityGroupParams{Template: "database", Params: map[string]string{"host": ""}}, wantErr: "missing param 'host'"},
+		{name: "unknown param", params: model.OrgSecurityGroupParams{Template: "database", Params: map[string]string{"host": "10.1.2.3", "port": "22"}}, wantErr: "unknown param 'port'"},
+		{name: "params without template", params: model.OrgSecurityGroupParams{Params: map[string]string{"host": "10.1.2.3"}}, wantErr: "only be given with a template"},
+		{name: "template and rules", params: model.OrgSecurityGroupParams{Template: "database", Params: map[string]string{"host": "10.1.2.3"}, Rules: &rules}, wantErr: "template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orgSecGroupRules(tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("rules = %+v, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -17,14 +19,48 @@ var (
 		prometheus.CounterOpts{
 			Namespace: "cfsecurity",
 			Name:      "http_total",
-			Help:      "Number of requests",
+			Help:      "Number of requests by route",
 		},
 		[]string{"endpoint", "method", "status"},
 	)
+	gHttpDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cfsecurity",
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of requests by route",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"endpoint", "method"},
+	)
+	gCCDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "cfsecurity",
+			Name:      "cc_request_duration_seconds",
+			Help:      "Duration of calls to cloud controller by operation, retries included",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+	gCCErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cfsecurity",
+			Name:      "cc_errors_total",
+			Help:      "Number of calls to cloud controller failing by operation, status is 0 for network errors",
+		},
+		[]string{"operation", "status"},
+	)
+	gBindingTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cfsecurity",
+			Name:      "binding_total",
+			Help:      "Number of security group bindings and unbindings of space lifecycles by outcome, success, refused or error",
+		},
+		[]string{"action", "lifecycle", "outcome"},
+	)
 )
 
 func init() {
-	prometheus.MustRegister(gHttpTotal)
+	prometheus.MustRegister(gHttpTotal, gHttpDuration, gCCDuration, gCCErrorsTotal, gBindingTotal)
 }
 
 func NewMetricResponseWriter(w http.ResponseWriter) *metricResponseWriter {
@@ -36,14 +72,42 @@ func (mrw *metricResponseWriter) WriteHeader(code int) {
 	mrw.ResponseWriter.WriteHeader(code)
 }
 
+// metricHandler count requests and measure their duration, requests are labeled with their route template
+// to not get a label per guid
 func metricHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
 		w := NewMetricResponseWriter(res)
 		next.ServeHTTP(w, req)
+		endpoint := routeTemplate(req)
+		gHttpDuration.WithLabelValues(endpoint, req.Method).Observe(time.Since(start).Seconds())
 		gHttpTotal.With(prometheus.Labels{
-			"endpoint": req.URL.Path,
+			"endpoint": endpoint,
 			"method":   req.Method,
 			"status":   fmt.Sprintf("%d", w.statusCode),
 		}).Inc()
 	})
 }
+
+// observeCall measure a call made to cloud controller, calls failing or answered with an error status are counted as errors
+func observeCall(event client.CallEvent) {
+	gCCDuration.WithLabelValues(event.Operation).Observe(event.Duration.Seconds())
+	if event.Err != nil || event.StatusCode >= http.StatusBadRequest {
+		gCCErrorsTotal.WithLabelValues(event.Operation, fmt.Sprintf("%d", event.StatusCode)).Inc()
+	}
+}
+
+// countBindings count bindings or unbindings of spaces on lifecycles by outcome, success, refused or error
+func countBindings(action, outcome string, spaces int, lifecycles ...string) {
+	for _, lifecycle := range lifecycles {
+		gBindingTotal.WithLabelValues(action, lifecycle, outcome).Add(float64(spaces))
+	}
+}
+
+// bindingOutcome give the outcome of a binding change made on cloud controller
+func bindingOutcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+// quotaSpacesChunk is the max number of space guids given in one filter when looking for bound security groups
+const quotaSpacesChunk = 50
+
+var bindingQuotas model.BindingQuotasConfig
+
+// report usage of binding quotas by the spaces of an org
+func handleBindingQuotaUsage(w http.ResponseWriter, req *http.Request) {
+	orgGuid := req.URL.Query().Get("organization_guid")
+	if orgGuid == "" {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("organization_guid is required"))
+		return
+	}
+	hasAccess, err := canManageOrg(req, orgGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if !hasAccess {
+		serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+		return
+	}
+	spaces, err := cfclient.GetSpacesWithOrgContext(req.Context(), []ccv3.Query{{Key: ccv3.OrganizationGUIDFilter, Values: []string{orgGuid}}}, 0)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	bound, err := spacesBoundSecGroups(req.Context(), spaces.Resources...)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	usage := model.QuotaUsage{
+		OrganizationGUID: orgGuid,
+		Quota:            bindingQuota(orgGuid),
+		Spaces:           make([]model.SpaceQuotaUsage, 0, len(spaces.Resources)),
+	}
+	for _, space := range spaces.Resources {
+		usage.Spaces = append(usage.Spaces, model.SpaceQuotaUsage{
+			SpaceGUID:      space.GUID,
+			SpaceName:      space.Name,
+			SecurityGroups: len(bound[space.GUID]),
+			Rules:          distinctRules(bound[space.GUID]...),
+		})
+	}
+	slices.SortFunc(usage.Spaces, func(a, b model.SpaceQuotaUsage) int { return strings.Compare(a.SpaceName, b.SpaceName) })
+	b, _ := json.MarshalIndent(usage, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// bindingQuota give the quota of an org, the default quota with the limits set for the org
+func bindingQuota(orgGuid string) model.BindingQuota {
+	quota := bindingQuotas.Default
+	for _, orgQuota := range bindingQuotas.Orgs {
+		if orgQuota.OrganizationGUID != orgGuid {
+			continue
+		}
+		if orgQuota.MaxSecurityGroupsPerSpace != 0 {
+			quota.MaxSecurityGroupsPerSpace = orgQuota.MaxSecurityGroupsPerSpace
+		}
+		if orgQuota.MaxRulesPerSpace != 0 {
+			quota.MaxRulesPerSpace = orgQuota.MaxRulesPerSpace
+		}
+	}
+	quota.OrganizationGUID = ""
+	quota.MaxSecurityGroupsPerSpace = max(quota.MaxSecurityGroupsPerSpace, 0)
+	quota.MaxRulesPerSpace = max(quota.MaxRulesPerSpace, 0)
+	return quota
+}
+
+// checkBindingQuotas describe the spaces of an org exceeding their quota once the security group is bound to them,
+// a security group already bound to a space on a lifecycle is not counted again
+func checkBindingQuotas(ctx stdcontext.Context, secGroupGuid, orgGuid string, spaces ...client.Space) ([]string, error) {
+	quota := bindingQuota(orgGuid)
+	if quota.MaxSecurityGroupsPerSpace == 0 && quota.MaxRulesPerSpace == 0 {
+		return nil, nil
+	}
+	bound, err := spacesBoundSecGroups(ctx, spaces...)
+	if err != nil {
+		return nil, err
+	}
+	var secGroup *client.SecurityGroup
+	exceeded := make([]string, 0)
+	for _, space := range spaces {
+		secGroups := bound[space.GUID]
+		if slices.ContainsFunc(secGroups, func(sg client.SecurityGroup) bool { return sg.GUID == secGroupGuid }) {
+			continue
+		}
+		if quota.MaxSecurityGroupsPerSpace > 0 && len(secGroups) >= quota.MaxSecurityGroupsPerSpace {
+			exceeded = append(exceeded, fmt.Sprintf("space %s: %d security groups bound, limit is %d",
+				space.Name, len(secGroups), quota.MaxSecurityGroupsPerSpace))
+		}
+		if quota.MaxRulesPerSpace == 0 {
+			continue
+		}
+		if secGroup == nil {
+			sg, err := getSecGroup(ctx, secGroupGuid)
+			if err != nil {
+				return nil, err
+			}
+			secGroup = &sg
+		}
+		rules := distinctRules(secGroups...)
+		withSecGroup := distinctRules(append(slices.Clone(secGroups), *secGroup)...)
+		if withSecGroup > quota.MaxRulesPerSpace {
+			exceeded = append(exceeded, fmt.Sprintf("space %s: %d distinct rules, %d with security group %s, limit is %d",
+				space.Name, rules, withSecGroup, secGroup.Name, quota.MaxRulesPerSpace))
+		}
+	}
+	return exceeded, nil
+}
+
+// spacesBoundSecGroups give the security groups bound to each space on running or staging lifecycle,
+// globally enabled security groups are not counted
+func spacesBoundSecGroups(ctx stdcontext.Context, spaces ...client.Space) (map[string][]client.SecurityGroup, error) {
+	bound := make(map[string][]client.SecurityGroup, len(spaces))
+	guids := make([]string, 0, len(spaces))
+	for _, space := range spaces {
+		bound[space.GUID] = make([]client.SecurityGroup, 0)
+		guids = append(guids, space.GUID)
+	}
+	seen := make(map[string]bool)
+	for chunk := range slices.Chunk(guids, quotaSpacesChunk) {
+		for _, filter := range []ccv3.QueryKey{client.RunningSpaceGUIDsFilter, client.StagingSpaceGUIDsFilter} {
+			secGroups, err := cfclient.GetSecGroupsContext(ctx, []ccv3.Query{{Key: filter, Values: chunk}}, 0)
+			if err != nil {
+				return nil, err
+			}
+			for _, secGroup := range secGroups.Resources {
+				data := slices.Concat(secGroup.Relationships.Running_Spaces.Data, secGroup.Relationships.Staging_Spaces.Data)
+				for _, d := range data {
+					key := d.GUID + "|" + secGroup.GUID
+					if _, ok := bound[d.GUID]; !ok || seen[key] {
+						continue
+					}
+					seen[key] = true
+					bound[d.GUID] = append(bound[d.GUID], secGroup)
+				}
+			}
+		}
+	}
+	return bound, nil
+}
+
+// distinctRules count the rules given by security groups, identical rules are counted once
+func distinctRules(secGroups ...client.SecurityGroup) int {
+	rules := make(map[string]bool)
+	for _, secGroup := range secGroups {
+		for _, rule := range secGroup.Rules {
+			rules[strings.Join([]string{rule.Protocol, rule.Destination, rule.Ports}, "|")] = true
+		}
+	}
+	return len(rules)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// maxRateBuckets is the max number of buckets kept, full ones are dropped first as a full bucket is the same as a new one,
+// then the least recently used one
+const maxRateBuckets = 10000
+
+var rateLimiter = NewRateLimiter()
+
+type rateBucketKey struct {
+	principal string
+	write     bool
+}
+
+type rateBucket struct {
+	*rate.Limiter
+	lastUsed time.Time
+}
+
+// RateLimiter give each principal a token bucket for reads and one for writes, limits can be changed while serving
+type RateLimiter struct {
+	mu      sync.Mutex
+	config  model.RateLimitConfig
+	buckets map[rateBucketKey]*rateBucket
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[rateBucketKey]*rateBucket)}
+}
+
+// Load set the limits, buckets keep their tokens and get the new limits on their next request
+func (rl *RateLimiter) Load(config model.RateLimitConfig) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.config = config
+}
+
+// Reserve take a token from the bucket of a principal, the delay before a token is available is given when there is none
+func (rl *RateLimiter) Reserve(principal string, isAdmin, write bool) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	limits := rl.config.User
+	if isAdmin {
+		limits = rl.config.Admin
+	}
+	perSecond, burst := limits.ReadsPerSecond, limits.ReadBurst
+	if write {
+		perSecond, burst = limits.WritesPerSecond, limits.WriteBurst
+	}
+	if perSecond <= 0 {
+		return 0, true
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(perSecond))
+	}
+
+	now := time.Now()
+	key := rateBucketKey{principal: principal, write: write}
+	limiter, ok := rl.buckets[key]
+	if !ok {
+		if len(rl.buckets) >= maxRateBuckets {
+			rl.dropFullBuckets(now)
+		}
+		if len(rl.buckets) >= maxRateBuckets {
+			rl.dropLeastRecentlyUsed()
+		}
+		limiter = &rateBucket{Limiter: rate.NewLimiter(rate.Limit(perSecond), burst)}
+		rl.buckets[key] = limiter
+	}
+	limiter.lastUsed = now
+	if limiter.Limit() != rate.Limit(perSecond) {
+		limiter.SetLimitAt(now, rate.Limit(perSecond))
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurstAt(now, burst)
+	}
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return 0, true
+	}
+	reservation.CancelAt(now)
+	return delay, false
+}
+
+func (rl *RateLimiter) dropFullBuckets(now time.Time) {
+	for key, limiter := range rl.buckets {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// dropLeastRecentlyUsed drop the bucket whose last request is the oldest, its principal gets a new bucket on its next request
+func (rl *RateLimiter) dropLeastRecentlyUsed() {
+	var oldestKey rateBucketKey
+	var oldest *rateBucket
+	for key, limiter := range rl.buckets {
+		if oldest == nil || limiter.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = key, limiter
+		}
+	}
+	delete(rl.buckets, oldestKey)
+}
+
+// rateLimitHandler refuse requests of a principal with 429 when its bucket is empty,
+// Retry-After tells in how many seconds a request will be accepted
+func rateLimitHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		principal, _ := context.Get(req, ContextPrincipal).(string)
+		if principal == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		isAdmin, _ := context.Get(req, ContextIsAdmin).(bool)
+		write := req.Method != http.MethodGet && req.Method != http.MethodHead
+		delay, ok := rateLimiter.Reserve(principal, isAdmin, write)
+		if ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+		kind := "read"
+		if write {
+			kind = "write"
+		}
+		gRateLimitedTotal.WithLabelValues(kind).Inc()
+		retryAfter := int(math.Ceil(delay.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		serverErrorCode(w, req, http.StatusTooManyRequests, fmt.Errorf("too many %s requests from %s, retry after %d seconds", kind, principal, retryAfter))
+	})
+}
+
+var gRateLimitedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "cfsecurity",
+		Name:      "rate_limited_total",
+		Help:      "Number of requests refused because their user or client exceeded its rate limit",
+	},
+	[]string{"kind"},
+)
+
+func init() {
+	prometheus.MustRegister(gRateLimitedTotal)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiterBucketsAreCapped(t *testing.T) {
+	rl := NewRateLimiter()
+	rl.Load(model.RateLimitConfig{User: model.RateLimits{ReadsPerSecond: 0.001, ReadBurst: 1}})
+
+	// every principal empties its bucket, none can be dropped as full
+	for i := 0; i < maxRateBuckets+10; i++ {
+		if _, ok := rl.Reserve(fmt.Sprintf("user-%d", i), false, false); !ok {
+			t.Fatalf("first request of user-%d refused", i)
+		}
+	}
+	if len(rl.buckets) > maxRateBuckets {
+		t.Errorf("%d buckets kept, want at most %d", len(rl.buckets), maxRateBuckets)
+	}
+	if _, ok := rl.Reserve(fmt.Sprintf("user-%d", maxRateBuckets+9), false, false); ok {
+		t.Error("the bucket of the last principal must be kept")
+	}
+	if _, ok := rl.Reserve("user-0", false, false); !ok {
+		t.Error("the least recently used bucket must have been dropped")
+	}
+	if len(rl.buckets) > maxRateBuckets {
+		t.Errorf("%d buckets kept, want at most %d", len(rl.buckets), maxRateBuckets)
+	}
+}
+
+func TestRateLimiterDropsFullBucketsFirst(t *testing.T) {
+	rl := NewRateLimiter()
+	rl.Load(model.RateLimitConfig{User: model.RateLimits{ReadsPerSecond: 0.001, ReadBurst: 2}})
+
+	// the least recently used bucket keeps a token, it is not full
+	rl.Reserve("oldest", false, false)
+	for i := 0; i < maxRateBuckets-2; i++ {
+		principal := fmt.Sprintf("user-%d", i)
+		rl.Reserve(principal, false, false)
+		rl.Reserve(principal, false, false)
+	}
+	rl.buckets[rateBucketKey{principal: "idle"}] = &rateBucket{Limiter: rate.NewLimiter(0.001, 2), lastUsed: time.Now()}
+
+	rl.Reserve("new", false, false)
+	if _, ok := rl.buckets[rateBucketKey{principal: "idle"}]; ok {
+		t.Error("the full bucket must be dropped")
+	}
+	if _, ok := rl.buckets[rateBucketKey{principal: "oldest"}]; !ok {
+		t.Error("no bucket must be evicted when dropping full ones is enough")
+	}
+	if len(rl.buckets) != maxRateBuckets {
+		t.Errorf("%d buckets kept, want %d", len(rl.buckets), maxRateBuckets)
+	}
+}
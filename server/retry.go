@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// retryPolicy build the retry policy of calls to cloud controller, each retry is logged and counted
+func retryPolicy(c model.RetryConfig) client.RetryPolicy {
+	return client.RetryPolicy{
+		MaxAttempts:    c.MaxAttempts,
+		InitialBackoff: time.Duration(c.InitialBackoffMs) * time.Millisecond,
+		MaxBackoff:     time.Duration(c.MaxBackoffMs) * time.Millisecond,
+		MaxElapsed:     time.Duration(c.MaxElapsedMs) * time.Millisecond,
+		OnRetry: func(event client.RetryEvent) {
+			entry := log.WithFields(log.Fields{
+				"method":  event.Method,
+				"url":     event.URL,
+				"attempt": event.Attempt,
+				"wait":    event.Wait.String(),
+			})
+			if event.Err != nil {
+				entry.Warnf("retrying call to cloud controller after error: %s", event.Err.Error())
+			} else {
+				entry.Warnf("retrying call to cloud controller after status %d", event.StatusCode)
+			}
+			gRetryTotal.WithLabelValues(event.Method, fmt.Sprintf("%d", event.StatusCode)).Inc()
+		},
+	}
+}
+
+var gRetryTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "cfsecurity",
+		Name:      "cc_retry_total",
+		Help:      "Number of calls to cloud controller retried, status is 0 for network errors",
+	},
+	[]string{"method", "status"},
+)
+
+func init() {
+	prometheus.MustRegister(gRetryTotal)
+}
@@ -1,26 +1,19 @@
 package main
 
 import (
+	stdcontext "context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"regexp"
 	"strings"
-	"time"
 
-	"github.com/cloudfoundry-community/gautocloud"
 	"github.com/gorilla/context"
-	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
 
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 )
 
-var bindReqRegex = regexp.MustCompile("^/v3/security_groups/[^/]*/relationships/(running|staging)_spaces")
-var checkReqRegex = regexp.MustCompile("^/v3/security_groups/[^/]*/relationships/spaces/([^/]*)/check")
-var findReqRegex = regexp.MustCompile("^/v3/security_groups(/[^/]*)?")
-
 type SecGroupConfig struct {
 	Binding *SecGroupOptions `mapstructure:"binding" json:"binding" yaml:"binding"`
 }
@@ -38,48 +31,6 @@ type body struct {
 	}
 }
 
-func secGoupsHandler(w http.ResponseWriter, req *http.Request) {
-	if expiresAt.Before(time.Now()) {
-		var config model.ConfigServer
-		err := gautocloud.Inject(&config)
-		if err != nil {
-			return
-		}
-		tr := shallowDefaultTransport(config.TrustedCaCertificates, config.CloudFoundry.SkipSSLValidation)
-
-		accessToken, refreshExpiresAt, err := AuthenticateWithExpire(config.CloudFoundry.UAAEndpoint, config.CloudFoundry.ClientID, config.CloudFoundry.ClientSecret, tr)
-		if err != nil {
-			// Fix errcheck: log the error instead of ignoring it
-			log.Error(errors.Wrap(err, "error when authenticate on cf"))
-			return
-		}
-		if accessToken == "" {
-			// Fix errcheck: log the error instead of ignoring it
-			log.Error("a pair of username/password or a pair of client_id/client_secret muste be set")
-			return
-		}
-
-		expiresAt = refreshExpiresAt
-		cfclient.SetAccessToken(accessToken)
-	}
-
-	path := req.URL.Path
-	if bindReqRegex.MatchString(path) && (req.Method == http.MethodPost || req.Method == http.MethodDelete) {
-		bindOrUnbindSecGroup(w, req)
-		return
-	}
-	if checkReqRegex.MatchString(path) && req.Method == http.MethodGet {
-		checkBind(w, req)
-		return
-	}
-	if findReqRegex.MatchString(path) && req.Method == http.MethodGet {
-		findSecGroup(w, req)
-		return
-	}
-
-	serverErrorCode(w, req, http.StatusNotImplemented, fmt.Errorf("fonction inconnue"))
-}
-
 func (SecGroupMiddleware) Schema() interface{} {
 	return SecGroupConfig{}
 }
@@ -91,9 +42,16 @@ func checkBind(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	pathSplit := strings.Split(req.URL.Path, "/")
+	secGroupGuid := pathSplit[3]
 	spaceGuid := pathSplit[6]
 
-	space, err := cfclient.GetSpaceByGuid(spaceGuid)
+	space, err := getSpaceByGuid(req.Context(), spaceGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	// private security groups of other orgs can't be bound
+	bindable, err := isBindableInOrg(secGroupGuid, space.Relationships["organization"].GUID)
 	if err != nil {
 		serverError(w, req, err)
 		return
@@ -104,7 +62,7 @@ func checkBind(w http.ResponseWriter, req *http.Request) {
 		IsEntitled       bool   `json:"is_entitled"`
 	}{
 		OrganizationGUID: space.Relationships["organization"].GUID,
-		IsEntitled:       true,
+		IsEntitled:       bindable,
 	}
 	b, _ := json.MarshalIndent(data, "", "  ")
 	w.Header().Add("Content-Type", "application/json")
@@ -150,14 +108,14 @@ func bindOrUnbindSecGroup(w http.ResponseWriter, req *http.Request) {
 		spaceGuid = pathSplit[6]
 	}
 
-	space, err := cfclient.GetSpaceByGuid(spaceGuid)
+	space, err := getSpaceByGuid(req.Context(), spaceGuid)
 	if err != nil {
 		serverError(w, req, err)
 		return
 	}
 
 	if !context.Get(req, ContextIsAdmin).(bool) {
-		hasAccess, err := isUserOrgManager(userId, space.Relationships["organization"].GUID)
+		hasAccess, err := isUserOrgManager(req.Context(), userId, space.Relationships["organization"].GUID)
 		if err != nil {
 			serverError(w, req, err)
 			return
@@ -168,15 +126,21 @@ func bindOrUnbindSecGroup(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 	if req.Method == http.MethodPost {
+		lifecycle := strings.TrimSuffix(pathSplit[5], "_spaces")
+		if _, ok := checkBindGuardrails(w, req, secGroupGuid, space.Relationships["organization"].GUID, []string{lifecycle}, space); !ok {
+			return
+		}
 		if pathSplit[5] == "running_spaces" {
-			err = cfclient.BindRunningSecGroupToSpace(secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			err = cfclient.BindRunningSecGroupToSpaceContext(req.Context(), secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			countBindings("bind", bindingOutcome(err), 1, client.LifecycleRunning)
 			if err != nil {
 				serverError(w, req, err)
 				return
 			}
 		}
 		if pathSplit[5] == "staging_spaces" {
-			err = cfclient.BindStagingSecGroupToSpace(secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			err = cfclient.BindStagingSecGroupToSpaceContext(req.Context(), secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			countBindings("bind", bindingOutcome(err), 1, client.LifecycleStaging)
 			if err != nil {
 				serverError(w, req, err)
 				return
@@ -184,9 +148,10 @@ func bindOrUnbindSecGroup(w http.ResponseWriter, req *http.Request) {
 		}
 	} else {
 		if pathSplit[5] == "running_spaces" {
-			err = cfclient.UnBindRunningSecGroupToSpace(secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			err = cfclient.UnBindRunningSecGroupToSpaceContext(req.Context(), secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			countBindings("unbind", bindingOutcome(err), 1, client.LifecycleRunning)
 			if err != nil {
-				if strings.Contains(err.Error(), "UnprocessableEntity") {
+				if errors.Is(err, client.ErrUnprocessable) {
 					serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("unable to unbind security group from space with guid '%s', ensure the space is bound to this security group", spaceGuid))
 					return
 				} else {
@@ -196,9 +161,10 @@ func bindOrUnbindSecGroup(w http.ResponseWriter, req *http.Request) {
 			}
 		}
 		if pathSplit[5] == "staging_spaces" {
-			err = cfclient.UnBindStagingSecGroupToSpace(secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			err = cfclient.UnBindStagingSecGroupToSpaceContext(req.Context(), secGroupGuid, spaceGuid, cfclient.GetApiUrl())
+			countBindings("unbind", bindingOutcome(err), 1, client.LifecycleStaging)
 			if err != nil {
-				if strings.Contains(err.Error(), "UnprocessableEntity") {
+				if errors.Is(err, client.ErrUnprocessable) {
 					serverErrorCode(w, req, http.StatusUnprocessableEntity, fmt.Errorf("unable to unbind security group from space with guid '%s', ensure the space is bound to this security group", spaceGuid))
 					return
 				} else {
@@ -208,11 +174,10 @@ func bindOrUnbindSecGroup(w http.ResponseWriter, req *http.Request) {
 			}
 		}
 	}
-
 }
 
 func findSecGroup(w http.ResponseWriter, req *http.Request) {
-	buffer, err := cfclient.ListAllSecGroups(req)
+	buffer, err := cfclient.ListAllSecGroupsContext(req.Context(), req)
 	if err != nil {
 		serverError(w, req, err)
 		return
@@ -249,17 +214,22 @@ func filterParam(req *http.Request, param string) []string {
 }
 */
 
-func isUserOrgManager(userId, orgId string) (bool, error) {
-	users, err := cfclient.GetOrgManagers(orgId, 0)
+func isUserOrgManager(ctx stdcontext.Context, userId, orgId string) (bool, error) {
+	managed, err := getManagedOrgs(ctx, userId, []string{orgId})
 	if err != nil {
 		return false, err
 	}
-	found := false
-	for _, user := range users.Resources {
-		if user.Relationships.User.Data.GUID == userId && user.Type == "organization_manager" {
-			found = true
-			break
-		}
+	return managed[orgId], nil
+}
+
+// canManageOrg check if the user behind the request is an admin or an org manager of the given org
+func canManageOrg(req *http.Request, orgGuid string) (bool, error) {
+	if context.Get(req, ContextIsAdmin).(bool) {
+		return true, nil
+	}
+	userId, err := getUserId(req)
+	if err != nil {
+		return false, err
 	}
-	return found, nil
+	return isUserOrgManager(req.Context(), userId, orgGuid)
 }
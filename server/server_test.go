@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client/clienttest"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+)
+
+var fixturePath = filepath.Join("..", "client", "clienttest", "testdata", "fixture.json")
+
+type testServer struct {
+	t      *testing.T
+	cc     *clienttest.Server
+	router http.Handler
+}
+
+// newTestServer start a fake cloud controller seeded with the fixture and a cfsecurity server using it, without database
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	cc, err := clienttest.NewServerFromFixture(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cc.Close)
+	router, err := setup(cc.ServerConfig("cfsecurity", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDb = nil
+	return &testServer{t: t, cc: cc, router: router}
+}
+
+// withDb give the server a sqlite database, the test is skipped when sqlite is not available
+func (ts *testServer) withDb() {
+	ts.t.Helper()
+	db, err := gorm.Open("sqlite3", filepath.Join(ts.t.TempDir(), "cfsecurity.db"))
+	if err != nil {
+		ts.t.Skipf("sqlite is not available: %s", err)
+	}
+	ts.t.Cleanup(func() {
+		gormDb = nil
+		_ = db.Close()
+	})
+	db.AutoMigrate(&model.OrgBinding{}, &model.OrgBindingAction{}, &model.OrgSecurityGroup{})
+	gormDb = db
+}
+
+// do send a request as a user of the fixture
+func (ts *testServer) do(username, method, path string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	token, err := ts.cc.UserToken(username)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if body != nil {
+		if err = json.NewEncoder(&buf).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *testServer) expectStatus(w *httptest.ResponseRecorder, want int) {
+	ts.t.Helper()
+	if w.Code != want {
+		ts.t.Fatalf("status = %d, want %d, body: %s", w.Code, want, w.Body.String())
+	}
+}
+
+func bindingBody(secGroupGuid, spaceGuid string) map[string]string {
+	return map[string]string{"security_group_guid": secGroupGuid, "space_guid": spaceGuid}
+}
+
+func relationshipBody(spaceGuid string) map[string]any {
+	return map[string]any{"data": []map[string]string{{"guid": spaceGuid}}}
+}
+
+func TestBindAndUnbind(t *testing.T) {
+	for _, username := range []string{"admin", "manager"} {
+		t.Run(username, func(t *testing.T) {
+			ts := newTestServer(t)
+			fake := ts.cc.Fake
+
+			ts.expectStatus(ts.do(username, http.MethodPost, "/v3/bindings", bindingBody("sg-db", "space-2")), http.StatusOK)
+			for _, lifecycle := range []string{client.LifecycleRunning, client.LifecycleStaging} {
+				if !fake.IsBound("sg-db", "space-2", lifecycle) {
+					t.Errorf("expected sg-db bound to space-2 on %s", lifecycle)
+				}
+			}
+			ts.expectStatus(ts.do(username, http.MethodDelete, "/v3/bindings", bindingBody("sg-db", "space-2")), http.StatusOK)
+			for _, lifecycle := range []string{client.LifecycleRunning, client.LifecycleStaging} {
+				if fake.IsBound("sg-db", "space-2", lifecycle) {
+					t.Errorf("expected sg-db unbound from space-2 on %s", lifecycle)
+				}
+			}
+
+			ts.expectStatus(ts.do(username, http.MethodPost, "/v3/security_groups/sg-db/relationships/staging_spaces", relationshipBody("space-1")), http.StatusOK)
+			if !fake.IsBound("sg-db", "space-1", client.LifecycleStaging) {
+				t.Error("expected sg-db bound to space-1 on staging")
+			}
+			ts.expectStatus(ts.do(username, http.MethodDelete, "/v3/security_groups/sg-db/relationships/staging_spaces/space-1", nil), http.StatusOK)
+			if fake.IsBound("sg-db", "space-1", client.LifecycleStaging) {
+				t.Error("expected sg-db unbound from space-1 on staging")
+			}
+			if !fake.IsBound("sg-db", "space-1", client.LifecycleRunning) {
+				t.Error("running binding of the fixture must be kept")
+			}
+		})
+	}
+}
+
+func TestBindRefusedToNonManagers(t *testing.T) {
+	ts := newTestServer(t)
+	fake := ts.cc.Fake
+
+	ts.expectStatus(ts.do("dev", http.MethodPost, "/v3/bindings", bindingBody("sg-db", "space-2")), http.StatusUnauthorized)
+	ts.expectStatus(ts.do("dev", http.MethodPost, "/v3/security_groups/sg-db/relationships/running_spaces", relationshipBody("space-2")), http.StatusUnauthorized)
+	ts.expectStatus(ts.do("dev", http.MethodDelete, "/v3/security_groups/sg-db/relationships/running_spaces/space-1", nil), http.StatusUnauthorized)
+	// manager of org-1 only
+	ts.expectStatus(ts.do("manager", http.MethodPost, "/v3/bindings", bindingBody("sg-db", "space-3")), http.StatusUnauthorized)
+
+	if fake.IsBound("sg-db", "space-2", client.LifecycleRunning) || fake.IsBound("sg-db", "space-3", client.LifecycleRunning) {
+		t.Error("refused bindings must not reach cloud controller")
+	}
+	if !fake.IsBound("sg-db", "space-1", client.LifecycleRunning) {
+		t.Error("refused unbinding must not reach cloud controller")
+	}
+}
+
+func TestEffectiveSecGroupsAcrossPages(t *testing.T) {
+	ts := newTestServer(t)
+	enabled := true
+	for _, name := range []string{"ntp", "proxy"} {
+		ts.cc.Fake.AddSecGroup(client.SecurityGroup{
+			Name:                   name,
+			Rules:                  []client.Rule{{Protocol: "tcp", Destination: "10.0.0.1", Ports: "443"}},
+			RunningGloballyEnabled: &enabled,
+		})
+	}
+	ts.cc.SetMaxPerPage(1)
+
+	w := ts.do("manager", http.MethodGet, "/v3/spaces/space-1/effective_security_groups", nil)
+	ts.expectStatus(w, http.StatusOK)
+	var effective client.EffectiveSecurityGroups
+	if err := json.Unmarshal(w.Body.Bytes(), &effective); err != nil {
+		t.Fatal(err)
+	}
+	running := make(map[string]bool)
+	for _, secGroup := range effective.SecurityGroups {
+		if secGroup.Lifecycle == client.LifecycleRunning {
+			running[secGroup.Name] = true
+		}
+	}
+	for _, name := range []string{"public-dns", "ntp", "proxy", "database"} {
+		if !running[name] {
+			t.Errorf("expected %s effective on running, got %+v", name, effective.SecurityGroups)
+		}
+	}
+}
+
+func TestCloudControllerErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        client.CloudFoundryHTTPError
+		wantStatus int
+	}{
+		{
+			name:       "unprocessable",
+			err:        client.CloudFoundryHTTPError{StatusCode: http.StatusUnprocessableEntity, Code: 10008, Title: "CF-UnprocessableEntity", Detail: "space is being deleted"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "server credentials refused",
+			err:        client.CloudFoundryHTTPError{StatusCode: http.StatusForbidden, Code: 10003, Title: "CF-NotAuthorized", Detail: "You are not authorized to perform the requested action"},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.cc.Fake.InjectError(clienttest.OpBindRunningSecGroup, tt.err)
+
+			w := ts.do("admin", http.MethodPost, "/v3/bindings", bindingBody("sg-db", "space-2"))
+			ts.expectStatus(w, tt.wantStatus)
+			var cfErr client.CloudFoundryErrorV3
+			if err := json.Unmarshal(w.Body.Bytes(), &cfErr); err != nil {
+				t.Fatal(err)
+			}
+			if cfErr.Code != tt.err.Code || cfErr.Title != tt.err.Title || cfErr.Detail != tt.err.Detail {
+				t.Errorf("error = %+v, want code, title and detail of %+v", cfErr, tt.err)
+			}
+		})
+	}
+}
+
+func TestOrgBindingAsManager(t *testing.T) {
+	ts := newTestServer(t)
+	ts.withDb()
+	fake := ts.cc.Fake
+	body := map[string]string{"security_group_guid": "sg-db", "organization_guid": "org-1", "lifecycle": client.LifecycleStaging}
+
+	ts.expectStatus(ts.do("dev", http.MethodPost, "/v3/org_bindings", body), http.StatusUnauthorized)
+	ts.expectStatus(ts.do("manager", http.MethodPost, "/v3/org_bindings", body), http.StatusCreated)
+	for _, space := range []string{"space-1", "space-2"} {
+		if !fake.IsBound("sg-db", space, client.LifecycleStaging) {
+			t.Errorf("expected sg-db bound to %s on staging", space)
+		}
+	}
+	if fake.IsBound("sg-db", "space-3", client.LifecycleStaging) {
+		t.Error("spaces of other orgs must not be bound")
+	}
+
+	w := ts.do("manager", http.MethodGet, "/v3/org_bindings?organization_guid=org-1", nil)
+	ts.expectStatus(w, http.StatusOK)
+	var orgBindings []model.OrgBinding
+	if err := json.Unmarshal(w.Body.Bytes(), &orgBindings); err != nil {
+		t.Fatal(err)
+	}
+	if len(orgBindings) != 1 || !orgBindings[0].Staging || orgBindings[0].Running {
+		t.Errorf("org bindings = %+v, want one on staging", orgBindings)
+	}
+
+	ts.expectStatus(ts.do("manager", http.MethodDelete, "/v3/org_bindings", body), http.StatusOK)
+	for _, space := range []string{"space-1", "space-2"} {
+		if fake.IsBound("sg-db", space, client.LifecycleStaging) {
+			t.Errorf("expected sg-db unbound from %s on staging", space)
+		}
+	}
+}
+
+func TestAdminSecGroupRulesPassThrough(t *testing.T) {
+	ts := newTestServer(t)
+	icmpType, icmpCode, logged := 8, -1, true
+	rules := []client.Rule{
+		{Protocol: client.ProtocolICMP, Destination: "10.0.0.0/8", Type: &icmpType, Code: &icmpCode, Description: "ping"},
+		{Protocol: client.ProtocolTCP, Destination: "10.0.1.10", Ports: "443", Description: "proxy", Log: &logged},
+	}
+	checkRules := func(got []client.Rule) {
+		t.Helper()
+		if len(got) != len(rules) {
+			t.Fatalf("rules = %+v, want %+v", got, rules)
+		}
+		icmp, tcp := got[0], got[1]
+		if icmp.Type == nil || *icmp.Type != icmpType || icmp.Code == nil || *icmp.Code != icmpCode || icmp.Description != "ping" {
+			t.Errorf("icmp rule = %+v, want type, code and description kept", icmp)
+		}
+		if tcp.Log == nil || !*tcp.Log || tcp.Description != "proxy" || tcp.Type != nil || tcp.Code != nil {
+			t.Errorf("tcp rule = %+v, want log and description kept", tcp)
+		}
+	}
+
+	w := ts.do("admin", http.MethodPost, "/v3/security_groups", map[string]any{"name": "ping", "rules": rules})
+	ts.expectStatus(w, http.StatusCreated)
+	var created client.SecurityGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	checkRules(created.Rules)
+	stored, _ := ts.cc.Fake.SecGroup(created.GUID)
+	checkRules(stored.Rules)
+
+	w = ts.do("admin", http.MethodPatch, "/v3/security_groups/"+created.GUID, map[string]any{"rules": rules})
+	ts.expectStatus(w, http.StatusOK)
+	stored, _ = ts.cc.Fake.SecGroup(created.GUID)
+	checkRules(stored.Rules)
+
+	invalid := []client.Rule{{Protocol: client.ProtocolICMP, Destination: "10.0.0.0/8"}}
+	ts.expectStatus(ts.do("admin", http.MethodPost, "/v3/security_groups", map[string]any{"name": "no-type", "rules": invalid}), http.StatusUnprocessableEntity)
+}
+
+func TestSpaceWatcherChecksOtherOrgsOnError(t *testing.T) {
+	ts := newTestServer(t)
+	ts.withDb()
+	fake := ts.cc.Fake
+	boundAt := time.Now().Add(-time.Hour)
+	for _, orgGuid := range []string{"org-1", "org-2"} {
+		orgBinding := model.OrgBinding{SecurityGroupGUID: "sg-db", OrganizationGUID: orgGuid, Running: true, LastCheckedAt: boundAt, CreatedAt: boundAt}
+		if err := gormDb.Create(&orgBinding).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.AddSpace("org-1", "new-1", "new")
+	fake.AddSpace("org-2", "new-2", "new")
+	fake.FailNext(clienttest.OpGetSpacesWithOrg, client.CloudFoundryHTTPError{
+		StatusCode: http.StatusInternalServerError, Code: 10001, Title: "UnknownError", Detail: "cloud controller is down",
+	})
+
+	sw := NewSpaceWatcher(gormDb, time.Minute)
+	err := sw.check(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "cloud controller is down") {
+		t.Fatalf("got %v, want the error of the failing org", err)
+	}
+	bound1, bound2 := fake.IsBound("sg-db", "new-1", client.LifecycleRunning), fake.IsBound("sg-db", "new-2", client.LifecycleRunning)
+	if bound1 == bound2 {
+		t.Fatalf("new spaces bound: org-1 %v, org-2 %v, want only the org which didn't fail", bound1, bound2)
+	}
+
+	if err = sw.check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, spaceGuid := range []string{"new-1", "new-2"} {
+		if !fake.IsBound("sg-db", spaceGuid, client.LifecycleRunning) {
+			t.Errorf("expected %s bound on next check", spaceGuid)
+		}
+	}
+}
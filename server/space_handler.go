@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"code.cloudfoundry.org/cli/v8/api/cloudcontroller/ccv3/constant"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+)
+
+// list security groups applied to a space, globally enabled or bound, with their merged rules
+func handleEffectiveSecGroups(w http.ResponseWriter, req *http.Request) {
+	spaceGuid := mux.Vars(req)["guid"]
+	space, err := getSpaceByGuid(req.Context(), spaceGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	hasAccess, err := canManageOrg(req, space.Relationships[constant.RelationshipTypeOrganization].GUID)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if !hasAccess {
+		serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+		return
+	}
+
+	effective, err := client.BuildEffectiveSecGroupsWith(req.Context(), cfclient, space)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	b, _ := json.MarshalIndent(effective, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// check if apps of a space can reach a destination, answer for each lifecycle
+func handleCheckEgress(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	ip := net.ParseIP(query.Get("destination"))
+	if ip == nil {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("destination must be a valid ip, got '%s'", query.Get("destination")))
+		return
+	}
+	port, err := client.ParsePort(query.Get("port"))
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	protocol := query.Get("protocol")
+	if protocol == "" {
+		protocol = client.ProtocolTCP
+	}
+	if !client.ValidProtocol(protocol) {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("invalid protocol '%s'", protocol))
+		return
+	}
+
+	spaceGuid := mux.Vars(req)["guid"]
+	space, err := getSpaceByGuid(req.Context(), spaceGuid)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	hasAccess, err := canManageOrg(req, space.Relationships[constant.RelationshipTypeOrganization].GUID)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	if !hasAccess {
+		serverErrorCode(w, req, http.StatusUnauthorized, fmt.Errorf("acces denied"))
+		return
+	}
+
+	check, err := client.BuildEgressCheckWith(req.Context(), cfclient, space, ip, port, protocol)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+	bindable := make([]client.EgressMatch, 0, len(check.BindableSecurityGroups))
+	for _, match := range check.BindableSecurityGroups {
+		ok, err := isBindableInOrg(match.SecurityGroupGUID, check.OrganizationGUID)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		if ok {
+			bindable = append(bindable, match)
+		}
+	}
+	check.BindableSecurityGroups = bindable
+	b, _ := json.MarshalIndent(check, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
+
+// list spaces which can reach a destination, org managers only see spaces of orgs they manage
+func handleReachableSpaces(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	ipNet, err := client.ParseDestination(query.Get("destination"))
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	port, err := client.ParsePort(query.Get("port"))
+	if err != nil {
+		serverErrorCode(w, req, http.StatusBadRequest, err)
+		return
+	}
+	protocol := query.Get("protocol")
+	if protocol == "" {
+		protocol = client.ProtocolTCP
+	}
+	if !client.ValidProtocol(protocol) {
+		serverErrorCode(w, req, http.StatusBadRequest, fmt.Errorf("invalid protocol '%s'", protocol))
+		return
+	}
+
+	access, err := client.BuildSpacesAccessWith(req.Context(), cfclient, ipNet, port, protocol)
+	if err != nil {
+		serverError(w, req, err)
+		return
+	}
+
+	if !context.Get(req, ContextIsAdmin).(bool) {
+		userId, err := getUserId(req)
+		if err != nil {
+			serverErrorCode(w, req, http.StatusBadRequest, err)
+			return
+		}
+		orgGuids := make([]string, 0)
+		for _, space := range access.Spaces {
+			orgGuids = append(orgGuids, space.OrganizationGUID)
+		}
+		managedOrgs, err := getManagedOrgs(req.Context(), userId, orgGuids)
+		if err != nil {
+			serverError(w, req, err)
+			return
+		}
+		spaces := make([]client.SpaceAccess, 0)
+		for _, space := range access.Spaces {
+			if managedOrgs[space.OrganizationGUID] {
+				spaces = append(spaces, space)
+			}
+		}
+		access.Spaces = spaces
+	}
+
+	b, _ := json.MarshalIndent(access, "", "  ")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// tokenRefreshMargin is how long before expiry a token is renewed
+const tokenRefreshMargin = 10 * time.Minute
+
+// tokenRetryInterval is how long to wait before renewing again a token after a failure
+const tokenRetryInterval = 10 * time.Second
+
+// TokenManager hold the cloud foundry access token shared by all handlers,
+// it renews the token before it expires and only one renewal can happen at a time
+type TokenManager struct {
+	mu           sync.RWMutex
+	token        string
+	renewAt      time.Time
+	expiresAt    time.Time
+	group        singleflight.Group
+	authenticate func() (string, time.Time, error)
+}
+
+func NewTokenManager(authenticate func() (string, time.Time, error)) *TokenManager {
+	return &TokenManager{authenticate: authenticate}
+}
+
+// Token return the current token, it is renewed first when it is about to expire
+func (tm *TokenManager) Token() (string, error) {
+	tm.mu.RLock()
+	token, renewAt := tm.token, tm.renewAt
+	tm.mu.RUnlock()
+	if token != "" && time.Now().Before(renewAt) {
+		return token, nil
+	}
+	return tm.renew()
+}
+
+// Refresh renew a token rejected by cloud controller, unless it has already been renewed meanwhile
+func (tm *TokenManager) Refresh(rejected string) (string, error) {
+	tm.mu.RLock()
+	token := tm.token
+	tm.mu.RUnlock()
+	if token != rejected && token != "" {
+		return token, nil
+	}
+	return tm.renew()
+}
+
+// ExpiresIn give the time left before the current token expires, 0 when no token has been retrieved yet
+func (tm *TokenManager) ExpiresIn() time.Duration {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if tm.expiresAt.IsZero() {
+		return 0
+	}
+	return time.Until(tm.expiresAt)
+}
+
+// Run renew the token in background before it expires
+func (tm *TokenManager) Run() {
+	for {
+		tm.mu.RLock()
+		wait := time.Until(tm.renewAt)
+		tm.mu.RUnlock()
+		time.Sleep(max(wait, tokenRetryInterval))
+		_, err := tm.Token()
+		if err != nil {
+			log.Errorf("error when renewing cloud foundry access token: %s", err.Error())
+		}
+	}
+}
+
+func (tm *TokenManager) renew() (string, error) {
+	token, err, _ := tm.group.Do("token", func() (interface{}, error) {
+		token, expiresAt, err := tm.authenticate()
+		if err != nil {
+			gTokenRefreshTotal.WithLabelValues("error").Inc()
+			return "", err
+		}
+		tm.mu.Lock()
+		tm.token = token
+		tm.expiresAt = expiresAt
+		// short lived tokens are renewed at half of their life
+		tm.renewAt = expiresAt.Add(-min(tokenRefreshMargin, time.Until(expiresAt)/2))
+		tm.mu.Unlock()
+		gTokenRefreshTotal.WithLabelValues("success").Inc()
+		gTokenExpiresAt.Set(float64(expiresAt.Unix()))
+		return token, nil
+	})
+	return token.(string), err
+}
+
+var (
+	gTokenRefreshTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "cfsecurity",
+			Name:      "token_refresh_total",
+			Help:      "Number of cloud foundry access token renewals",
+		},
+		[]string{"result"},
+	)
+	gTokenExpiresAt = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "cfsecurity",
+			Name:      "token_expires_at_seconds",
+			Help:      "Expiry time of the cloud foundry access token in unix seconds",
+		},
+	)
+	gTokenExpiresIn = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: "cfsecurity",
+			Name:      "token_expires_in_seconds",
+			Help:      "Seconds left before the cloud foundry access token expires, negative once expired",
+		},
+		func() float64 {
+			if tokenManager == nil {
+				return 0
+			}
+			return tokenManager.ExpiresIn().Seconds()
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(gTokenRefreshTotal, gTokenExpiresAt, gTokenExpiresIn)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
+	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/model"
+	"github.com/prometheus/common/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/orange-cloudfoundry/cf-security-entitlement/v2/server"
+
+// tracerProvider is the provider set from config, it is nil when tracing is disabled
+var tracerProvider *sdktrace.TracerProvider
+
+// loadTracing set the global tracer provider and propagator from config, spans are exported with otlp over http
+// or written on stdout, nothing is exported when no exporter is set
+func loadTracing(c model.TracingConfig) error {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(c.Exporter) {
+	case "":
+		return nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		opts := make([]otlptracehttp.Option, 0)
+		if c.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(c.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(stdcontext.Background(), opts...)
+	default:
+		return fmt.Errorf("unknown tracing exporter %s, use otlp or stdout", c.Exporter)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid tracing config: %s", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", c.ServiceName),
+			attribute.String("service.version", version.Version),
+		)),
+	)
+	if tracerProvider != nil {
+		_ = tracerProvider.Shutdown(stdcontext.Background())
+	}
+	tracerProvider = provider
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+// tracingHandler give each request a server span continuing the trace propagated by the caller,
+// the span get the route, the principal and the outcome of the request
+func tracingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		route := routeTemplate(req)
+		ctx, span := otel.Tracer(tracerName).Start(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", req.URL.Path),
+				attribute.String("request_id", client.RequestIDFromContext(req.Context())),
+			),
+		)
+		defer span.End()
+
+		req = req.WithContext(ctx)
+		w := NewMetricResponseWriter(res)
+		next.ServeHTTP(w, req)
+
+		if principal, ok := context.Get(req, ContextPrincipal).(string); ok {
+			span.SetAttributes(attribute.String("enduser.id", principal))
+		}
+		if isAdmin, ok := context.Get(req, ContextIsAdmin).(bool); ok {
+			span.SetAttributes(attribute.Bool("is_admin", isAdmin))
+		}
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", w.statusCode),
+			attribute.String("outcome", outcome(w.statusCode)),
+		)
+		if w.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(w.statusCode))
+		}
+	})
+}
+
+// routeTemplate give the path template of the route matching a request, or its path when no route matched
+func routeTemplate(req *http.Request) string {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return req.URL.Path
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return req.URL.Path
+	}
+	return template
+}
+
+// outcome describe the result of a request from its status code
+func outcome(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return "denied"
+	case statusCode == http.StatusTooManyRequests:
+		return "rate_limited"
+	case statusCode >= http.StatusInternalServerError:
+		return "error"
+	case statusCode >= http.StatusBadRequest:
+		return "refused"
+	}
+	return "success"
+}
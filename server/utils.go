@@ -10,25 +10,49 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/orange-cloudfoundry/cf-security-entitlement/v2/client"
-	"github.com/prometheus/client_golang/prometheus"
-	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func serverError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, client.ErrNotFound) {
+		serverErrorCode(w, r, http.StatusNotFound, err)
+		return
+	}
 	serverErrorCode(w, r, http.StatusInternalServerError, err)
 }
 
+// serverErrorCode write err with code, errors of cloud controller keep their body and their status unless the caller
+// gave a status other than 500, cloud controller refusing the credentials of the server is answered with 502
+// so that it is not taken for a refusal of the user
 func serverErrorCode(w http.ResponseWriter, r *http.Request, code int, err error) {
-	log.Error(err)
+	requestLog(r).Error(err)
+	trace.SpanFromContext(r.Context()).RecordError(err)
 	w.Header().Add("Content-Type", "application/json")
-	var httpErr client.CloudFoundryErrorV3
+	var httpErr client.CloudFoundryHTTPError
 	if errors.As(err, &httpErr) {
-		w.WriteHeader(httpErr.Code)
-		b, _ := json.Marshal(client.CloudFoundryErrorV3{
+		status := httpErr.StatusCode
+		switch {
+		case code != http.StatusInternalServerError:
+			status = code
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			status = http.StatusBadGateway
+		}
+		cfErr := client.CloudFoundryErrorV3{
 			Code:   httpErr.Code,
 			Title:  httpErr.Title,
 			Detail: httpErr.Detail,
-		})
+		}
+		if cfErr.Code == 0 {
+			cfErr.Code = status
+		}
+		if cfErr.Title == "" {
+			cfErr.Title = http.StatusText(status)
+		}
+		if cfErr.Detail == "" {
+			cfErr.Detail = err.Error()
+		}
+		w.WriteHeader(status)
+		b, _ := json.Marshal(cfErr)
 		// Fix errcheck: ignore write error (error already logged above)
 		_, _ = w.Write(b)
 		return
@@ -41,11 +65,6 @@ func serverErrorCode(w http.ResponseWriter, r *http.Request, code int, err error
 	})
 	// Fix errcheck: ignore write error (error already logged above)
 	_, _ = w.Write(b)
-	gHttpTotal.With(prometheus.Labels{
-		"endpoint": r.URL.Path,
-		"method":   r.Method,
-		"status":   fmt.Sprintf("%d", code),
-	}).Inc()
 }
 
 /*
@@ -67,7 +86,7 @@ func getUserId(req *http.Request) (string, error) {
 	var userIdStruct struct {
 		UserID string `json:"user_id"`
 	}
-	userInfo, err := base64.RawStdEncoding.DecodeString(tokenSplit[1])
+	userInfo, err := base64.RawURLEncoding.DecodeString(tokenSplit[1])
 	if err != nil {
 		return "", fmt.Errorf("invalid token")
 	}